@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"os"
-	"sync"
+	"os/signal"
 
 	"github.com/automatico/jato/internal/logger"
 	"github.com/automatico/jato/internal/templates"
@@ -18,6 +19,15 @@ var allDevices []driver.NetDevice
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "hostkeys" {
+		core.HostKeys(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "detect" {
+		core.Detect(os.Args[2:])
+		return
+	}
+
 	cliParams := core.CLI()
 
 	// Output data to feed into template
@@ -49,64 +59,58 @@ func main() {
 			d.Credentials.SSHKeyFile = cliParams.Credentials.SSHKeyFile
 		}
 
-		vendorPlatform := fmt.Sprintf("%s_%s", d.Vendor, d.Platform)
-		switch vendorPlatform {
-		case "arista_eos":
-			nd := driver.NewAristaEOSDevice(d)
-			allDevices = append(allDevices, nd)
-		case "aruba_aoscx":
-			nd := driver.NewArubaAOSCXDevice(d)
-			allDevices = append(allDevices, nd)
-		case "cisco_aireos":
-			nd := driver.NewCiscoAireOSDevice(d)
-			allDevices = append(allDevices, nd)
-		case "cisco_asa":
-			nd := driver.NewCiscoASADevice(d)
-			allDevices = append(allDevices, nd)
-		case "cisco_ios":
-			nd := driver.NewCiscoIOSDevice(d)
-			allDevices = append(allDevices, nd)
-		case "cisco_iosxr":
-			nd := driver.NewCiscoIOSXRDevice(d)
-			allDevices = append(allDevices, nd)
-		case "cisco_nxos":
-			nd := driver.NewCiscoNXOSDevice(d)
-			allDevices = append(allDevices, nd)
-		case "cisco_smb":
-			nd := driver.NewCiscoSMBDevice(d)
-			allDevices = append(allDevices, nd)
-		case "juniper_junos":
-			nd := driver.NewJuniperJunosDevice(d)
-			allDevices = append(allDevices, nd)
-		default:
-			logger.Warningf("device: %s with vendor: %s and platform: %s not supported", d.Name, d.Vendor, d.Platform)
+		// Devices and jump hosts keep their own host key policy
+		if cliParams.HostKeyPolicy != "" {
+			if d.SSHParams.HostKeyPolicy == "" {
+				d.SSHParams.HostKeyPolicy = cliParams.HostKeyPolicy
+			}
+			for i, hop := range d.SSHParams.JumpHosts {
+				if hop.HostKeyPolicy == "" {
+					d.SSHParams.JumpHosts[i].HostKeyPolicy = cliParams.HostKeyPolicy
+				}
+			}
 		}
-	}
 
-	if !cliParams.NoOp {
+		// Devices keep their own proxy
+		if cliParams.Proxy != "" {
+			if d.SSHParams.Proxy == "" {
+				d.SSHParams.Proxy = cliParams.Proxy
+			}
+			if d.TelnetParams.Proxy == "" {
+				d.TelnetParams.Proxy = cliParams.Proxy
+			}
+			if d.ConsoleParams.Proxy == "" {
+				d.ConsoleParams.Proxy = cliParams.Proxy
+			}
+		}
 
-		results := []data.Result{}
+		nd, err := driver.NewDevice(d)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		allDevices = append(allDevices, nd)
+	}
 
-		var wg sync.WaitGroup
-		ch := make(chan data.Result)
-		defer close(ch)
+	if !cliParams.NoOp {
 
-		wg.Add(len(allDevices))
-		for _, dev := range allDevices {
-			dev := dev // lock the host or the same host can run more than once
-			switch dev.Connector {
-			case "ssh":
-				go driver.RunWithSSH(dev, cliParams.Commands.Commands, ch, &wg)
-			case "telnet":
-				go driver.RunWithTelnet(dev, cliParams.Commands.Commands, ch, &wg)
-			}
+		// Stop the job on Ctrl-C or when the job timeout passes
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if cliParams.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cliParams.Timeout)
+			defer cancel()
 		}
 
-		for i := 0; i < len(allDevices); i++ {
-			results = append(results, <-ch)
-		}
+		// Devices share their connections to jump hosts
+		defer driver.CloseJumpHosts()
 
-		wg.Wait()
+		runner := core.Runner{
+			Workers:     cliParams.Workers,
+			VendorLimit: cliParams.VendorLimit,
+			SiteLimit:   cliParams.SiteLimit,
+		}
 
 		t, err := template.New("results").Parse(templates.CliResult)
 		if err != nil {
@@ -115,16 +119,30 @@ func main() {
 
 		fmt.Print(terminal.Banner("Job Results"))
 
-		for _, r := range results {
+		// Validated when the expect file is loaded
+		expect, _ := cliParams.Expect.Steps()
+
+		job := driver.Job{
+			Commands:     cliParams.Commands.Commands,
+			Config:       cliParams.Config.Config,
+			Expect:       expect,
+			Commit:       cliParams.Commit,
+			OnError:      cliParams.OnError,
+			Retry:        cliParams.Retry,
+			CommandRetry: cliParams.CommandRetry,
+		}
+
+		// Results are output as soon as each device finishes
+		for r := range runner.Run(ctx, allDevices, job) {
 			err = t.Execute(os.Stdout, r)
 
 			if err != nil {
 				logger.Fatal(err)
 			}
-		}
 
-		core.WriteToFile(results)
-		core.WriteToJSONFile(results)
+			core.WriteToFile([]data.Result{r})
+			core.WriteToJSONFile([]data.Result{r})
+		}
 	}
 
 }
@@ -1,11 +1,10 @@
 module github.com/automatico/jato
 
-go 1.15
+go 1.16
 
 require (
-	github.com/reiver/go-oi v1.0.0 // indirect
-	github.com/reiver/go-telnet v0.0.0-20180421082511-9ff0b2ab096e
 	golang.org/x/crypto v0.0.0-20210314154223-e6e6c4f2bb5b
 	golang.org/x/sys v0.0.0-20210316092937-0b90fd5c4c48 // indirect
 	golang.org/x/term v0.0.0-20210317153231-de623e64d2a6
+	gopkg.in/yaml.v3 v3.0.1
 )
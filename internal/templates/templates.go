@@ -23,6 +23,20 @@ Commands:
 {{- range .params.Commands.Commands}}
   - {{.}}
 {{- end }}
+{{- if .params.Expect.CommandExpect }}
+
+Expect:
+{{- range .params.Expect.CommandExpect}}
+  - {{.Command}}
+{{- end }}
+{{- end }}
+{{- if .params.Config.Config }}
+
+Config:
+{{- range .params.Config.Config}}
+  - {{.}}
+{{- end }}
+{{- end }}
 {{/* SPACE */}}
 `
 
@@ -32,5 +46,19 @@ const CliResult = `{{/* SPACE */}}
 {{.Device}}:
   OK: {{.OK}}
   Error: {{.Error}}
+{{- with .Failure }}
+  Failure: {{.}}
+{{- end }}
   Timestamp: {{.Timestamp}}
+{{- range .CommandOutputs }}
+{{- if .Failed }}
+  Failed: {{.Command}}: {{.Error}}
+{{- end }}
+{{- end }}
+{{- with .Commit }}
+  Commit:
+    ID: {{.ID}}
+    Confirmed: {{.Confirmed}}
+    Rolled Back: {{.RolledBack}}
+{{- end }}
 `
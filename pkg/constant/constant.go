@@ -8,16 +8,31 @@ import (
 
 const SSHPort = 22
 const TelnetPort = 23
+const NetconfPort = 830
 
 const Timeout = 5
 
-var LoginRE = regexp.MustCompile(`(?im)^login:$`)
-var UsernameRE = regexp.MustCompile(`(?im)^username:$`)
-var PasswordRE = regexp.MustCompile(`(?im)^password:$`)
+const Workers = 10
+
+// LoginRE matches the login prompts of Telnet servers,
+// which some prefix with the host name. EG: switch login:
+var LoginRE = regexp.MustCompile(`(?im)login:\s?$`)
+var UsernameRE = regexp.MustCompile(`(?im)^username:\s?$`)
+var PasswordRE = regexp.MustCompile(`(?im)^password:\s?$`)
+var EnablePasswordRE = regexp.MustCompile(`(?im)^password:\s?$`)
 
 var SSHKnownHostsFile = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+
+// JatoKnownHostsFile holds the host keys
+// jato accepts on first use
+var JatoKnownHostsFile = filepath.Join(os.Getenv("HOME"), ".jato", "known_hosts")
+
 var SSHKeyFile = filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
 
+// SSHKeyPassphraseEnv is the environment variable
+// holding the passphrase of an encrypted SSH key
+const SSHKeyPassphraseEnv = "JATO_SSH_KEY_PASSPHRASE"
+
 var InsecureSSHCiphers = []string{
 	"aes128-ctr",
 	"aes192-ctr",
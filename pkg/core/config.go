@@ -0,0 +1,7 @@
+package core
+
+// Config holds the configuration
+// lines to send to devices
+type Config struct {
+	Config []string `json:"config"`
+}
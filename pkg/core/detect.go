@@ -0,0 +1,288 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+
+	"github.com/automatico/jato/internal/logger"
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// Detect is the interface to the detect subcommand, it detects
+// the platform of the devices of an inventory whose vendor is
+// auto and writes their vendor and platform to the inventory.
+func Detect(args []string) {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	userPtr := fs.String("u", os.Getenv("JATO_SSH_USER"), "Username to connect to devices with")
+	askUserPassPtr := fs.Bool("a", false, "Ask for user password")
+	devicesPtr := fs.String("d", "devices.json", "Devices inventory file")
+	outPtr := fs.String("o", "", "File to write the inventory to (default the devices inventory file)")
+	platformsPtr := fs.String("p", "", "Platform definitions directory")
+	workersPtr := fs.Int("workers", constant.Workers, "Number of devices to detect at once")
+	fs.Parse(args)
+
+	if *workersPtr < 1 {
+		logger.Fatal("at least 1 worker is required")
+	}
+	if *platformsPtr != "" {
+		if err := driver.LoadDefinitions(*platformsPtr); err != nil {
+			logger.Fatalf("unable to load platform definitions: %v", err)
+		}
+	}
+	password := ""
+	if *askUserPassPtr {
+		var err error
+		if password, err = promptSecret("Enter user password:"); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if *outPtr == "" {
+		*outPtr = *devicesPtr
+	}
+
+	devices, index := loadDetectDevices(*devicesPtr, *userPtr, password)
+	if len(devices) == 0 {
+		fmt.Println("no devices with the vendor auto")
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	defer driver.CloseJumpHosts()
+
+	detected := map[int]Detection{}
+	for i, dt := range detectPlatforms(ctx, devices, *workersPtr) {
+		fmt.Println(dt)
+		if dt.Err == nil {
+			detected[index[i]] = dt
+		}
+	}
+	if len(detected) == 0 {
+		return
+	}
+	if err := WriteDetected(*devicesPtr, *outPtr, detected); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// loadDetectDevices loads and initializes the devices of an
+// inventory whose vendor is auto, it also returns the index
+// of each of them in the inventory.
+func loadDetectDevices(fileName, user, password string) ([]driver.NetDevice, []int) {
+	if err := FileStat(fileName); err != nil {
+		logger.Fatalf("device file does not exist: %v", fileName)
+	}
+	devices := []driver.NetDevice{}
+	index := []int{}
+	for i, d := range LoadDevices(fileName).Devices {
+		if d.Vendor != driver.AutoVendor {
+			continue
+		}
+		d.Credentials = data.GetCredentials(d.Variables.Credentials)
+		if d.Variables.Credentials == "" {
+			if user != "" {
+				d.Credentials.Username = user
+			}
+			if password != "" {
+				d.Credentials.Password = password
+			}
+		}
+		nd, err := driver.NewDevice(d)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		devices = append(devices, nd)
+		index = append(index, i)
+	}
+	return devices, index
+}
+
+// Detection is the outcome of detecting a device's platform.
+type Detection struct {
+	Device   string
+	Vendor   string
+	Platform string
+	Err      error
+}
+
+func (dt Detection) String() string {
+	if dt.Err != nil {
+		return fmt.Sprintf("%s: %v", dt.Device, dt.Err)
+	}
+	return fmt.Sprintf("%s: %s %s", dt.Device, dt.Vendor, dt.Platform)
+}
+
+// detectPlatforms detects the platform of devices, workers
+// devices at once. The detections are returned in the order
+// of the devices.
+func detectPlatforms(ctx context.Context, devices []driver.NetDevice, workers int) []Detection {
+	detections := make([]Detection, len(devices))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, nd := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, nd driver.NetDevice) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			dt := Detection{Device: nd.Name}
+			dt.Vendor, dt.Platform, dt.Err = driver.Detect(ctx, nd)
+			detections[i] = dt
+		}(i, nd)
+	}
+	wg.Wait()
+	return detections
+}
+
+// WriteDetected sets the vendor and platform of the detected
+// devices, by their index, in the inventory read from src and
+// writes it to dst. Only the vendor and platform values are
+// changed, the other fields and the order of the keys are kept.
+// dst is replaced with a file written next to it, so it is not
+// left half written.
+func WriteDetected(src, dst string, detected map[int]Detection) error {
+	file, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	inventory := jsonObject{}
+	if err := json.Unmarshal(file, &inventory); err != nil {
+		return err
+	}
+	devices := []jsonObject{}
+	if err := json.Unmarshal(inventory.values["devices"], &devices); err != nil {
+		return err
+	}
+
+	for i, dt := range detected {
+		if i >= len(devices) {
+			return fmt.Errorf("device %s is not in %s", dt.Device, src)
+		}
+		vendor, _ := json.Marshal(dt.Vendor)
+		platform, _ := json.Marshal(dt.Platform)
+		devices[i].set("vendor", vendor)
+		devices[i].set("platform", platform)
+	}
+
+	raw, err := marshalJSON(devices, "")
+	if err != nil {
+		return err
+	}
+	inventory.set("devices", raw)
+
+	out, err := marshalJSON(inventory, "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(dst, out)
+}
+
+// marshalJSON returns the JSON encoding of v, indented with
+// indent, without escaping the characters of HTML. EG: <
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// replaceFile writes a file next to name and renames it over
+// name. The mode of name is kept, a new file is made 0644.
+func replaceFile(name string, b []byte) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(name); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// jsonObject is a JSON object that keeps the order of its keys.
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// set sets the value of a key, a new key is added last.
+func (o *jsonObject) set(key string, value json.RawMessage) {
+	if o.values == nil {
+		o.values = map[string]json.RawMessage{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *jsonObject) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("want a JSON object, got %v", t)
+	}
+	*o = jsonObject{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		o.set(t.(string), value)
+	}
+	_, err := dec.Token()
+	return err
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(o.values[key])
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,107 @@
+package core_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/automatico/jato/pkg/core"
+)
+
+func TestWriteDetected(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name     string
+		detected map[int]core.Detection
+		want     string
+		wantErr  bool
+	}
+	inventory := `{
+  "devices": [
+    {"name": "veos-1", "ip": "10.0.0.1", "vendor": "auto", "connector": "ssh", "variables": {"credentials": "<lab>"}},
+    {"name": "iosv-1", "vendor": "auto", "ip": "10.0.0.2", "connector": "telnet"}
+  ],
+  "comment": "lab"
+}
+`
+	testCases := []testCase{
+		{
+			name: "keeps the order of the keys",
+			detected: map[int]core.Detection{
+				0: {Device: "veos-1", Vendor: "arista", Platform: "eos"},
+				1: {Device: "iosv-1", Vendor: "cisco", Platform: "ios"},
+			},
+			want: `{
+  "devices": [
+    {
+      "name": "veos-1",
+      "ip": "10.0.0.1",
+      "vendor": "arista",
+      "connector": "ssh",
+      "variables": {
+        "credentials": "<lab>"
+      },
+      "platform": "eos"
+    },
+    {
+      "name": "iosv-1",
+      "vendor": "cisco",
+      "ip": "10.0.0.2",
+      "connector": "telnet",
+      "platform": "ios"
+    }
+  ],
+  "comment": "lab"
+}
+`,
+		},
+		{
+			name:     "a device that is not in the inventory",
+			detected: map[int]core.Detection{2: {Device: "nxos-1", Vendor: "cisco", Platform: "nxos"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			file := filepath.Join(dir, "devices.json")
+			if err := ioutil.WriteFile(file, []byte(inventory), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := core.WriteDetected(file, file, tc.detected)
+			got, _ := ioutil.ReadFile(file)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want an error, got nil")
+				}
+				if string(got) != inventory {
+					t.Errorf("want the inventory unchanged, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+
+			fi, err := os.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0600 {
+				t.Errorf("want the mode kept, got %v", fi.Mode().Perm())
+			}
+			files, _ := ioutil.ReadDir(dir)
+			if len(files) != 1 {
+				t.Errorf("want only the inventory, got %d files", len(files))
+			}
+		})
+	}
+}
@@ -1,13 +1,31 @@
 package core
 
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/automatico/jato/pkg/driver"
+)
+
 // Expect struct
 // Command: command to run
-// Expecting: string you are expecting
+// Expecting: regex of the output you are expecting,
+// the device's prompt when empty
 // Timeout: How long to wait for a command
+// Responses: answers to interactive prompts
 type Expect struct {
-	Command   string `json:"command"`
-	Expecting string `json:"expecting"`
-	Timeout   int64  `json:"timeout"`
+	Command   string     `json:"command"`
+	Expecting string     `json:"expecting"`
+	Timeout   int64      `json:"timeout"`
+	Responses []Response `json:"responses"`
+}
+
+// Response struct
+// Prompt: regex of an interactive prompt
+// Response: what to answer it with
+type Response struct {
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
 }
 
 // CommandExpect holds a slice of
@@ -15,3 +33,28 @@ type Expect struct {
 type CommandExpect struct {
 	CommandExpect []Expect `json:"command_expect"`
 }
+
+// Steps compiles the expect commands
+// into the steps a driver runs.
+func (ce CommandExpect) Steps() ([]driver.ExpectStep, error) {
+	steps := []driver.ExpectStep{}
+	for _, e := range ce.CommandExpect {
+		step := driver.ExpectStep{Command: e.Command, Timeout: e.Timeout}
+		if e.Expecting != "" {
+			re, err := regexp.Compile(e.Expecting)
+			if err != nil {
+				return nil, fmt.Errorf("%s: expecting: %v", e.Command, err)
+			}
+			step.Expect = re
+		}
+		for _, r := range e.Responses {
+			re, err := regexp.Compile(r.Prompt)
+			if err != nil {
+				return nil, fmt.Errorf("%s: prompt: %v", e.Command, err)
+			}
+			step.Responses = append(step.Responses, driver.ExpectResponse{Prompt: re, Response: r.Response})
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
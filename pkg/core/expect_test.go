@@ -0,0 +1,33 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/automatico/jato/pkg/core"
+)
+
+func TestCommandExpectSteps(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		expect  core.Expect
+		wantErr bool
+	}
+	testCases := []testCase{
+		{expect: core.Expect{Command: "show version", Expecting: "#", Timeout: 5}, wantErr: false},
+		{expect: core.Expect{Command: "show version"}, wantErr: false},
+		{expect: core.Expect{Command: "reload", Responses: []core.Response{{Prompt: `\[confirm\]`}}}, wantErr: false},
+		{expect: core.Expect{Command: "show version", Expecting: "(#"}, wantErr: true},
+		{expect: core.Expect{Command: "reload", Responses: []core.Response{{Prompt: `[confirm`}}}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		ce := core.CommandExpect{CommandExpect: []core.Expect{tc.expect}}
+		steps, err := ce.Steps()
+		if tc.wantErr != (err != nil) {
+			t.Errorf("%+v: want error %t, got %v", tc.expect, tc.wantErr, err)
+		}
+		if err == nil && len(steps[0].Responses) != len(tc.expect.Responses) {
+			t.Errorf("%+v: want %d responses, got %d", tc.expect, len(tc.expect.Responses), len(steps[0].Responses))
+		}
+	}
+}
@@ -29,6 +29,42 @@ func LoadCommands(fileName string) data.Commands {
 	return commands
 }
 
+// LoadConfig loads the configuration
+// lines to send from a JSON file
+func LoadConfig(fileName string) Config {
+	file, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	config := Config{}
+
+	err = json.Unmarshal([]byte(file), &config)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	return config
+}
+
+// LoadExpect loads the expect
+// commands to run from a JSON file
+func LoadExpect(fileName string) CommandExpect {
+	file, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	expect := CommandExpect{}
+
+	err = json.Unmarshal([]byte(file), &expect)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	return expect
+}
+
 // Load a list of devices from a JSON file
 func LoadDevices(fileName string) driver.Devices {
 	file, err := ioutil.ReadFile(fileName)
@@ -80,6 +116,7 @@ func WriteToFile(results []data.Result) {
 		file, err := os.OpenFile(fmt.Sprintf("%s/%s/%d.raw", outdir, result.Device, result.Timestamp), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			logger.Error(err)
+			continue
 		}
 
 		writer := bufio.NewWriter(file)
@@ -88,14 +125,24 @@ func WriteToFile(results []data.Result) {
 		writeStringToFile(writer, fmt.Sprintf("! Timestamp: %d\n", result.Timestamp))
 		writeStringToFile(writer, fmt.Sprintf("! OK:        %t\n", result.OK))
 		writeStringToFile(writer, fmt.Sprintf("! Error:     %s\n", result.Error))
+		if result.Commit != nil {
+			writeStringToFile(writer, fmt.Sprintf("! Commit ID: %s\n", result.Commit.ID))
+			writeStringToFile(writer, terminal.Banner("commit diff"))
+			writeStringToFile(writer, result.Commit.Diff)
+			writeStringToFile(writer, "\r\n")
+		}
 
 		for _, output := range result.CommandOutputs {
 
 			writeStringToFile(writer, terminal.Banner(output.Command))
+			if output.Failed {
+				writeStringToFile(writer, fmt.Sprintf("! Error:     %s\n", output.Error))
+			}
 			writeStringToFile(writer, output.Output)
 			writeStringToFile(writer, "\r\n")
 		}
 		writer.Flush()
+		file.Close()
 	}
 }
 
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/automatico/jato/internal/logger"
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const hostKeysUsage = `usage: jato hostkeys <scan|list|prune> [flags]
+
+  scan   add the host keys of the inventory's SSH devices,
+         console servers and jump hosts that are not known yet
+  list   list the host keys
+  prune  remove the host keys of hosts not in the inventory
+`
+
+// HostKeys is the interface to the hostkeys subcommand,
+// it manages the known hosts file jato accepts keys into.
+func HostKeys(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, hostKeysUsage)
+		os.Exit(2)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("hostkeys "+action, flag.ExitOnError)
+	userPtr := fs.String("u", os.Getenv("JATO_SSH_USER"), "Username to connect to jump hosts with")
+	devicesPtr := fs.String("d", "devices.json", "Devices inventory file")
+	filePtr := fs.String("f", constant.JatoKnownHostsFile, "Known hosts file")
+	workersPtr := fs.Int("workers", constant.Workers, "Number of devices to scan at once")
+	fs.Parse(args[1:])
+
+	switch action {
+	case "scan":
+		devices := loadHostKeyDevices(*devicesPtr, *userPtr)
+		if *workersPtr < 1 {
+			logger.Fatal("at least 1 worker is required")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		defer driver.CloseJumpHosts()
+
+		for _, s := range scanHostKeys(ctx, devices, *filePtr, *workersPtr) {
+			fmt.Println(s)
+		}
+	case "list":
+		keys, err := driver.ListHostKeys(*filePtr)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+	case "prune":
+		hosts := inventoryHosts(loadHostKeyDevices(*devicesPtr, *userPtr))
+		removed, err := driver.PruneHostKeys(*filePtr, func(host string) bool {
+			// Hashed hosts cannot be matched to the inventory
+			return strings.HasPrefix(host, "|") || hosts[host]
+		})
+		if err != nil {
+			logger.Fatal(err)
+		}
+		for _, k := range removed {
+			fmt.Printf("removed %s\n", k)
+		}
+	default:
+		fmt.Fprint(os.Stderr, hostKeysUsage)
+		os.Exit(2)
+	}
+}
+
+// loadHostKeyDevices loads and initializes the devices of an
+// inventory that are connected to with SSH, with the credentials
+// of their jump hosts.
+func loadHostKeyDevices(fileName, user string) []driver.NetDevice {
+	if err := FileStat(fileName); err != nil {
+		logger.Fatalf("device file does not exist: %v", fileName)
+	}
+	devices := []driver.NetDevice{}
+	for _, d := range LoadDevices(fileName).Devices {
+		d.Credentials = data.GetCredentials(d.Variables.Credentials)
+		if d.Variables.Credentials == "" && user != "" {
+			d.Credentials.Username = user
+		}
+		nd, err := driver.NewDevice(d)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		if len(driver.SSHHosts(nd)) == 0 {
+			continue
+		}
+		devices = append(devices, nd)
+	}
+	return devices
+}
+
+// hostKeyScan is the outcome of scanning a device's host key.
+type hostKeyScan struct {
+	Device string
+	Addr   string
+	Key    ssh.PublicKey
+	Added  bool
+	Err    error
+}
+
+func (s hostKeyScan) String() string {
+	var keyErr *knownhosts.KeyError
+	switch {
+	case errors.As(s.Err, &keyErr):
+		return fmt.Sprintf("%s %s: MISMATCH %s %s is not the known key", s.Device, s.Addr, s.Key.Type(), ssh.FingerprintSHA256(s.Key))
+	case s.Err != nil:
+		return fmt.Sprintf("%s %s: %v", s.Device, s.Addr, s.Err)
+	case s.Added:
+		return fmt.Sprintf("%s %s: added %s %s", s.Device, s.Addr, s.Key.Type(), ssh.FingerprintSHA256(s.Key))
+	}
+	return fmt.Sprintf("%s %s: known %s %s", s.Device, s.Addr, s.Key.Type(), ssh.FingerprintSHA256(s.Key))
+}
+
+// hostKeyTarget is an SSH server to scan the host key of,
+// Device is the first device of the inventory that uses it.
+type hostKeyTarget struct {
+	Device  string
+	Host    driver.SSHHost
+	Timeout int64
+}
+
+// hostKeyTargets returns the SSH servers of devices, each of
+// them once, grouped by the number of jump hosts they are
+// reached through. The servers of a group are only reached
+// through the servers of the groups before it.
+func hostKeyTargets(devices []driver.NetDevice) [][]hostKeyTarget {
+	groups := [][]hostKeyTarget{}
+	seen := make(map[string]bool)
+	for _, nd := range devices {
+		for _, h := range driver.SSHHosts(nd) {
+			addr := knownhosts.Normalize(h.Addr())
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			depth := len(h.JumpHosts)
+			for len(groups) <= depth {
+				groups = append(groups, []hostKeyTarget{})
+			}
+			groups[depth] = append(groups[depth], hostKeyTarget{Device: nd.Name, Host: h, Timeout: nd.Timeout})
+		}
+	}
+	return groups
+}
+
+// scanHostKeys adds the host keys of the SSH servers of devices,
+// their jump hosts included, to a known hosts file, scanning
+// workers servers at once. The jump hosts are scanned before
+// the servers reached through them.
+func scanHostKeys(ctx context.Context, devices []driver.NetDevice, file string, workers int) []hostKeyScan {
+	scans := []hostKeyScan{}
+	for _, targets := range hostKeyTargets(devices) {
+		group := make([]hostKeyScan, len(targets))
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, target hostKeyTarget) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				group[i] = scanHostKey(ctx, target, file)
+			}(i, target)
+		}
+		wg.Wait()
+		scans = append(scans, group...)
+	}
+	return scans
+}
+
+func scanHostKey(ctx context.Context, target hostKeyTarget, file string) hostKeyScan {
+	s := hostKeyScan{
+		Device: target.Device,
+		Addr:   target.Host.Addr(),
+	}
+	if target.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(target.Timeout)*time.Second)
+		defer cancel()
+	}
+	s.Key, s.Err = driver.ScanSSHHostKey(ctx, target.Host)
+	if s.Err != nil {
+		return s
+	}
+	s.Added, s.Err = driver.AddSSHHostKey(file, target.Host, s.Key)
+	return s
+}
+
+// inventoryHosts returns the known hosts names of the SSH
+// servers of devices, their jump hosts included.
+func inventoryHosts(devices []driver.NetDevice) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, nd := range devices {
+		for _, h := range driver.SSHHosts(nd) {
+			hosts[knownhosts.Normalize(h.Addr())] = true
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// Runner runs a job against devices through a bounded pool
+// of workers. VendorLimit and SiteLimit optionally cap the number
+// of devices of the same vendor or site that run at once.
+// A limit of 0 is unlimited.
+type Runner struct {
+	Workers     int
+	VendorLimit int
+	SiteLimit   int
+	// RunFunc runs a job against a single device,
+	// it defaults to driver.Run.
+	RunFunc func(ctx context.Context, nd driver.NetDevice, job driver.Job) data.Result
+}
+
+// Run starts a job and returns a channel that receives the
+// result of each device as soon as it finishes. The channel is
+// closed once every device has finished.
+func (r Runner) Run(ctx context.Context, devices []driver.NetDevice, job driver.Job) <-chan data.Result {
+	results := make(chan data.Result)
+	go r.run(ctx, devices, job, results)
+	return results
+}
+
+func (r Runner) run(ctx context.Context, devices []driver.NetDevice, job driver.Job, results chan<- data.Result) {
+
+	defer close(results)
+
+	runFunc := r.RunFunc
+	if runFunc == nil {
+		runFunc = driver.Run
+	}
+
+	workers := r.Workers
+	if workers <= 0 {
+		workers = len(devices)
+	}
+
+	pending := make([]driver.NetDevice, len(devices))
+	copy(pending, devices)
+
+	running := 0
+	vendors := map[string]int{}
+	sites := map[string]int{}
+	done := make(chan driver.NetDevice)
+
+	for len(pending) > 0 || running > 0 {
+
+		// Start the pending devices that are within the limits
+		for i := 0; i < len(pending) && running < workers; {
+			nd := pending[i]
+			if !r.allowed(nd, vendors, sites) {
+				i++
+				continue
+			}
+			pending = append(pending[:i], pending[i+1:]...)
+			running++
+			vendors[nd.Vendor]++
+			sites[nd.Site]++
+
+			go func(nd driver.NetDevice) {
+				results <- runFunc(ctx, nd, job)
+				done <- nd
+			}(nd)
+		}
+
+		nd := <-done
+		running--
+		vendors[nd.Vendor]--
+		sites[nd.Site]--
+	}
+
+}
+
+// allowed reports whether a device can start
+// without exceeding the vendor and site limits.
+func (r Runner) allowed(nd driver.NetDevice, vendors, sites map[string]int) bool {
+	if r.VendorLimit > 0 && vendors[nd.Vendor] >= r.VendorLimit {
+		return false
+	}
+	if r.SiteLimit > 0 && nd.Site != "" && sites[nd.Site] >= r.SiteLimit {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package core_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/core"
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+func TestRunner(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		runner      core.Runner
+		wantRunning int
+		wantVendor  int
+	}
+	testCases := []testCase{
+		{runner: core.Runner{Workers: 3}, wantRunning: 3, wantVendor: 2},
+		{runner: core.Runner{Workers: 10, VendorLimit: 2}, wantRunning: 4, wantVendor: 2},
+		{runner: core.Runner{Workers: 10, SiteLimit: 1}, wantRunning: 2, wantVendor: 1},
+	}
+
+	devices := []driver.NetDevice{}
+	for i := 0; i < 6; i++ {
+		devices = append(devices,
+			driver.NetDevice{Name: "ios", Vendor: "cisco", Site: "syd"},
+			driver.NetDevice{Name: "eos", Vendor: "arista", Site: "mel"},
+		)
+	}
+
+	for _, tc := range testCases {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		vendors, maxVendor := map[string]int{}, 0
+
+		tc.runner.RunFunc = func(ctx context.Context, nd driver.NetDevice, job driver.Job) data.Result {
+			mu.Lock()
+			running++
+			vendors[nd.Vendor]++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			if vendors[nd.Vendor] > maxVendor {
+				maxVendor = vendors[nd.Vendor]
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			vendors[nd.Vendor]--
+			mu.Unlock()
+			return data.Result{Device: nd.Name, OK: true}
+		}
+
+		got := 0
+		for range tc.runner.Run(context.Background(), devices, driver.Job{}) {
+			got++
+		}
+		if got != len(devices) {
+			t.Errorf("want %d results, got %d", len(devices), got)
+		}
+		if maxRunning != tc.wantRunning {
+			t.Errorf("want %d running at once, got %d", tc.wantRunning, maxRunning)
+		}
+		if maxVendor != tc.wantVendor {
+			t.Errorf("want %d of a vendor running at once, got %d", tc.wantVendor, maxVendor)
+		}
+	}
+
+}
@@ -0,0 +1,7 @@
+package data
+
+// Commands holds the commands
+// of a job to run on devices.
+type Commands struct {
+	Commands []string `json:"commands"`
+}
@@ -0,0 +1,24 @@
+package data
+
+import "os"
+
+// Credentials hold the username, passwords
+// and SSH key file a device is logged in with.
+type Credentials struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	SuperPassword string `json:"superPassword"`
+	SSHKeyFile    string `json:"sshKeyFile"`
+}
+
+// GetCredentials reads the credentials from the JATO_USERNAME,
+// JATO_PASSWORD, JATO_SUPER_PASSWORD and JATO_SSH_KEY_FILE
+// environment variables.
+func GetCredentials(name string) Credentials {
+	return Credentials{
+		Username:      os.Getenv("JATO_USERNAME"),
+		Password:      os.Getenv("JATO_PASSWORD"),
+		SuperPassword: os.Getenv("JATO_SUPER_PASSWORD"),
+		SSHKeyFile:    os.Getenv("JATO_SSH_KEY_FILE"),
+	}
+}
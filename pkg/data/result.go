@@ -0,0 +1,46 @@
+package data
+
+import "encoding/json"
+
+// Result holds the result of
+// a job run against a device.
+// Failure is the class of the
+// error. EG: dial, auth, timeout
+type Result struct {
+	Device         string          `json:"device"`
+	OK             bool            `json:"ok"`
+	Error          error           `json:"error"`
+	Failure        string          `json:"failure,omitempty"`
+	Timestamp      int64           `json:"timestamp"`
+	CommandOutputs []CommandOutput `json:"commandOutputs"`
+	Commit         *Commit         `json:"commit,omitempty"`
+}
+
+// CommandOutput holds the output
+// of a command run against a device.
+// Failed is set when the device reported
+// an error for the command, Error holds
+// the line of output with the error.
+// JSON holds the structured output of
+// connectors that return it. EG: eAPI
+// ExitStatus is the exit status of a
+// command run on an SSH exec channel.
+type CommandOutput struct {
+	Command    string          `json:"command"`
+	CommandU   string          `json:"-"`
+	Output     string          `json:"output"`
+	JSON       json.RawMessage `json:"json,omitempty"`
+	ExitStatus int             `json:"exitStatus,omitempty"`
+	Failed     bool            `json:"failed"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Commit holds the details of a configuration
+// commit on a platform with a candidate configuration
+type Commit struct {
+	ID         string `json:"id"`
+	Comment    string `json:"comment"`
+	Diff       string `json:"diff"`
+	Confirmed  bool   `json:"confirmed"`
+	RolledBack bool   `json:"rolledBack"`
+}
@@ -0,0 +1,6 @@
+package data
+
+// Variables hold the variables of a device.
+type Variables struct {
+	Credentials string `json:"credentials"`
+}
@@ -0,0 +1,263 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSH authentication methods, in the order
+// they are tried by default.
+const (
+	AuthPublicKey           = "publickey"
+	AuthAgent               = "agent"
+	AuthKeyboardInteractive = "keyboard-interactive"
+	AuthPassword            = "password"
+)
+
+// DefaultAuthMethods is the order authentication methods are
+// tried in when a device does not set its own. Methods without
+// credentials are skipped. EG: password without a password
+var DefaultAuthMethods = []string{AuthPublicKey, AuthAgent, AuthKeyboardInteractive, AuthPassword}
+
+var (
+	signersMu sync.Mutex
+	signers   = make(map[string]ssh.Signer)
+)
+
+// authMethods returns the authentication methods for the
+// credentials in the order of the SSH parameters.
+func authMethods(c data.Credentials, s SSHParams) ([]ssh.AuthMethod, error) {
+	order := s.AuthMethods
+	if len(order) == 0 {
+		order = DefaultAuthMethods
+	}
+
+	auth := []ssh.AuthMethod{}
+	publicKeys := false
+	for _, method := range order {
+		switch method {
+		case AuthPublicKey, AuthAgent:
+			// Methods are tried once per name, so the key file
+			// and the agent's keys are offered by a single
+			// publickey method in the order they are listed.
+			if publicKeys {
+				continue
+			}
+			publicKeys = true
+			callback, ok, err := publicKeysCallback(c, s, order)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				auth = append(auth, ssh.PublicKeysCallback(callback))
+			}
+		case AuthKeyboardInteractive:
+			if c.Password != "" {
+				auth = append(auth, ssh.KeyboardInteractive(keyboardInteractive(c)))
+			}
+		case AuthPassword:
+			if c.Password != "" {
+				auth = append(auth, ssh.Password(c.Password))
+			}
+		default:
+			return nil, fmt.Errorf("unknown ssh auth method: %s", method)
+		}
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("an ssh key, ssh agent or password is required")
+	}
+	return auth, nil
+}
+
+// publicKeysCallback returns a callback with the signers of the key
+// file and the ssh agent, in the order they appear in order. ok is
+// false when there is neither a key file nor an agent.
+func publicKeysCallback(c data.Credentials, s SSHParams, order []string) (callback func() ([]ssh.Signer, error), ok bool, err error) {
+	var keySigners []ssh.Signer
+	if c.SSHKeyFile != "" && contains(order, AuthPublicKey) {
+		keySigners, err = keyFileSigners(c.SSHKeyFile, s.CertificateFile)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	useAgent := os.Getenv("SSH_AUTH_SOCK") != "" && contains(order, AuthAgent)
+	if len(keySigners) == 0 && !useAgent {
+		return nil, false, nil
+	}
+
+	return func() ([]ssh.Signer, error) {
+		all := []ssh.Signer{}
+		var agentErr error
+		for _, method := range order {
+			switch method {
+			case AuthPublicKey:
+				all = append(all, keySigners...)
+			case AuthAgent:
+				if !useAgent {
+					continue
+				}
+				var agentKeys []ssh.Signer
+				agentKeys, agentErr = agentSigners()
+				all = append(all, agentKeys...)
+			}
+		}
+		if len(all) == 0 && agentErr != nil {
+			return nil, agentErr
+		}
+		return all, nil
+	}, true, nil
+}
+
+// keyFileSigners returns the signer of a private key file and,
+// when there is a certificate for the key, a certificate signer
+// ahead of it. The certificate defaults to keyFile-cert.pub.
+func keyFileSigners(keyFile, certFile string) ([]ssh.Signer, error) {
+	signer, err := keyFileSigner(keyFile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if certFile == "" {
+		certFile = keyFile + "-cert.pub"
+		if _, err := os.Stat(certFile); err != nil {
+			return []ssh.Signer{signer}, nil
+		}
+	}
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read certificate: %v", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("unable to parse certificate: %s is not a certificate", certFile)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use certificate: %v", err)
+	}
+	return []ssh.Signer{certSigner, signer}, nil
+}
+
+// LoadKeyFile decrypts a private key file before devices connect
+// with it. The passphrase of an encrypted key is read from the
+// JATO_SSH_KEY_PASSPHRASE environment variable or asked for with
+// prompt. Devices only use keys that are loaded or not encrypted,
+// they connect at once and never prompt.
+func LoadKeyFile(keyFile string, prompt func(keyFile string) ([]byte, error)) error {
+	_, err := keyFileSigner(keyFile, prompt)
+	return err
+}
+
+// keyFileSigner parses a private key file, decrypting it with the
+// passphrase from the environment or prompt if needed. Keys are
+// only decrypted once.
+func keyFileSigner(keyFile string, prompt func(keyFile string) ([]byte, error)) (ssh.Signer, error) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	if signer, ok := signers[keyFile]; ok {
+		return signer, nil
+	}
+
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		var passphrase []byte
+		if env := os.Getenv(constant.SSHKeyPassphraseEnv); env != "" {
+			passphrase = []byte(env)
+		} else if prompt != nil {
+			if passphrase, err = prompt(keyFile); err != nil {
+				return nil, fmt.Errorf("unable to read passphrase: %v", err)
+			}
+		} else {
+			return nil, fmt.Errorf("unable to parse private key: %s is encrypted and no passphrase is set", keyFile)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %v", err)
+	}
+
+	signers[keyFile] = signer
+	return signer, nil
+}
+
+var (
+	agentMu     sync.Mutex
+	agentConn   net.Conn
+	agentClient agent.ExtendedAgent
+)
+
+// agentSigners returns the keys of the agent at SSH_AUTH_SOCK.
+// The connection to the agent is shared and made again if the
+// agent fails.
+func agentSigners() ([]ssh.Signer, error) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	if agentClient == nil {
+		conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to ssh agent: %v", err)
+		}
+		agentConn = conn
+		agentClient = agent.NewClient(conn)
+	}
+	s, err := agentClient.Signers()
+	if err != nil {
+		agentConn.Close()
+		agentClient = nil
+		return nil, fmt.Errorf("unable to list ssh agent keys: %v", err)
+	}
+	return s, nil
+}
+
+var (
+	kiUsernameRE = regexp.MustCompile(`(?i)user(name)?|login`)
+	kiPasswordRE = regexp.MustCompile(`(?i)pass(word|code)?`)
+)
+
+// keyboardInteractive answers the questions of a keyboard-interactive
+// login, EG: from a TACACS+ backed device, with the credentials.
+func keyboardInteractive(c data.Credentials) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, q := range questions {
+			switch {
+			case kiPasswordRE.MatchString(q):
+				answers[i] = c.Password
+			case kiUsernameRE.MatchString(q):
+				answers[i] = c.Username
+			case !echos[i]:
+				answers[i] = c.Password
+			}
+		}
+		return answers, nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package driver_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// writeKey writes an ed25519 private key to a file in dir.
+func writeKey(t *testing.T, dir string) (string, ed25519.PrivateKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyFile, priv
+}
+
+// writeEncryptedKey writes an ECDSA private key encrypted
+// with passphrase to a file in dir.
+func writeEncryptedKey(t *testing.T, dir, passphrase string) (string, *ecdsa.PrivateKey) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Legacy PEM encryption, as used by older keys
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", b, []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyFile, priv
+}
+
+// publicKeyServer starts a fakeSSHServer that accepts a public key.
+func publicKeyServer(t *testing.T, key interface{}) *fakeSSHServer {
+	t.Helper()
+	pub, err := ssh.NewPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(k.Marshal(), pub.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	return newFakeSSHServerConfig(t, config, "\r\nrouter#", iosShell)
+}
+
+func connect(creds data.Credentials, params driver.SSHParams, port int) error {
+	params.InsecureConnection = true
+	clientConfig, err := driver.SSHClientConfig(creds, params)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := driver.ConnectWithSSH(ctx, "127.0.0.1", port, clientConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestSSHClientConfigAuthMethods(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	keyFile, _ := writeKey(t, t.TempDir())
+
+	type testCase struct {
+		creds    data.Credentials
+		methods  []string
+		wantAuth int
+		wantErr  bool
+	}
+	testCases := []testCase{
+		{creds: data.Credentials{Password: "cisco"}, wantAuth: 2},
+		{creds: data.Credentials{SSHKeyFile: keyFile}, wantAuth: 1},
+		{creds: data.Credentials{SSHKeyFile: keyFile, Password: "cisco"}, wantAuth: 3},
+		{creds: data.Credentials{SSHKeyFile: keyFile, Password: "cisco"}, methods: []string{driver.AuthPassword}, wantAuth: 1},
+		{creds: data.Credentials{SSHKeyFile: keyFile}, methods: []string{driver.AuthPassword}, wantErr: true},
+		{creds: data.Credentials{Password: "cisco"}, methods: []string{"gssapi"}, wantErr: true},
+		{creds: data.Credentials{}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		conf, err := driver.SSHClientConfig(tc.creds, driver.SSHParams{AuthMethods: tc.methods, InsecureConnection: true})
+		if tc.wantErr != (err != nil) {
+			t.Errorf("%+v %v: want error %t, got %v", tc.creds, tc.methods, tc.wantErr, err)
+			continue
+		}
+		if err == nil && len(conf.Auth) != tc.wantAuth {
+			t.Errorf("%+v %v: want %d auth methods, got %d", tc.creds, tc.methods, tc.wantAuth, len(conf.Auth))
+		}
+	}
+}
+
+func TestConnectWithSSHEncryptedKey(t *testing.T) {
+	dir := t.TempDir()
+
+	// Passphrase from the environment
+	keyFile, key := writeEncryptedKey(t, dir, "secret")
+	fs := publicKeyServer(t, &key.PublicKey)
+	t.Setenv(constant.SSHKeyPassphraseEnv, "secret")
+	if err := connect(data.Credentials{Username: "admin", SSHKeyFile: keyFile}, driver.SSHParams{}, fs.port()); err != nil {
+		t.Errorf("env passphrase: %v", err)
+	}
+
+	// Devices do not prompt for the passphrase of a key
+	t.Setenv(constant.SSHKeyPassphraseEnv, "")
+	keyFile, key = writeEncryptedKey(t, t.TempDir(), "prompted")
+	fs = publicKeyServer(t, &key.PublicKey)
+	if err := connect(data.Credentials{Username: "admin", SSHKeyFile: keyFile}, driver.SSHParams{}, fs.port()); err == nil {
+		t.Error("key not loaded: want an error, got nil")
+	}
+
+	// Prompted passphrase, asked for once when the key is loaded
+	prompts := 0
+	prompt := func(string) ([]byte, error) {
+		prompts++
+		return []byte("prompted"), nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := driver.LoadKeyFile(keyFile, prompt); err != nil {
+			t.Fatal(err)
+		}
+		if err := connect(data.Credentials{Username: "admin", SSHKeyFile: keyFile}, driver.SSHParams{}, fs.port()); err != nil {
+			t.Errorf("prompted passphrase: %v", err)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("want 1 passphrase prompt, got %d", prompts)
+	}
+}
+
+func TestConnectWithSSHAgent(t *testing.T) {
+	_, key := writeKey(t, t.TempDir())
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	fs := publicKeyServer(t, key.Public())
+	if err := connect(data.Credentials{Username: "admin"}, driver.SSHParams{}, fs.port()); err != nil {
+		t.Errorf("agent: %v", err)
+	}
+}
+
+func TestConnectWithSSHCertificate(t *testing.T) {
+	t.Parallel()
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, key := writeKey(t, t.TempDir())
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		KeyId:           "jato",
+		ValidPrincipals: []string{"admin"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+		},
+	}
+	fs := newFakeSSHServerConfig(t, &ssh.ServerConfig{PublicKeyCallback: checker.Authenticate}, "\r\nrouter#", iosShell)
+
+	params := driver.SSHParams{AuthMethods: []string{driver.AuthPublicKey}}
+	if err := connect(data.Credentials{Username: "admin", SSHKeyFile: keyFile}, params, fs.port()); err != nil {
+		t.Errorf("certificate: %v", err)
+	}
+}
+
+func TestConnectWithSSHKeyboardInteractive(t *testing.T) {
+	t.Parallel()
+	config := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "TACACS+", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if c.User() == "admin" && len(answers) == 1 && answers[0] == "cisco" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	fs := newFakeSSHServerConfig(t, config, "\r\nrouter#", iosShell)
+
+	if err := connect(data.Credentials{Username: "admin", Password: "cisco"}, driver.SSHParams{}, fs.port()); err != nil {
+		t.Errorf("keyboard-interactive: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Checksummer is implemented by drivers of platforms
+// that compute the checksum of a file on the device.
+type Checksummer interface {
+	ChecksumCommand() ChecksumCommand
+}
+
+// ChecksumCommand holds the command that computes the MD5
+// checksum of a file on the device. {file} is replaced in Command.
+// EG: verify /md5 {file}
+type ChecksumCommand struct {
+	Command string `json:"command" yaml:"command"`
+	// The first group of Pattern captures the checksum
+	// in the command's output.
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// Timeout in seconds for the command, checksums
+	// of large images take a while.
+	Timeout int64 `json:"timeout" yaml:"timeout"`
+}
+
+// checksummer returns the device's checksum command and
+// whether the device's platform computes checksums.
+func checksummer(d *NetDevice) (ChecksumCommand, bool) {
+	drv, err := d.driver()
+	if err != nil {
+		return ChecksumCommand{}, false
+	}
+	c, ok := drv.(Checksummer)
+	if !ok || c.ChecksumCommand().Command == "" {
+		return ChecksumCommand{}, false
+	}
+	cc := c.ChecksumCommand()
+	if cc.Timeout == 0 {
+		cc.Timeout = 120
+	}
+	return cc, true
+}
+
+// remoteChecksum runs the platform's checksum
+// command and returns the MD5 checksum of a file.
+func remoteChecksum(ctx context.Context, d *NetDevice, file string, send sendFunc) (string, error) {
+	cc, ok := checksummer(d)
+	if !ok {
+		return "", notSupported(d, "checksum")
+	}
+	re, err := regexp.Compile(cc.Pattern)
+	if err != nil {
+		return "", fmt.Errorf("checksum pattern: %v", err)
+	}
+
+	cmd := strings.ReplaceAll(cc.Command, "{file}", file)
+	cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(cc.Timeout)*time.Second)
+	defer cancel()
+	out, err := send(cmdCtx, cmd, anyPromptRE(d))
+	if err != nil {
+		return "", fmt.Errorf("checksum: %w", err)
+	}
+
+	m := re.FindStringSubmatch(out)
+	if len(m) < 2 {
+		return "", fmt.Errorf("checksum: no checksum in the output of '%s': %s", cmd, strings.TrimSpace(out))
+	}
+	return strings.ToLower(m[1]), nil
+}
+
+// fileMD5 returns the MD5 checksum of a local file.
+func fileMD5(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,281 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// Committer is implemented by drivers of platforms that stage
+// configuration in a candidate configuration which is committed.
+type Committer interface {
+	// CommitCommands returns the commands of the commit
+	// workflow. A Commit of "" means the platform does not
+	// use a candidate configuration.
+	CommitCommands() CommitCommands
+}
+
+// CommitCommands holds the commands of a commit workflow.
+// {minutes} and {comment} are replaced in Confirmed and Comment.
+type CommitCommands struct {
+	// Diff, Check, Commit, Confirmed and Confirm
+	// are sent in configuration mode.
+	Diff      string `json:"diff" yaml:"diff"`
+	Check     string `json:"check" yaml:"check"`
+	Commit    string `json:"commit" yaml:"commit"`
+	Confirmed string `json:"confirmed" yaml:"confirmed"`
+	Comment   string `json:"comment" yaml:"comment"`
+	Confirm   string `json:"confirm" yaml:"confirm"`
+	// Discard is sent in configuration mode to discard the
+	// candidate and must return to the super user prompt.
+	Discard []string `json:"discard" yaml:"discard"`
+	// Rollback is sent from the super user prompt to roll
+	// back to the previous commit and must return to it.
+	Rollback []string `json:"rollback" yaml:"rollback"`
+	// ID is sent from the super user prompt, the first
+	// group of IDPattern captures the last commit's ID.
+	ID        string `json:"id" yaml:"id"`
+	IDPattern string `json:"idPattern" yaml:"idPattern"`
+	// Timeout in seconds for the commit commands.
+	Timeout int64 `json:"timeout" yaml:"timeout"`
+}
+
+// CommitOptions controls how configuration is committed
+// on platforms with a candidate configuration.
+type CommitOptions struct {
+	// Check validates the candidate before it is committed.
+	Check bool
+	// Confirmed is the number of minutes after which a commit is
+	// rolled back unless it is confirmed. The commit is confirmed
+	// when the job's commands run without error. 0 commits
+	// without confirmation.
+	Confirmed int
+	Comment   string
+}
+
+// committer returns the device's commit commands and
+// whether the device's platform commits configuration.
+func committer(d *NetDevice) (CommitCommands, bool) {
+	drv, err := d.driver()
+	if err != nil {
+		return CommitCommands{}, false
+	}
+	c, ok := drv.(Committer)
+	if !ok || c.CommitCommands().Commit == "" {
+		return CommitCommands{}, false
+	}
+	cc := c.CommitCommands()
+	if cc.Timeout == 0 {
+		cc.Timeout = 60
+	}
+	return cc, true
+}
+
+// promptsRE matches the user, super user and config prompts.
+func promptsRE(d *NetDevice) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?:%s)|(?:%s)`, anyPromptRE(d), d.ConfigPromtRE))
+}
+
+// commitConfigSet enters configuration mode, sends each line and
+// commits the candidate configuration. The candidate is discarded
+// when a line, the commit check or the commit fails.
+func commitConfigSet(ctx context.Context, d *NetDevice, lines []string, opts CommitOptions, send sendFunc) (*data.Commit, []data.CommandOutput, error) {
+
+	commit := &data.Commit{Comment: opts.Comment}
+	cmdOut := []data.CommandOutput{}
+
+	cc, ok := committer(d)
+	if !ok {
+		return commit, cmdOut, notSupported(d, "commit")
+	}
+	drv, _ := d.driver()
+	enter, exit := drv.(Configurer).ConfigCommands()
+	var patterns []*regexp.Regexp
+	if m, ok := drv.(ErrorMatcher); ok {
+		patterns = m.ErrorPatterns()
+	}
+
+	sendLine := func(line string, expect *regexp.Regexp, timeout int64) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+		return send(ctx, line, expect)
+	}
+	discard := func(cause error) error {
+		for _, line := range cc.Discard {
+			if _, err := sendLine(line, promptsRE(d), d.Timeout); err != nil {
+				return fmt.Errorf("%v, unable to discard the candidate configuration: %v", cause, err)
+			}
+		}
+		return cause
+	}
+
+	out, err := sendLine(enter, d.ConfigPromtRE, d.Timeout)
+	if err != nil {
+		return commit, cmdOut, fmt.Errorf("unable to enter configuration mode: %w", err)
+	}
+	if msg, ok := matchError(patterns, out); ok {
+		return commit, cmdOut, fmt.Errorf("unable to enter configuration mode: %s", msg)
+	}
+
+	configErr := &ConfigError{}
+	for _, line := range lines {
+		out, err := sendLine(line, d.ConfigPromtRE, d.Timeout)
+		if err != nil {
+			return commit, cmdOut, err
+		}
+		cmdOut = append(cmdOut, data.CommandOutput{
+			Command:  line,
+			CommandU: util.Underscorer(line),
+			Output:   util.TruncateOutput(out),
+		})
+		if msg, ok := matchError(patterns, out); ok {
+			cmdOut[len(cmdOut)-1].Failed = true
+			cmdOut[len(cmdOut)-1].Error = msg
+			configErr.Lines = append(configErr.Lines, ConfigLineError{Line: line, Message: msg})
+		}
+	}
+	if len(configErr.Lines) > 0 {
+		return commit, cmdOut, discard(configErr)
+	}
+
+	if cc.Diff != "" {
+		out, err := sendLine(cc.Diff, d.ConfigPromtRE, cc.Timeout)
+		if err != nil {
+			return commit, cmdOut, err
+		}
+		commit.Diff = util.TruncateOutput(out)
+	}
+
+	if opts.Check {
+		if cc.Check == "" {
+			return commit, cmdOut, discard(notSupported(d, "commit check"))
+		}
+		out, err := sendLine(cc.Check, d.ConfigPromtRE, cc.Timeout)
+		if err != nil {
+			return commit, cmdOut, err
+		}
+		if msg, ok := matchError(patterns, out); ok {
+			return commit, cmdOut, discard(fmt.Errorf("commit check failed: %s", msg))
+		}
+	}
+
+	r := strings.NewReplacer("{minutes}", strconv.Itoa(opts.Confirmed), "{comment}", opts.Comment)
+	commitCmd := cc.Commit
+	if opts.Confirmed > 0 {
+		if cc.Confirmed == "" {
+			return commit, cmdOut, discard(notSupported(d, "commit confirmed"))
+		}
+		commitCmd = r.Replace(cc.Confirmed)
+	}
+	if opts.Comment != "" && cc.Comment != "" {
+		commitCmd = fmt.Sprintf("%s %s", commitCmd, r.Replace(cc.Comment))
+	}
+	out, err = sendLine(commitCmd, d.ConfigPromtRE, cc.Timeout)
+	if err != nil {
+		return commit, cmdOut, err
+	}
+	if msg, ok := matchError(patterns, out); ok {
+		return commit, cmdOut, discard(fmt.Errorf("commit failed: %s", msg))
+	}
+
+	out, err = sendLine(exit, d.SuperUserPromptRE, d.Timeout)
+	if err != nil {
+		return commit, cmdOut, fmt.Errorf("unable to exit configuration mode: %w", err)
+	}
+	if d.ConfigPromtRE.MatchString(lastLine(out)) {
+		return commit, cmdOut, fmt.Errorf("unable to exit configuration mode: %s", strings.TrimSpace(out))
+	}
+
+	if cc.ID != "" && cc.IDPattern != "" {
+		out, err := sendLine(cc.ID, d.SuperUserPromptRE, d.Timeout)
+		if err != nil {
+			return commit, cmdOut, err
+		}
+		if m := regexp.MustCompile(cc.IDPattern).FindStringSubmatch(out); len(m) > 1 {
+			commit.ID = m[1]
+		}
+	}
+
+	return commit, cmdOut, nil
+}
+
+// confirmCommit confirms a commit confirmed.
+func confirmCommit(ctx context.Context, d *NetDevice, send sendFunc) error {
+	cc, ok := committer(d)
+	if !ok {
+		return notSupported(d, "commit")
+	}
+	drv, _ := d.driver()
+	enter, exit := drv.(Configurer).ConfigCommands()
+	var patterns []*regexp.Regexp
+	if m, ok := drv.(ErrorMatcher); ok {
+		patterns = m.ErrorPatterns()
+	}
+
+	steps := []struct {
+		cmd    string
+		expect *regexp.Regexp
+	}{
+		{cmd: enter, expect: d.ConfigPromtRE},
+		{cmd: cc.Confirm, expect: d.ConfigPromtRE},
+		{cmd: exit, expect: d.SuperUserPromptRE},
+	}
+	for _, step := range steps {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(cc.Timeout)*time.Second)
+		out, err := send(ctx, step.cmd, step.expect)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("unable to confirm commit: %w", err)
+		}
+		if msg, ok := matchError(patterns, out); ok {
+			return fmt.Errorf("unable to confirm commit: %s", msg)
+		}
+	}
+	return nil
+}
+
+// rollbackCommit rolls back to the previous commit.
+func rollbackCommit(ctx context.Context, d *NetDevice, send sendFunc) error {
+	cc, ok := committer(d)
+	if !ok {
+		return notSupported(d, "commit")
+	}
+	drv, _ := d.driver()
+	var patterns []*regexp.Regexp
+	if m, ok := drv.(ErrorMatcher); ok {
+		patterns = m.ErrorPatterns()
+	}
+
+	for _, line := range cc.Rollback {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(cc.Timeout)*time.Second)
+		out, err := send(ctx, line, promptsRE(d))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("unable to roll back: %w", err)
+		}
+		if msg, ok := matchError(patterns, out); ok {
+			return fmt.Errorf("unable to roll back: %s", msg)
+		}
+	}
+	return nil
+}
+
+// CommitConfigSet sends configuration lines to the device and
+// commits them with the device's connector. Use it in place of
+// SendConfigSet on platforms with a candidate configuration.
+func (d NetDevice) CommitConfigSet(ctx context.Context, lines []string, opts CommitOptions) data.Result {
+	send := d.sendSSH
+	if d.Connector == "telnet" {
+		send = d.sendTelnet
+	}
+	commit, cmdOut, err := commitConfigSet(ctx, &d, lines, opts, send)
+	result := newResult(d.Name, cmdOut, err)
+	result.Commit = commit
+	return result
+}
@@ -0,0 +1,183 @@
+package driver_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// commitDefinition is a Junos like platform that supports Telnet.
+const commitDefinition = `
+vendor: test
+platform: commit
+connectors:
+  - telnet
+prompts:
+  user: '(?im)[a-z0-9.\-_@()/:]{1,63}>\s$'
+  superUser: '(?im)[a-z0-9.\-_@()/:]{1,63}>\s$'
+  config: '(?im)(\[edit\]\n){0,1}[a-z0-9.\-_@()/:]{1,63}#\s?$'
+config:
+  enter: configure
+  exit: exit configuration-mode
+commit:
+  diff: show | compare
+  check: commit check
+  commit: commit
+  confirmed: commit confirmed {minutes}
+  comment: comment "{comment}"
+  confirm: commit
+  discard:
+    - rollback 0
+    - exit configuration-mode
+  rollback:
+    - configure
+    - rollback 1
+    - commit
+    - exit configuration-mode
+  id: show system commit include-configuration-revision
+  idPattern: '(?m)^0\s.*\s(\S+-\d+-\d+)\s*$'
+errorPatterns:
+  - 'syntax error'
+  - '(?m)^error: '
+`
+
+func init() {
+	def, err := driver.ParseDefinition("commit.yaml", []byte(commitDefinition))
+	if err != nil {
+		panic(err)
+	}
+	drv, err := driver.NewDefinitionDriver(def)
+	if err != nil {
+		panic(err)
+	}
+	driver.Register(drv.Name(), drv)
+}
+
+// junosCommit answers a Telnet login to a Junos like device
+// and the commit workflow. It records the lines it receives.
+type junosCommit struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (j *junosCommit) respond(line string) string {
+	j.mu.Lock()
+	j.lines = append(j.lines, line)
+	j.mu.Unlock()
+
+	switch {
+	case line == "admin":
+		return "\r\nPassword:"
+	case line == "configure", line == "rollback 1", line == "rollback 0":
+		return "\r\n[edit]\r\nadmin@r1# "
+	case strings.HasPrefix(line, "set bogus"), line == "show bogus":
+		return "\r\n  syntax error.\r\n[edit]\r\nadmin@r1# "
+	case strings.HasPrefix(line, "set "):
+		return "\r\n[edit]\r\nadmin@r1# "
+	case line == "show | compare":
+		return "\r\n[edit system]\r\n-  host-name r0;\r\n+  host-name r1;\r\n[edit]\r\nadmin@r1# "
+	case strings.HasPrefix(line, "commit"):
+		return "\r\ncommit complete\r\n[edit]\r\nadmin@r1# "
+	case line == "show system commit include-configuration-revision":
+		return "\r\n0   2026-10-18 10:00:00 UTC by admin via cli re0-1792317600-42\r\n" +
+			"1   2026-10-17 09:00:00 UTC by admin via cli re0-1792227600-41\r\n\r\nadmin@r1> "
+	case line == "show version bogus":
+		return "\r\nerror: syntax error, expecting <command>.\r\n\r\nadmin@r1> "
+	}
+	return "\r\nadmin@r1> "
+}
+
+func (j *junosCommit) received(line string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, l := range j.lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunJobWithCommit(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		job            driver.Job
+		wantOK         bool
+		wantCommitted  bool
+		wantConfirmed  bool
+		wantRolledBack bool
+		wantReceived   []string
+	}
+	testCases := []testCase{
+		{
+			job: driver.Job{
+				Config:   []string{"set system host-name r1"},
+				Commands: []string{"show version"},
+				Commit:   driver.CommitOptions{Check: true, Confirmed: 5, Comment: "jato"},
+			},
+			wantOK:        true,
+			wantCommitted: true,
+			wantConfirmed: true,
+			wantReceived:  []string{"commit check", `commit confirmed 5 comment "jato"`, "commit"},
+		},
+		{
+			job: driver.Job{
+				Config:   []string{"set system host-name r1"},
+				Commands: []string{"show version bogus"},
+				Commit:   driver.CommitOptions{Confirmed: 5},
+			},
+			wantCommitted:  true,
+			wantRolledBack: true,
+			wantReceived:   []string{"commit confirmed 5", "rollback 1"},
+		},
+		{
+			job: driver.Job{
+				Config: []string{"set bogus"},
+			},
+			wantReceived: []string{"rollback 0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		jc := &junosCommit{}
+		fd := newFakeDevice(t, "\r\nlogin: ", jc.respond)
+
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: "vmx-1", IP: "127.0.0.1", Vendor: "test", Platform: "commit", Connector: "telnet",
+			TelnetParams: driver.TelnetParams{Port: fd.port()},
+			Credentials:  data.Credentials{Username: "admin", Password: "juniper"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := driver.RunWithTelnet(context.Background(), d, tc.job)
+		if result.Commit == nil {
+			t.Fatalf("%v: want a commit, got %v", tc.job.Config, result.Error)
+		}
+		if result.OK != tc.wantOK {
+			t.Errorf("%v: want ok %t, got %t: %v", tc.job.Config, tc.wantOK, result.OK, result.Error)
+		}
+		if result.Commit.Confirmed != tc.wantConfirmed {
+			t.Errorf("%v: want confirmed %t, got %t", tc.job.Config, tc.wantConfirmed, result.Commit.Confirmed)
+		}
+		if result.Commit.RolledBack != tc.wantRolledBack {
+			t.Errorf("%v: want rolled back %t, got %t", tc.job.Config, tc.wantRolledBack, result.Commit.RolledBack)
+		}
+		if tc.wantCommitted && result.Commit.ID != "re0-1792317600-42" {
+			t.Errorf("%v: want commit id re0-1792317600-42, got %q", tc.job.Config, result.Commit.ID)
+		}
+		if tc.wantCommitted && !strings.Contains(result.Commit.Diff, "+  host-name r1;") {
+			t.Errorf("%v: want the diff, got %q", tc.job.Config, result.Commit.Diff)
+		}
+		for _, line := range tc.wantReceived {
+			if !jc.received(line) {
+				t.Errorf("%v: want %q sent", tc.job.Config, line)
+			}
+		}
+	}
+}
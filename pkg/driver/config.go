@@ -0,0 +1,181 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// Configurer is implemented by drivers of platforms
+// that have a configuration mode.
+type Configurer interface {
+	// ConfigCommands returns the commands that enter and exit
+	// configuration mode. EG: configure terminal and end
+	ConfigCommands() (enter, exit string)
+}
+
+// ErrorMatcher is implemented by drivers that can identify
+// an error reported by a device in a command's output.
+type ErrorMatcher interface {
+	ErrorPatterns() []*regexp.Regexp
+}
+
+// ConfigLineError holds the error a device
+// reported for a configuration line.
+type ConfigLineError struct {
+	Line    string
+	Message string
+}
+
+// ConfigError is returned when a device reports
+// errors for one or more configuration lines.
+type ConfigError struct {
+	Lines []ConfigLineError
+}
+
+func (e *ConfigError) Error() string {
+	msgs := []string{}
+	for _, l := range e.Lines {
+		msgs = append(msgs, fmt.Sprintf("'%s': %s", l.Line, l.Message))
+	}
+	return fmt.Sprintf("configuration errors: %s", strings.Join(msgs, ", "))
+}
+
+// matchError returns the line of output that matches
+// the first of the patterns to match.
+func matchError(patterns []*regexp.Regexp, out string) (string, bool) {
+	for _, re := range patterns {
+		loc := re.FindStringIndex(out)
+		if loc == nil {
+			continue
+		}
+		start := strings.LastIndex(out[:loc[0]], "\n") + 1
+		end := strings.Index(out[loc[0]:], "\n")
+		if end == -1 {
+			end = len(out)
+		} else {
+			end += loc[0]
+		}
+		return strings.TrimSpace(out[start:end]), true
+	}
+	return "", false
+}
+
+// sendConfigSet enters configuration mode, sends each line and
+// returns to the super user prompt. Every line is sent even when
+// the device reports an error for a line, the errors are returned
+// in a *ConfigError.
+func sendConfigSet(ctx context.Context, d *NetDevice, lines []string, send sendFunc) ([]data.CommandOutput, error) {
+
+	cmdOut := []data.CommandOutput{}
+
+	drv, err := d.driver()
+	if err != nil {
+		return cmdOut, err
+	}
+	configurer, ok := drv.(Configurer)
+	if !ok {
+		return cmdOut, notSupported(d, "config")
+	}
+	enter, exit := configurer.ConfigCommands()
+	if enter == "" {
+		return cmdOut, notSupported(d, "config")
+	}
+	var patterns []*regexp.Regexp
+	if m, ok := drv.(ErrorMatcher); ok {
+		patterns = m.ErrorPatterns()
+	}
+
+	sendLine := func(line string, expect *regexp.Regexp) (string, error) {
+		ctx, cancel := d.commandContext(ctx)
+		defer cancel()
+		return send(ctx, line, expect)
+	}
+
+	out, err := sendLine(enter, d.ConfigPromtRE)
+	if err != nil {
+		return cmdOut, fmt.Errorf("unable to enter configuration mode: %w", err)
+	}
+	if msg, ok := matchError(patterns, out); ok {
+		return cmdOut, fmt.Errorf("unable to enter configuration mode: %s", msg)
+	}
+
+	configErr := &ConfigError{}
+	for _, line := range lines {
+		out, err := sendLine(line, d.ConfigPromtRE)
+		if err != nil {
+			return cmdOut, err
+		}
+		cmdOut = append(cmdOut, data.CommandOutput{
+			Command:  line,
+			CommandU: util.Underscorer(line),
+			Output:   util.TruncateOutput(out),
+		})
+		if msg, ok := matchError(patterns, out); ok {
+			cmdOut[len(cmdOut)-1].Failed = true
+			cmdOut[len(cmdOut)-1].Error = msg
+			configErr.Lines = append(configErr.Lines, ConfigLineError{Line: line, Message: msg})
+		}
+	}
+
+	out, err = sendLine(exit, d.SuperUserPromptRE)
+	if err != nil {
+		return cmdOut, fmt.Errorf("unable to exit configuration mode: %w", err)
+	}
+	if d.ConfigPromtRE.MatchString(lastLine(out)) {
+		return cmdOut, fmt.Errorf("unable to exit configuration mode: %s", strings.TrimSpace(out))
+	}
+
+	if len(configErr.Lines) > 0 {
+		return cmdOut, configErr
+	}
+	return cmdOut, nil
+}
+
+// SendConfigSet sends configuration lines to the
+// device with its connector.
+func (d NetDevice) SendConfigSet(ctx context.Context, lines []string) data.Result {
+	switch d.Connector {
+	case "telnet":
+		return d.SendConfigSetWithTelnet(ctx, lines)
+	default:
+		return d.SendConfigSetWithSSH(ctx, lines)
+	}
+}
+
+// SendConfigSetWithSSH sends configuration lines to the device.
+// The device's timeout applies to each line.
+func (d NetDevice) SendConfigSetWithSSH(ctx context.Context, lines []string) data.Result {
+	cmdOut, err := sendConfigSet(ctx, &d, lines, d.sendSSH)
+	return newResult(d.Name, cmdOut, err)
+}
+
+// SendConfigSetWithTelnet sends configuration lines to the device.
+// The device's timeout applies to each line.
+func (d NetDevice) SendConfigSetWithTelnet(ctx context.Context, lines []string) data.Result {
+	cmdOut, err := sendConfigSet(ctx, &d, lines, d.sendTelnet)
+	return newResult(d.Name, cmdOut, err)
+}
+
+// newResult returns the result of a device's command outputs and error.
+func newResult(device string, cmdOut []data.CommandOutput, err error) data.Result {
+	result := data.Result{}
+
+	result.Device = device
+	result.Timestamp = time.Now().Unix()
+	result.CommandOutputs = cmdOut
+
+	if err != nil {
+		result.OK = false
+		result.Error = err
+		return result
+	}
+
+	result.OK = true
+	return result
+}
@@ -0,0 +1,70 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// iosConfig answers a Telnet login to a Cisco IOS super user
+// prompt and the configuration mode commands.
+func iosConfig() func(line string) string {
+	mode := ""
+	return func(line string) string {
+		switch {
+		case line == "admin":
+			return "\r\nPassword:"
+		case line == "configure terminal":
+			mode = "(config)"
+		case line == "end":
+			mode = ""
+		case strings.HasPrefix(line, "interface"):
+			mode = "(config-if)"
+		case strings.HasPrefix(line, "bogus"):
+			return "\r\n  bogus\r\n  ^\r\n% Invalid input detected at '^' marker.\r\n\r\nrouter" + mode + "#"
+		}
+		return "\r\nrouter" + mode + "#"
+	}
+}
+
+func TestSendConfigSetWithTelnet(t *testing.T) {
+	t.Parallel()
+	fd := newFakeDevice(t, "\r\nUsername: ", iosConfig())
+
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+		TelnetParams: driver.TelnetParams{Port: fd.port()},
+		Credentials:  data.Credentials{Username: "admin", Password: "cisco"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectWithTelnet(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer d.DisconnectTelnet()
+
+	result := d.SendConfigSet(context.Background(), []string{"interface Loopback100", " description jato"})
+	if !result.OK || len(result.CommandOutputs) != 2 {
+		t.Errorf("want 2 lines sent without error, got %d: %v", len(result.CommandOutputs), result.Error)
+	}
+
+	result = d.SendConfigSet(context.Background(), []string{"bogus 1", "interface Loopback100", "bogus 2"})
+	var configErr *driver.ConfigError
+	if !errors.As(result.Error, &configErr) {
+		t.Fatalf("want a config error, got %v", result.Error)
+	}
+	if len(configErr.Lines) != 2 || configErr.Lines[1].Line != "bogus 2" {
+		t.Errorf("want errors for 2 lines, got %+v", configErr.Lines)
+	}
+	if want := "% Invalid input detected at '^' marker."; configErr.Lines[0].Message != want {
+		t.Errorf("want message %q, got %q", want, configErr.Lines[0].Message)
+	}
+	if len(result.CommandOutputs) != 3 {
+		t.Errorf("want 3 lines sent, got %d", len(result.CommandOutputs))
+	}
+}
@@ -0,0 +1,287 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// ConsoleParams describe the console server port a device's
+// console is reached through. EG: reverse Telnet to port 2001
+type ConsoleParams struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Protocol is telnet or ssh, telnet when empty.
+	Protocol string `json:"protocol"`
+	// Line is appended to the username an SSH console server
+	// is logged in to with to select the port. EG: port05
+	// logs in as user:port05
+	Line string `json:"line"`
+	// Credentials names the credentials to log in to an SSH
+	// console server with, the device's are used when empty.
+	Credentials        string `json:"credentials"`
+	KnownHostsFile     string `json:"knownHostsFile"`
+	InsecureConnection bool   `json:"insecureConnection"`
+	HostKeyPolicy      string `json:"hostKeyPolicy"`
+	// Proxy is the URL of a SOCKS5 or HTTP CONNECT proxy
+	// the console server is reached through.
+	Proxy string `json:"proxy"`
+}
+
+// InitConsoleParams sets the defaults of the console parameters.
+func InitConsoleParams(c *ConsoleParams) {
+	if c.Protocol == "" {
+		c.Protocol = "telnet"
+	}
+	if c.Port == 0 && c.Protocol == "ssh" {
+		c.Port = constant.SSHPort
+	}
+}
+
+// ErrROMMON is returned when a console is at a ROM monitor or
+// boot loader prompt, where commands cannot be run.
+var ErrROMMON = errors.New("device is in ROMMON")
+
+var (
+	// romMonRE matches ROM monitor and boot loader prompts.
+	romMonRE = regexp.MustCompile(`(?im)^(rommon \d+ ?>|switch:|loader>)\s?$`)
+	// setupDialogRE matches the questions of a setup dialog.
+	// EG: Would you like to enter the initial configuration dialog? [yes/no]:
+	setupDialogRE = regexp.MustCompile(`(?im)\[yes/no\]:?\s?$`)
+)
+
+// consoleWakes is the number of times a quiet line is woken
+// with an empty line before connecting is abandoned.
+const consoleWakes = 3
+
+// consoleSteps limits the prompts answered to reach the
+// privileged prompt, a device that keeps asking is stuck.
+const consoleSteps = 10
+
+// ConnectDeviceWithConsole connects to a device's console through
+// a console server with Telnet or SSH. The line is woken and the
+// session it was left in, at a login, user, privileged or config
+// prompt, is brought to the privileged prompt before the driver's
+// session commands are sent.
+func ConnectDeviceWithConsole(ctx context.Context, d *NetDevice, drv Driver) error {
+	if err := dialConsole(ctx, d); err != nil {
+		return err
+	}
+	// A pager left on the line by an earlier session is
+	// quit rather than paged through, reads do not page
+	read := func(ctx context.Context, expect *regexp.Regexp) (string, error) {
+		return ReadTelnet(ctx, d.TelnetConn.StdOut, d.TelnetConn.Conn, expect, nil)
+	}
+	write, send := d.writeTelnet, d.sendTelnet
+	if d.ConsoleParams.Protocol == "ssh" {
+		read = func(ctx context.Context, expect *regexp.Regexp) (string, error) {
+			return ReadSSH(ctx, d.SSHConn.StdOut, d.SSHConn.StdIn, expect, nil)
+		}
+		write, send = d.writeSSH, d.sendSSH
+	}
+
+	out, err := privilegedPrompt(ctx, d, drv, read, write)
+	if err == nil {
+		err = enable(ctx, d, drv, out, send)
+	}
+	if err == nil {
+		err = sendSessionCommands(ctx, d, drv, send)
+	}
+	if err != nil {
+		d.DisconnectConsole()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// dialConsole connects to a device's console server with the
+// protocol of its console parameters, the line is not woken.
+func dialConsole(ctx context.Context, d *NetDevice) error {
+	InitConsoleParams(&d.ConsoleParams)
+	c := d.ConsoleParams
+	if c.Host == "" || c.Port == 0 {
+		return fmt.Errorf("console: a console server host and port are required")
+	}
+
+	dial, err := netDialer(c.Proxy)
+	if err != nil {
+		return fmt.Errorf("console: %w", err)
+	}
+
+	switch c.Protocol {
+	case "telnet":
+		conn, err := connectWithTelnet(ctx, dial, c.Host, c.Port)
+		if err != nil {
+			return fmt.Errorf("console: %w", err)
+		}
+		d.TelnetConn = conn
+	case "ssh":
+		creds := d.Credentials
+		if c.Credentials != "" {
+			creds = data.GetCredentials(c.Credentials)
+		}
+		if c.Line != "" {
+			creds.Username = fmt.Sprintf("%s:%s", creds.Username, c.Line)
+		}
+		params := SSHParams{
+			Port:               c.Port,
+			KnownHostsFile:     c.KnownHostsFile,
+			InsecureConnection: c.InsecureConnection,
+			HostKeyPolicy:      c.HostKeyPolicy,
+		}
+		InitSSHParams(&params)
+		clientConfig, err := SSHClientConfig(creds, params)
+		if err != nil {
+			return fmt.Errorf("console: %w", err)
+		}
+		conn, err := connectWithSSH(ctx, dial, c.Host, c.Port, clientConfig)
+		if err != nil {
+			return fmt.Errorf("console: %w", err)
+		}
+		d.SSHConn = conn
+	default:
+		return fmt.Errorf("console: unknown protocol: %s", c.Protocol)
+	}
+	return nil
+}
+
+// privilegedPrompt wakes a console line and answers the prompts
+// it finds until it reaches a user or super user prompt. Config
+// mode is left, pagers quit and setup dialogs declined. Login
+// prompts are answered with the device's credentials.
+func privilegedPrompt(ctx context.Context, d *NetDevice, drv Driver, read readFunc, write writeFunc) (string, error) {
+	exit := "end"
+	if c, ok := drv.(Configurer); ok {
+		_, exit = c.ConfigCommands()
+	}
+	var pagerRE *regexp.Regexp
+	if p := d.pager(); p != nil {
+		pagerRE = p.Prompt
+	}
+
+	states := []*regexp.Regexp{telnetLoginRE, constant.PasswordRE, anyPromptRE(d), romMonRE, setupDialogRE}
+	for _, re := range []*regexp.Regexp{d.ConfigPromtRE, pagerRE} {
+		if re != nil {
+			states = append(states, re)
+		}
+	}
+	parts := make([]string, len(states))
+	for i, re := range states {
+		parts[i] = fmt.Sprintf(`(?:%s)`, re)
+	}
+	expect := regexp.MustCompile(strings.Join(parts, "|"))
+
+	out, err := wakeConsole(ctx, d, read, write, expect)
+	if err != nil {
+		return out, err
+	}
+
+	for i := 0; i < consoleSteps; i++ {
+		var reply string
+		line := lastLine(out)
+		switch {
+		case romMonRE.MatchString(line):
+			return out, ErrROMMON
+		case d.ConfigPromtRE != nil && d.ConfigPromtRE.MatchString(line):
+			reply = exit
+		case d.SuperUserPromptRE.MatchString(line), d.UserPromptRE.MatchString(line):
+			return out, nil
+		case constant.PasswordRE.MatchString(line), telnetLoginRE.MatchString(line):
+			out, err = login(ctx, d, read, write, out)
+			if err != nil {
+				return out, err
+			}
+			continue
+		case setupDialogRE.MatchString(line):
+			reply = "no"
+		case pagerRE != nil && pagerRE.MatchString(line):
+			reply = "q"
+		}
+
+		if err := write(reply); err != nil {
+			return out, err
+		}
+		cmdCtx, cancel := d.commandContext(ctx)
+		out, err = read(cmdCtx, expect)
+		cancel()
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, fmt.Errorf("console: unable to reach the privileged prompt: %s", strings.TrimSpace(lastLine(out)))
+}
+
+// wakeConsole sends empty lines to a console until it answers
+// with one of the prompts expect matches.
+func wakeConsole(ctx context.Context, d *NetDevice, read readFunc, write writeFunc, expect *regexp.Regexp) (string, error) {
+	var out string
+	var err error
+	for i := 0; i < consoleWakes; i++ {
+		if err := write(""); err != nil {
+			return out, err
+		}
+		wakeCtx, cancel := context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Second)
+		var more string
+		more, err = read(wakeCtx, expect)
+		cancel()
+		out += more
+		if err == nil || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+			return out, err
+		}
+	}
+	return out, fmt.Errorf("console: the line did not answer: %w", err)
+}
+
+// ConnectWithConsole connects to the device through
+// its console server using the device's driver.
+func (d *NetDevice) ConnectWithConsole(ctx context.Context) error {
+	drv, err := d.driver()
+	if err != nil {
+		return err
+	}
+	return ConnectDeviceWithConsole(ctx, d, drv)
+}
+
+// DisconnectConsole closes the connection to the console server.
+func (d NetDevice) DisconnectConsole() error {
+	if d.ConsoleParams.Protocol == "ssh" {
+		return d.DisconnectSSH()
+	}
+	return d.DisconnectTelnet()
+}
+
+// sendConsole writes a command to the console and
+// reads the output until expect is matched.
+func (d NetDevice) sendConsole(ctx context.Context, cmd string, expect *regexp.Regexp) (string, error) {
+	if d.ConsoleParams.Protocol == "ssh" {
+		return d.sendSSH(ctx, cmd, expect)
+	}
+	return d.sendTelnet(ctx, cmd, expect)
+}
+
+// RunWithConsole is the entrypoint to run commands
+// through a console server.
+func RunWithConsole(ctx context.Context, nd NetDevice, job Job) data.Result {
+
+	err := retry(ctx, job.Retry, func() error { return nd.ConnectWithConsole(ctx) })
+	if err != nil {
+		return data.Result{
+			Device:    nd.Name,
+			Error:     err,
+			Timestamp: time.Now().Unix(),
+		}
+	}
+	defer nd.DisconnectConsole()
+
+	return runJob(ctx, &nd, job, nd.sendConsole)
+
+}
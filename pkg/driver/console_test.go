@@ -0,0 +1,158 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// iosConsole answers like the console of a Cisco IOS device that
+// was left at state. It records the lines it receives.
+type iosConsole struct {
+	mu    sync.Mutex
+	state string
+	lines []string
+}
+
+func (c *iosConsole) respond(line string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, line)
+
+	switch c.state {
+	case "rommon":
+		return "\r\nrommon 1 > "
+	case "dialog":
+		if line == "no" {
+			c.state = "user"
+			return "\r\n\r\nPress RETURN to get started!\r\n\r\nrouter>"
+		}
+		return "\r\nWould you like to enter the initial configuration dialog? [yes/no]: "
+	case "pager":
+		if line == "q" {
+			c.state = "enabled"
+			return "\r\nrouter#"
+		}
+		return "\r\n --More-- "
+	case "config":
+		if line == "end" {
+			c.state = "enabled"
+			return "\r\nrouter#"
+		}
+		return "\r\nrouter(config-if)#"
+	case "login":
+		switch line {
+		case "admin":
+			return "\r\nPassword: "
+		case "cisco":
+			c.state = "user"
+			return "\r\nrouter>"
+		}
+		return "\r\n\r\nUser Access Verification\r\n\r\nUsername: "
+	case "user":
+		if line == "enable" {
+			c.state = "enabling"
+			return "\r\nPassword: "
+		}
+		return "\r\nrouter>"
+	case "enabling":
+		c.state = "enabled"
+	}
+	if line == "show clock" {
+		return "\r\n*10:00:00.000 UTC Sun Oct 18 2026\r\nrouter#"
+	}
+	return "\r\nrouter#"
+}
+
+func (c *iosConsole) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.lines...)
+}
+
+func TestRunWithConsole(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		state        string
+		wantErr      error
+		wantReceived []string
+	}
+	session := []string{"terminal length 0", "terminal width 0", "show clock"}
+	testCases := []testCase{
+		{state: "enabled", wantReceived: append([]string{""}, session...)},
+		{state: "user", wantReceived: append([]string{"", "enable", "secret"}, session...)},
+		{state: "config", wantReceived: append([]string{"", "end"}, session...)},
+		{state: "login", wantReceived: append([]string{"", "admin", "cisco", "enable", "secret"}, session...)},
+		{state: "dialog", wantReceived: append([]string{"", "no", "enable", "secret"}, session...)},
+		{state: "pager", wantReceived: append([]string{"", "q"}, session...)},
+		{state: "rommon", wantErr: driver.ErrROMMON},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.state, func(t *testing.T) {
+			t.Parallel()
+			c := &iosConsole{state: tc.state}
+			fd := newFakeDevice(t, "", c.respond)
+
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "iosv-1", IP: "192.0.2.1", Vendor: "cisco", Platform: "ios", Connector: "console",
+				ConsoleParams: driver.ConsoleParams{Host: "127.0.0.1", Port: fd.port()},
+				Credentials:   data.Credentials{Username: "admin", Password: "cisco", SuperPassword: "secret"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show clock"}})
+			if tc.wantErr != nil {
+				if !errors.Is(result.Error, tc.wantErr) {
+					t.Fatalf("want %v, got %v", tc.wantErr, result.Error)
+				}
+				return
+			}
+			if !result.OK {
+				t.Fatalf("want OK, got %v", result.Error)
+			}
+			if !strings.Contains(result.CommandOutputs[0].Output, "UTC Sun Oct 18 2026") {
+				t.Errorf("want the clock, got %q", result.CommandOutputs[0].Output)
+			}
+
+			got := strings.Join(c.received(), "|")
+			want := strings.Join(tc.wantReceived, "|")
+			if got != want {
+				t.Errorf("want received %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestRunWithConsoleSSH(t *testing.T) {
+	t.Parallel()
+	c := &iosConsole{state: "config"}
+	fs := newFakeSSHServer(t, "admin:port05", "cisco", "", c.respond)
+
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "192.0.2.1", Vendor: "cisco", Platform: "ios", Connector: "console",
+		ConsoleParams: driver.ConsoleParams{
+			Host: "127.0.0.1", Port: fs.port(), Protocol: "ssh", Line: "port05", InsecureConnection: true,
+		},
+		Credentials: data.Credentials{Username: "admin", Password: "cisco", SuperPassword: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show clock"}})
+	if !result.OK {
+		t.Fatalf("want OK, got %v", result.Error)
+	}
+	if !strings.Contains(result.CommandOutputs[0].Output, "UTC Sun Oct 18 2026") {
+		t.Errorf("want the clock, got %q", result.CommandOutputs[0].Output)
+	}
+}
@@ -0,0 +1,329 @@
+package driver
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtinDefinitions holds the definitions
+// of the platforms shipped with jato.
+//
+//go:embed platforms/*.yaml
+var builtinDefinitions embed.FS
+
+func init() {
+	drvs, err := loadDefinitions(builtinDefinitions, "platforms")
+	if err != nil {
+		panic(fmt.Sprintf("driver: invalid built-in definition: %v", err))
+	}
+	for _, drv := range drvs {
+		Register(drv.Name(), drv)
+	}
+}
+
+// Definition describes a platform declaratively. Definitions are
+// loaded from YAML or JSON files and registered as drivers.
+type Definition struct {
+	Vendor          string            `json:"vendor" yaml:"vendor"`
+	Platform        string            `json:"platform" yaml:"platform"`
+	Prompts         DefinitionPrompts `json:"prompts" yaml:"prompts"`
+	Enable          string            `json:"enable" yaml:"enable"`
+	Config          DefinitionConfig  `json:"config" yaml:"config"`
+	Commit          CommitCommands    `json:"commit" yaml:"commit"`
+	Pager           DefinitionPager   `json:"pager" yaml:"pager"`
+	Checksum        ChecksumCommand   `json:"checksum" yaml:"checksum"`
+	SessionCommands []string          `json:"sessionCommands" yaml:"sessionCommands"`
+	ErrorPatterns   []string          `json:"errorPatterns" yaml:"errorPatterns"`
+	Connectors      []string          `json:"connectors" yaml:"connectors"`
+	Exec            bool              `json:"exec" yaml:"exec"`
+	Detect          Fingerprint       `json:"detect" yaml:"detect"`
+	Timeout         int64             `json:"timeout" yaml:"timeout"`
+	LoginTimeout    int64             `json:"loginTimeout" yaml:"loginTimeout"`
+}
+
+// DefinitionPrompts holds the prompt regexes of a Definition.
+type DefinitionPrompts struct {
+	User      string `json:"user" yaml:"user"`
+	SuperUser string `json:"superUser" yaml:"superUser"`
+	Config    string `json:"config" yaml:"config"`
+}
+
+// DefinitionConfig holds the commands that enter
+// and exit configuration mode.
+type DefinitionConfig struct {
+	Enter string `json:"enter" yaml:"enter"`
+	Exit  string `json:"exit" yaml:"exit"`
+}
+
+// DefinitionPager holds the pager prompt regex of a Definition
+// and the response that shows the next page, a space by default.
+type DefinitionPager struct {
+	Prompt   string `json:"prompt" yaml:"prompt"`
+	Response string `json:"response" yaml:"response"`
+}
+
+// DefinitionDriver is a Driver built from a Definition.
+type DefinitionDriver struct {
+	def           Definition
+	prompts       Prompts
+	pager         *Pager
+	errorPatterns []*regexp.Regexp
+}
+
+// NewDefinitionDriver validates a Definition and
+// compiles its regexes into a DefinitionDriver.
+func NewDefinitionDriver(def Definition) (*DefinitionDriver, error) {
+	if def.Vendor == "" || def.Platform == "" {
+		return nil, errors.New("a vendor and platform are required")
+	}
+	if len(def.Connectors) == 0 {
+		def.Connectors = []string{"ssh"}
+	}
+	if def.Timeout == 0 {
+		def.Timeout = 5
+	}
+	if def.LoginTimeout == 0 {
+		def.LoginTimeout = 2
+	}
+
+	drv := &DefinitionDriver{def: def}
+
+	var err error
+	if drv.prompts.UserPromptRE, err = compilePrompt("user", def.Prompts.User); err != nil {
+		return nil, err
+	}
+	if drv.prompts.SuperUserPromptRE, err = compilePrompt("superUser", def.Prompts.SuperUser); err != nil {
+		return nil, err
+	}
+	if drv.prompts.ConfigPromptRE, err = compilePrompt("config", def.Prompts.Config); err != nil {
+		return nil, err
+	}
+
+	if def.Commit.IDPattern != "" {
+		if _, err := regexp.Compile(def.Commit.IDPattern); err != nil {
+			return nil, fmt.Errorf("commit id pattern: %v", err)
+		}
+	}
+
+	if def.Checksum.Command != "" {
+		if def.Checksum.Pattern == "" {
+			return nil, errors.New("a checksum pattern is required")
+		}
+		if _, err := regexp.Compile(def.Checksum.Pattern); err != nil {
+			return nil, fmt.Errorf("checksum pattern: %v", err)
+		}
+	}
+
+	if _, err := compileFingerprint(def.Detect); err != nil {
+		return nil, err
+	}
+
+	if def.Pager.Prompt != "" {
+		re, err := regexp.Compile(def.Pager.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf("pager prompt: %v", err)
+		}
+		if def.Pager.Response == "" {
+			def.Pager.Response = " "
+			drv.def = def
+		}
+		drv.pager = &Pager{Prompt: re, Response: def.Pager.Response}
+	}
+
+	for _, p := range def.ErrorPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("error pattern: %q: %v", p, err)
+		}
+		drv.errorPatterns = append(drv.errorPatterns, re)
+	}
+
+	return drv, nil
+}
+
+// compilePrompt compiles a required prompt regex.
+func compilePrompt(name, s string) (*regexp.Regexp, error) {
+	if s == "" {
+		return nil, fmt.Errorf("a %s prompt is required", name)
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s prompt: %v", name, err)
+	}
+	return re, nil
+}
+
+// Name returns the name the driver is registered with.
+func (drv *DefinitionDriver) Name() string {
+	return fmt.Sprintf("%s_%s", drv.def.Vendor, drv.def.Platform)
+}
+
+// Definition returns the Definition the driver was built from.
+func (drv *DefinitionDriver) Definition() Definition {
+	return drv.def
+}
+
+func (drv *DefinitionDriver) Prompts() Prompts {
+	return drv.prompts
+}
+
+func (drv *DefinitionDriver) SessionCommands() []string {
+	return drv.def.SessionCommands
+}
+
+func (drv *DefinitionDriver) Timeout() int64 {
+	return drv.def.Timeout
+}
+
+// EnableCommand returns the command that escalates
+// a session from a user prompt to a super user prompt.
+func (drv *DefinitionDriver) EnableCommand() string {
+	return drv.def.Enable
+}
+
+// ConfigCommands returns the commands that enter
+// and exit configuration mode.
+func (drv *DefinitionDriver) ConfigCommands() (enter, exit string) {
+	return drv.def.Config.Enter, drv.def.Config.Exit
+}
+
+// CommitCommands returns the commands of the commit workflow.
+func (drv *DefinitionDriver) CommitCommands() CommitCommands {
+	return drv.def.Commit
+}
+
+// ChecksumCommand returns the command that computes
+// the checksum of a file on the device.
+func (drv *DefinitionDriver) ChecksumCommand() ChecksumCommand {
+	return drv.def.Checksum
+}
+
+// Pager returns the platform's pager, nil
+// when the platform does not page output.
+func (drv *DefinitionDriver) Pager() *Pager {
+	return drv.pager
+}
+
+// ErrorPatterns returns the patterns that identify
+// an error in a command's output.
+func (drv *DefinitionDriver) ErrorPatterns() []*regexp.Regexp {
+	return drv.errorPatterns
+}
+
+// ExecCommands reports whether commands are run on exec channels.
+func (drv *DefinitionDriver) ExecCommands() bool {
+	return drv.def.Exec
+}
+
+// Fingerprint returns what identifies the platform on
+// devices whose platform is detected.
+func (drv *DefinitionDriver) Fingerprint() Fingerprint {
+	return drv.def.Detect
+}
+
+// Supports reports whether the platform supports a connector.
+func (drv *DefinitionDriver) Supports(connector string) bool {
+	for _, c := range drv.def.Connectors {
+		if c == connector {
+			return true
+		}
+	}
+	return false
+}
+
+func (drv *DefinitionDriver) ConnectWithSSH(ctx context.Context, d *NetDevice) error {
+	if !drv.Supports("ssh") {
+		return notSupported(d, "ssh")
+	}
+	return ConnectDeviceWithSSH(ctx, d, drv, drv.def.LoginTimeout)
+}
+
+func (drv *DefinitionDriver) ConnectWithTelnet(ctx context.Context, d *NetDevice) error {
+	if !drv.Supports("telnet") {
+		return notSupported(d, "telnet")
+	}
+	return ConnectDeviceWithTelnet(ctx, d, drv, drv.def.LoginTimeout)
+}
+
+// ParseDefinition parses a Definition from a YAML or JSON
+// document. The format is chosen by the file extension.
+func ParseDefinition(fileName string, b []byte) (Definition, error) {
+	def := Definition{}
+	var err error
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".json":
+		err = json.Unmarshal(b, &def)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &def)
+	default:
+		err = errors.New("unknown definition file format")
+	}
+	if err != nil {
+		return def, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return def, nil
+}
+
+// LoadDefinitions loads the definitions in a directory
+// and registers a driver for each of them. Only files with a
+// .yaml, .yml or .json extension are loaded.
+func LoadDefinitions(dir string) error {
+	drvs, err := loadDefinitions(os.DirFS(dir), ".")
+	if err != nil {
+		return err
+	}
+	for _, drv := range drvs {
+		if _, err := Lookup(drv.def.Vendor, drv.def.Platform); err == nil {
+			return fmt.Errorf("%s: driver %s is already registered", dir, drv.Name())
+		}
+		Register(drv.Name(), drv)
+	}
+	return nil
+}
+
+// loadDefinitions builds a driver for each
+// definition file in a directory of fsys.
+func loadDefinitions(fsys fs.FS, dir string) ([]*DefinitionDriver, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	drvs := []*DefinitionDriver{}
+	for _, e := range entries {
+		switch strings.ToLower(path.Ext(e.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		if e.IsDir() {
+			continue
+		}
+		fileName := path.Join(dir, e.Name())
+		b, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, err
+		}
+		def, err := ParseDefinition(fileName, b)
+		if err != nil {
+			return nil, err
+		}
+		drv, err := NewDefinitionDriver(def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+		drvs = append(drvs, drv)
+	}
+
+	return drvs, nil
+}
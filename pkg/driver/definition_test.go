@@ -0,0 +1,88 @@
+package driver_test
+
+import (
+	"testing"
+
+	"github.com/automatico/jato/pkg/driver"
+)
+
+func TestParseDefinition(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		fileName string
+		have     string
+	}
+	testCases := []testCase{
+		{fileName: "acme_os.yaml", have: `
+vendor: acme
+platform: os
+connectors: [ssh, telnet]
+prompts:
+  user: '(?im)^[a-z0-9]{1,63}>$'
+  superUser: '(?im)^[a-z0-9]{1,63}#$'
+  config: '(?im)^[a-z0-9]{1,63}\(config\)#$'
+pager:
+  prompt: '--More--'
+sessionCommands:
+  - no paging
+`},
+		{fileName: "acme_os.json", have: `{
+  "vendor": "acme", "platform": "os", "connectors": ["ssh", "telnet"],
+  "prompts": {
+    "user": "(?im)^[a-z0-9]{1,63}>$",
+    "superUser": "(?im)^[a-z0-9]{1,63}#$",
+    "config": "(?im)^[a-z0-9]{1,63}\\(config\\)#$"
+  },
+  "pager": {"prompt": "--More--"},
+  "sessionCommands": ["no paging"]
+}`},
+	}
+
+	for _, tc := range testCases {
+		def, err := driver.ParseDefinition(tc.fileName, []byte(tc.have))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.fileName, err)
+		}
+		drv, err := driver.NewDefinitionDriver(def)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.fileName, err)
+		}
+		if drv.Name() != "acme_os" {
+			t.Errorf("%s: want name acme_os, got %s", tc.fileName, drv.Name())
+		}
+		if !drv.Supports("telnet") {
+			t.Errorf("%s: want telnet support", tc.fileName)
+		}
+		if !drv.Prompts().ConfigPromptRE.MatchString("acme1(config)#") {
+			t.Errorf("%s: want config prompt to match acme1(config)#", tc.fileName)
+		}
+		if len(drv.SessionCommands()) != 1 || drv.Timeout() != 5 {
+			t.Errorf("%s: want 1 session command and a 5 second timeout", tc.fileName)
+		}
+		if p := drv.Pager(); p == nil || p.Response != " " {
+			t.Errorf("%s: want a pager that responds with a space", tc.fileName)
+		}
+	}
+
+}
+
+func TestNewDefinitionDriverInvalid(t *testing.T) {
+	t.Parallel()
+	testCases := []driver.Definition{
+		{Platform: "os"},
+		{Vendor: "acme", Platform: "os"},
+		{Vendor: "acme", Platform: "os", Prompts: driver.DefinitionPrompts{User: "(", SuperUser: "#", Config: "#"}},
+		{Vendor: "acme", Platform: "os", Prompts: driver.DefinitionPrompts{User: ">", SuperUser: "#", Config: "#"}, Pager: driver.DefinitionPager{Prompt: "("}},
+		{Vendor: "acme", Platform: "os", Prompts: driver.DefinitionPrompts{User: ">", SuperUser: "#", Config: "#"}, Checksum: driver.ChecksumCommand{Command: "md5 {file}"}},
+		{Vendor: "acme", Platform: "os", Prompts: driver.DefinitionPrompts{User: ">", SuperUser: "#", Config: "#"}, Checksum: driver.ChecksumCommand{Command: "md5 {file}", Pattern: "("}},
+		{Vendor: "acme", Platform: "os", Prompts: driver.DefinitionPrompts{User: ">", SuperUser: "#", Config: "#"}, Detect: driver.Fingerprint{Command: "show version"}},
+		{Vendor: "acme", Platform: "os", Prompts: driver.DefinitionPrompts{User: ">", SuperUser: "#", Config: "#"}, Detect: driver.Fingerprint{Banner: "("}},
+	}
+
+	for _, tc := range testCases {
+		if _, err := driver.NewDefinitionDriver(tc); err == nil {
+			t.Errorf("want error for definition %+v", tc)
+		}
+	}
+
+}
@@ -0,0 +1,314 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AutoVendor is the vendor of devices whose platform is
+// not known, it is detected when they are connected to.
+const AutoVendor = "auto"
+
+// DefaultDetectTimeout is the timeout in seconds of each step
+// of a detection when the device does not have a timeout.
+const DefaultDetectTimeout = 10
+
+var (
+	// detectPromptRE matches the prompts of most platforms,
+	// at any privilege level. EG: router>, switch# or user@host:~$
+	detectPromptRE = regexp.MustCompile(`(?m)^[^\r\n]{1,64}[>#$%] ?$`)
+	// detectPager answers the pager prompts of most platforms.
+	detectPager = &Pager{Prompt: regexp.MustCompile(`(?i)-{2,} ?\(?more\b[^\r\n]{0,8}?\)? ?-{2,}|<--- more --->`), Response: " "}
+)
+
+// Fingerprinter is implemented by drivers of platforms
+// that can be detected on devices of an unknown platform.
+type Fingerprinter interface {
+	Fingerprint() Fingerprint
+}
+
+// Fingerprint identifies a platform. Banner is matched with the
+// SSH server's version and the text a device sends before its first
+// prompt, Pattern with the output of Command. EG: show version
+type Fingerprint struct {
+	Banner  string `json:"banner" yaml:"banner"`
+	Command string `json:"command" yaml:"command"`
+	Pattern string `json:"pattern" yaml:"pattern"`
+}
+
+// platformFingerprint is the compiled fingerprint of a platform.
+type platformFingerprint struct {
+	vendor   string
+	platform string
+	banner   *regexp.Regexp
+	command  string
+	pattern  *regexp.Regexp
+}
+
+// fingerprints returns the compiled fingerprints of the
+// registered drivers in the order of their names. A
+// fingerprint that does not compile is left out.
+func fingerprints() []platformFingerprint {
+	fps := []platformFingerprint{}
+	for _, name := range Drivers() {
+		parts := strings.SplitN(name, "_", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		drv, err := Lookup(parts[0], parts[1])
+		if err != nil {
+			continue
+		}
+		f, ok := drv.(Fingerprinter)
+		if !ok {
+			continue
+		}
+		fp, err := compileFingerprint(f.Fingerprint())
+		if err != nil {
+			continue
+		}
+		fp.vendor, fp.platform = parts[0], parts[1]
+		fps = append(fps, fp)
+	}
+	return fps
+}
+
+// compileFingerprint compiles the regexes of a fingerprint.
+func compileFingerprint(f Fingerprint) (platformFingerprint, error) {
+	fp := platformFingerprint{command: f.Command}
+	var err error
+	if f.Banner != "" {
+		if fp.banner, err = regexp.Compile(f.Banner); err != nil {
+			return fp, fmt.Errorf("detect banner: %v", err)
+		}
+	}
+	if f.Command != "" {
+		if f.Pattern == "" {
+			return fp, errors.New("a detect pattern is required")
+		}
+		if fp.pattern, err = regexp.Compile(f.Pattern); err != nil {
+			return fp, fmt.Errorf("detect pattern: %v", err)
+		}
+	}
+	return fp, nil
+}
+
+// detectConnectors are the connectors of the
+// sessions platforms are detected over.
+var detectConnectors = []string{"ssh", "telnet", "console"}
+
+// detectable returns the error for a device of the AutoVendor
+// whose platform can not be detected over its connector.
+func detectable(d *NetDevice) error {
+	for _, c := range detectConnectors {
+		if d.Connector == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("detect: %s: the %s connector is not supported, use %s", d.Name, d.Connector, strings.Join(detectConnectors, ", "))
+}
+
+// detectSession is a terminal session with a
+// device of an unknown platform.
+type detectSession struct {
+	// banner is sent by the server before the session.
+	// EG: the SSH server's version
+	banner string
+	// prompt reads up to the device's first prompt,
+	// answering the login prompts on the way.
+	prompt func(ctx context.Context) (string, error)
+	read   readFunc
+	write  writeFunc
+	close  func() error
+}
+
+// Detect connects to a device with its connector, SSH, Telnet or
+// console, and returns the vendor and platform of the first
+// registered driver whose fingerprint matches. The banners are
+// matched first, then the fingerprint commands are sent at the
+// device's prompt, each of them once.
+func Detect(ctx context.Context, d NetDevice) (vendor, platform string, err error) {
+	if err := detectable(&d); err != nil {
+		return "", "", err
+	}
+	if d.Timeout == 0 {
+		d.Timeout = DefaultDetectTimeout
+	}
+	timeout := time.Duration(d.Timeout) * time.Second
+	// Any prompt will do to log in and send commands
+	d.UserPromptRE, d.SuperUserPromptRE, d.ConfigPromtRE = detectPromptRE, detectPromptRE, nil
+
+	var s detectSession
+	switch d.Connector {
+	case "ssh":
+		s, err = detectSSH(ctx, &d, timeout)
+	case "telnet":
+		s, err = detectTelnet(ctx, &d, timeout)
+	case "console":
+		s, err = detectConsole(ctx, &d)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	defer s.close()
+
+	fps := fingerprints()
+
+	// A device that does not present a prompt,
+	// EG: a login, can still match its banner
+	banner, promptErr := s.prompt(ctx)
+	var timeoutErr *TimeoutError
+	if errors.As(promptErr, &timeoutErr) {
+		banner += timeoutErr.Output
+	} else if promptErr != nil {
+		return "", "", promptErr
+	}
+	banner = s.banner + "\n" + banner
+	for _, fp := range fps {
+		if fp.banner != nil && fp.banner.MatchString(banner) {
+			return fp.vendor, fp.platform, nil
+		}
+	}
+	if promptErr != nil {
+		return "", "", fmt.Errorf("detect: %s: %w", d.Name, promptErr)
+	}
+
+	sent := map[string]bool{}
+	for _, fp := range fps {
+		if fp.command == "" || sent[fp.command] {
+			continue
+		}
+		sent[fp.command] = true
+
+		if err := s.write(fp.command); err != nil {
+			return "", "", err
+		}
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		out, err := s.read(cmdCtx, detectPromptRE)
+		cancel()
+		if err != nil {
+			return "", "", fmt.Errorf("detect: %s: '%s': %w", d.Name, fp.command, err)
+		}
+
+		for _, match := range fps {
+			if match.command == fp.command && match.pattern.MatchString(out) {
+				return match.vendor, match.platform, nil
+			}
+		}
+	}
+
+	return "", "", fmt.Errorf("detect: %s: no platform matched", d.Name)
+}
+
+// detectRead returns a readFunc that pages through
+// the output of a session with the detectPager.
+func detectRead(r io.Reader, w io.Writer) readFunc {
+	return func(ctx context.Context, expect *regexp.Regexp) (string, error) {
+		return ReadPaged(ctx, r, w, expect, detectPager)
+	}
+}
+
+// detectSSH opens a shell on a device with SSH,
+// through its jump hosts if it has any.
+func detectSSH(ctx context.Context, d *NetDevice, timeout time.Duration) (detectSession, error) {
+	InitSSHParams(&d.SSHParams)
+	clientConfig, err := SSHClientConfig(d.Credentials, d.SSHParams)
+	if err != nil {
+		return detectSession{}, err
+	}
+	dial, err := jumpHosts.dialer(ctx, d.SSHParams.Proxy, d.SSHParams.JumpHosts, d.Credentials)
+	if err != nil {
+		return detectSession{}, err
+	}
+	client, err := dialSSHClient(ctx, dial, fmt.Sprintf("%s:%d", d.IP, d.SSHParams.Port), clientConfig)
+	if err != nil {
+		return detectSession{}, err
+	}
+	conn, err := startShell(ctx, client)
+	if err != nil {
+		client.Close()
+		return detectSession{}, err
+	}
+
+	read := detectRead(conn.StdOut, conn.StdIn)
+	return detectSession{
+		banner: string(client.ServerVersion()),
+		prompt: func(ctx context.Context) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return read(ctx, detectPromptRE)
+		},
+		read:  read,
+		write: func(s string) error { _, err := WriteSSH(conn.StdIn, s); return err },
+		close: func() error {
+			conn.Close()
+			return client.Close()
+		},
+	}, nil
+}
+
+// detectTelnet connects to a device with Telnet, its login
+// prompts are answered with the device's credentials.
+func detectTelnet(ctx context.Context, d *NetDevice, timeout time.Duration) (detectSession, error) {
+	InitTelnetParams(&d.TelnetParams)
+	dial, err := netDialer(d.TelnetParams.Proxy)
+	if err != nil {
+		return detectSession{}, err
+	}
+	conn, err := connectWithTelnet(ctx, dial, d.IP, d.TelnetParams.Port)
+	if err != nil {
+		return detectSession{}, err
+	}
+
+	read := detectRead(conn.StdOut, conn.Conn)
+	write := func(s string) error { return WriteTelnet(conn.Conn, s) }
+	return detectSession{
+		prompt: func(ctx context.Context) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return login(ctx, d, read, write, "")
+		},
+		read:  read,
+		write: write,
+		close: conn.Close,
+	}, nil
+}
+
+// detectConsole connects to a device's console server, the
+// line is woken and brought to a prompt as it is to connect.
+func detectConsole(ctx context.Context, d *NetDevice) (detectSession, error) {
+	if err := dialConsole(ctx, d); err != nil {
+		return detectSession{}, err
+	}
+
+	read := detectRead(d.TelnetConn.StdOut, d.TelnetConn.Conn)
+	write := d.writeTelnet
+	if d.ConsoleParams.Protocol == "ssh" {
+		read = detectRead(d.SSHConn.StdOut, d.SSHConn.StdIn)
+		write = d.writeSSH
+	}
+	return detectSession{
+		prompt: func(ctx context.Context) (string, error) {
+			return privilegedPrompt(ctx, d, nil, read, write)
+		},
+		read:  read,
+		write: write,
+		close: d.DisconnectConsole,
+	}, nil
+}
+
+// detectDevice initializes a device of an unknown platform
+// with the driver of the platform detected on it.
+func detectDevice(ctx context.Context, d NetDevice) (NetDevice, error) {
+	vendor, platform, err := Detect(ctx, d)
+	if err != nil {
+		return d, err
+	}
+	d.Vendor, d.Platform, d.Driver = vendor, platform, nil
+	return NewDevice(d)
+}
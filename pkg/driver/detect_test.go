@@ -0,0 +1,246 @@
+package driver_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// fingerprintShell answers the fingerprint commands with
+// outputs and anything else with unknown, it records the
+// lines it receives.
+type fingerprintShell struct {
+	prompt  string
+	unknown string
+	outputs map[string]string
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func (fs *fingerprintShell) respond(line string) string {
+	fs.mu.Lock()
+	fs.lines = append(fs.lines, line)
+	fs.mu.Unlock()
+	out, ok := fs.outputs[line]
+	if !ok {
+		out = fs.unknown
+	}
+	return "\r\n" + out + "\r\n" + fs.prompt
+}
+
+func (fs *fingerprintShell) received() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string{}, fs.lines...)
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name         string
+		banner       string
+		shell        *fingerprintShell
+		wantVendor   string
+		wantPlatform string
+		wantErr      string
+		wantLines    []string
+	}
+	testCases := []testCase{
+		{
+			name:   "arista eos",
+			banner: "\r\nveos-1>",
+			shell: &fingerprintShell{prompt: "veos-1>", outputs: map[string]string{
+				"show version": "Arista vEOS\r\nHardware version:\r\nSoftware image version: 4.26.1F",
+			}},
+			wantVendor: "arista", wantPlatform: "eos",
+			wantLines: []string{"show version"},
+		},
+		{
+			name:   "cisco ios",
+			banner: "\r\nrouter>",
+			shell: &fingerprintShell{prompt: "router>", outputs: map[string]string{
+				"show version": "Cisco IOS Software, IOSv Software (VIOS-ADVENTERPRISEK9-M), Version 15.6(2)T",
+			}},
+			wantVendor: "cisco", wantPlatform: "ios",
+			wantLines: []string{"show version"},
+		},
+		{
+			name:   "cisco ios-xr",
+			banner: "\r\nRP/0/0/CPU0:iosxr-1#",
+			shell: &fingerprintShell{prompt: "RP/0/0/CPU0:iosxr-1#", outputs: map[string]string{
+				"show version": "Cisco IOS XR Software, Version 6.1.3[Default]",
+			}},
+			wantVendor: "cisco", wantPlatform: "iosxr",
+			wantLines: []string{"show version"},
+		},
+		{
+			name:       "juniper junos banner",
+			banner:     "--- JUNOS 20.4R1.12 Kernel 64-bit  JNPR-12.1-20201218.3e7b7b6_buil\r\nadmin@vmx-1> ",
+			shell:      &fingerprintShell{prompt: "admin@vmx-1> "},
+			wantVendor: "juniper", wantPlatform: "junos",
+		},
+		{
+			name:   "linux",
+			banner: "Last login: Sun Oct 18 10:00:00 2026\r\n[admin@host ~]$ ",
+			shell: &fingerprintShell{prompt: "[admin@host ~]$ ", unknown: "-bash: show: command not found", outputs: map[string]string{
+				"uname -s": "Linux",
+			}},
+			wantVendor: "linux", wantPlatform: "linux",
+			wantLines: []string{"show version", "show sysinfo", "uname -s"},
+		},
+		{
+			name:    "unknown",
+			banner:  "\r\nbox>",
+			shell:   &fingerprintShell{prompt: "box>", unknown: "% Unknown command"},
+			wantErr: "detect: box-1: no platform matched",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fs := newFakeSSHServer(t, "admin", "secret", tc.banner, tc.shell.respond)
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "box-1", IP: "127.0.0.1", Vendor: driver.AutoVendor, Connector: "ssh",
+				SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true},
+				Credentials: data.Credentials{Username: "admin", Password: "secret"},
+				Timeout:     2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vendor, platform, err := driver.Detect(context.Background(), d)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("want %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vendor != tc.wantVendor || platform != tc.wantPlatform {
+				t.Errorf("want %s %s, got %s %s", tc.wantVendor, tc.wantPlatform, vendor, platform)
+			}
+			got := strings.Join(tc.shell.received(), "|")
+			want := strings.Join(tc.wantLines, "|")
+			if got != want {
+				t.Errorf("want the commands %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestRunAutoVendor(t *testing.T) {
+	t.Parallel()
+	shell := &fingerprintShell{prompt: "router#", outputs: map[string]string{
+		"show version": "Cisco IOS Software, IOSv Software (VIOS-ADVENTERPRISEK9-M), Version 15.6(2)T",
+		"show clock":   "*10:00:00.000 UTC Sun Oct 18 2026",
+	}}
+	fs := newFakeSSHServer(t, "admin", "secret", "\r\nrouter#", shell.respond)
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: driver.AutoVendor, Connector: "ssh",
+		SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true},
+		Credentials: data.Credentials{Username: "admin", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show clock"}})
+	if !result.OK {
+		t.Fatalf("want OK, got %v", result.Error)
+	}
+	if out := result.CommandOutputs[0].Output; !strings.Contains(out, "Sun Oct 18 2026") {
+		t.Errorf("want the output of the command, got %q", out)
+	}
+	if fs.connections() != 2 {
+		t.Errorf("want a connection to detect and one to run the job, got %d", fs.connections())
+	}
+}
+
+// loginShell answers the login of a Telnet session before
+// handing the lines to a fingerprintShell.
+func loginShell(shell *fingerprintShell) func(line string) string {
+	loggedIn := false
+	return func(line string) string {
+		switch {
+		case loggedIn:
+			return shell.respond(line)
+		case line == "admin":
+			return "\r\nPassword: "
+		case line == "secret":
+			loggedIn = true
+			return "\r\n" + shell.prompt
+		}
+		return "\r\n% Login invalid\r\n\r\nUsername: "
+	}
+}
+
+func TestDetectConnectors(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		connector string
+		banner    string
+		login     bool
+		wantLines []string
+	}
+	testCases := []testCase{
+		{connector: "telnet", banner: "\r\nUser Access Verification\r\n\r\nUsername: ", login: true, wantLines: []string{"show version"}},
+		{connector: "console", wantLines: []string{"", "show version"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.connector, func(t *testing.T) {
+			t.Parallel()
+			shell := &fingerprintShell{prompt: "router>", outputs: map[string]string{
+				"show version": "Cisco IOS Software, IOSv Software (VIOS-ADVENTERPRISEK9-M), Version 15.6(2)T",
+			}}
+			respond := shell.respond
+			if tc.login {
+				respond = loginShell(shell)
+			}
+			fd := newFakeDevice(t, tc.banner, respond)
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "iosv-1", IP: "127.0.0.1", Vendor: driver.AutoVendor, Connector: tc.connector,
+				TelnetParams:  driver.TelnetParams{Port: fd.port()},
+				ConsoleParams: driver.ConsoleParams{Host: "127.0.0.1", Port: fd.port()},
+				Credentials:   data.Credentials{Username: "admin", Password: "secret"},
+				Timeout:       2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vendor, platform, err := driver.Detect(context.Background(), d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vendor != "cisco" || platform != "ios" {
+				t.Errorf("want cisco ios, got %s %s", vendor, platform)
+			}
+			got := strings.Join(shell.received(), "|")
+			want := strings.Join(tc.wantLines, "|")
+			if got != want {
+				t.Errorf("want the commands %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestNewDeviceAutoVendorConnector(t *testing.T) {
+	t.Parallel()
+	_, err := driver.NewDevice(driver.NetDevice{Name: "veos-1", Vendor: driver.AutoVendor, Connector: "eapi"})
+	want := "detect: veos-1: the eapi connector is not supported, use ssh, telnet, console"
+	if err == nil || err.Error() != want {
+		t.Errorf("want %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,158 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Driver is implemented by each supported vendor platform.
+// Drivers are made available to jato by calling Register,
+// usually from an init function.
+type Driver interface {
+	// Prompts returns the prompts presented by the platform.
+	Prompts() Prompts
+	// SessionCommands returns the commands sent after login
+	// to prepare the session. EG: disable paging.
+	SessionCommands() []string
+	// Timeout returns the default command timeout in seconds.
+	Timeout() int64
+	// ConnectWithSSH connects to a device with SSH and
+	// prepares the session.
+	ConnectWithSSH(ctx context.Context, d *NetDevice) error
+	// ConnectWithTelnet connects to a device with Telnet and
+	// prepares the session.
+	ConnectWithTelnet(ctx context.Context, d *NetDevice) error
+}
+
+// Prompts holds the prompts a platform presents
+// in each privilege level.
+type Prompts struct {
+	UserPromptRE      *regexp.Regexp
+	SuperUserPromptRE *regexp.Regexp
+	ConfigPromptRE    *regexp.Regexp
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register makes a driver available by name. The name is the
+// vendor and platform joined with an underscore. EG: cisco_ios
+// Register panics if it is called twice with the same name
+// or if drv is nil.
+func Register(name string, drv Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if drv == nil {
+		panic("driver: Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("driver: Register called twice for driver " + name)
+	}
+	drivers[name] = drv
+}
+
+// Drivers returns a sorted list of the names
+// of the registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the driver registered for
+// a vendor and platform.
+func Lookup(vendor, platform string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	drv, ok := drivers[fmt.Sprintf("%s_%s", vendor, platform)]
+	if !ok {
+		return nil, fmt.Errorf("vendor: %s and platform: %s not supported", vendor, platform)
+	}
+	return drv, nil
+}
+
+// NewDevice takes a NetDevice and initializes it with
+// the driver registered for its vendor and platform. A
+// device of the AutoVendor is initialized with the driver
+// of its platform once it is detected, its connector must
+// be one platforms are detected over.
+func NewDevice(d NetDevice) (NetDevice, error) {
+	if d.Vendor == AutoVendor {
+		if err := detectable(&d); err != nil {
+			return d, err
+		}
+		initParams(&d)
+		return d, nil
+	}
+	drv, err := Lookup(d.Vendor, d.Platform)
+	if err != nil {
+		return d, fmt.Errorf("device: %s with %v", d.Name, err)
+	}
+	return InitDevice(d, drv), nil
+}
+
+// InitDevice takes a NetDevice and initializes it with
+// the prompts, connection parameters and timeout of a driver.
+func InitDevice(d NetDevice, drv Driver) NetDevice {
+	// Prompts
+	prompts := drv.Prompts()
+	d.UserPromptRE = prompts.UserPromptRE
+	d.SuperUserPromptRE = prompts.SuperUserPromptRE
+	d.ConfigPromtRE = prompts.ConfigPromptRE
+
+	initParams(&d)
+
+	// Timeout
+	d.Timeout = drv.Timeout()
+
+	d.Driver = drv
+
+	return d
+}
+
+// initParams sets the defaults of a device's connection parameters.
+func initParams(d *NetDevice) {
+	// SSH Params
+	InitSSHParams(&d.SSHParams)
+
+	// Telnet Params
+	InitTelnetParams(&d.TelnetParams)
+
+	// Console Params
+	InitConsoleParams(&d.ConsoleParams)
+
+	// NETCONF Params
+	InitNetconfParams(&d.NetconfParams)
+
+	// HTTP API Params
+	InitHTTPParams(&d.HTTPParams)
+}
+
+// notSupported returns the error for a connector
+// a device's driver does not implement.
+func notSupported(d *NetDevice, connector string) error {
+	return fmt.Errorf("device: %s with vendor: %s and platform: %s does not support connector: %s", d.Name, d.Vendor, d.Platform, connector)
+}
+
+// supports returns the error for a connector the device's driver
+// does not list, drivers that do not list connectors support any.
+func supports(d *NetDevice, connector string) error {
+	drv, err := d.driver()
+	if err != nil {
+		return err
+	}
+	if s, ok := drv.(interface{ Supports(string) bool }); ok && !s.Supports(connector) {
+		return notSupported(d, connector)
+	}
+	return nil
+}
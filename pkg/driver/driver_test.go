@@ -0,0 +1,79 @@
+package driver_test
+
+import (
+	"testing"
+
+	"github.com/automatico/jato/pkg/driver"
+)
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		vendor   string
+		platform string
+		wantErr  bool
+	}
+	testCases := []testCase{
+		{vendor: "cisco", platform: "ios", wantErr: false},
+		{vendor: "juniper", platform: "junos", wantErr: false},
+		{vendor: "linux", platform: "linux", wantErr: false},
+		{vendor: "cisco", platform: "catos", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		_, err := driver.Lookup(tc.vendor, tc.platform)
+		if tc.wantErr != (err != nil) {
+			t.Errorf("%s_%s: want error %t, got %v", tc.vendor, tc.platform, tc.wantErr, err)
+		}
+	}
+
+}
+
+func TestNewDevice(t *testing.T) {
+	t.Parallel()
+	d, err := driver.NewDevice(driver.NetDevice{Name: "smb-1", Vendor: "cisco", Platform: "smb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Timeout != 120 {
+		t.Errorf("want timeout 120, got %d", d.Timeout)
+	}
+	if d.SuperUserPromptRE == nil || !d.SuperUserPromptRE.MatchString("smb-1#") {
+		t.Errorf("want super user prompt to match smb-1#")
+	}
+	if d.SSHParams.Port != 22 {
+		t.Errorf("want ssh port 22, got %d", d.SSHParams.Port)
+	}
+}
+
+func TestNewPlatformDevice(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name     string
+		new      func(driver.NetDevice) driver.NetDevice
+		prompt   string
+		platform string
+	}
+	testCases := []testCase{
+		{name: "eos", new: driver.NewAristaEOSDevice, prompt: "veos-1#", platform: "eos"},
+		{name: "aoscx", new: driver.NewArubaAOSCXDevice, prompt: "aoscx-1# ", platform: "aoscx"},
+		{name: "aireos", new: driver.NewCiscoAireOSDevice, prompt: "(Cisco Controller) >", platform: "aireos"},
+		{name: "asa", new: driver.NewCiscoASADevice, prompt: "asa-1# ", platform: "asa"},
+		{name: "ios", new: driver.NewCiscoIOSDevice, prompt: "router#", platform: "ios"},
+		{name: "iosxr", new: driver.NewCiscoIOSXRDevice, prompt: "RP/0/0/CPU0:iosxr-1#", platform: "iosxr"},
+		{name: "nxos", new: driver.NewCiscoNXOSDevice, prompt: "nxos-1# ", platform: "nxos"},
+		{name: "smb", new: driver.NewCiscoSMBDevice, prompt: "smb-1#", platform: "smb"},
+		{name: "junos", new: driver.NewJuniperJunosDevice, prompt: "admin@vmx-1> ", platform: "junos"},
+	}
+
+	for _, tc := range testCases {
+		d := tc.new(driver.NetDevice{Name: tc.name})
+		if d.Driver == nil || d.Platform != tc.platform {
+			t.Errorf("%s: want the %s driver, got %v %s", tc.name, tc.platform, d.Driver, d.Platform)
+			continue
+		}
+		if !d.SuperUserPromptRE.MatchString(tc.prompt) {
+			t.Errorf("%s: want the super user prompt to match %q", tc.name, tc.prompt)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// eapiPath is the path of Arista's eAPI.
+const eapiPath = "/command-api"
+
+// eapiRequest is a JSON-RPC request of the runCmds method.
+type eapiRequest struct {
+	JSONRPC string     `json:"jsonrpc"`
+	Method  string     `json:"method"`
+	Params  eapiParams `json:"params"`
+	ID      string     `json:"id"`
+}
+
+type eapiParams struct {
+	Version int `json:"version"`
+	// Cmds are command strings or eapiCommands.
+	Cmds   []interface{} `json:"cmds"`
+	Format string        `json:"format"`
+}
+
+// eapiCommand is a command that is answered with input.
+// EG: enable with a password
+type eapiCommand struct {
+	Cmd   string `json:"cmd"`
+	Input string `json:"input"`
+}
+
+type eapiResponse struct {
+	Result []json.RawMessage `json:"result"`
+	Error  *EAPIError        `json:"error"`
+}
+
+// EAPIError is a JSON-RPC error returned by eAPI.
+type EAPIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Data holds the output of the commands that ran,
+	// up to and including the command that failed.
+	Data []eapiData `json:"data"`
+}
+
+type eapiData struct {
+	Output string   `json:"output"`
+	Errors []string `json:"errors"`
+}
+
+func (e *EAPIError) Error() string {
+	for _, d := range e.Data {
+		if len(d.Errors) > 0 {
+			return strings.Join(d.Errors, ", ")
+		}
+	}
+	return e.Message
+}
+
+// eapi runs commands with Arista's eAPI.
+type eapi struct {
+	d      *NetDevice
+	client *http.Client
+}
+
+// run runs commands after enable in a format, text or json,
+// and returns the output of each of the commands.
+func (a *eapi) run(ctx context.Context, cmds []string, format string) ([]json.RawMessage, error) {
+	var enable interface{} = "enable"
+	if a.d.SuperPassword != "" {
+		enable = eapiCommand{Cmd: "enable", Input: a.d.SuperPassword}
+	}
+	req := eapiRequest{
+		JSONRPC: "2.0",
+		Method:  "runCmds",
+		Params:  eapiParams{Version: 1, Cmds: []interface{}{enable}, Format: format},
+		ID:      fmt.Sprintf("jato-%d", time.Now().UnixNano()),
+	}
+	for _, cmd := range cmds {
+		req.Params.Cmds = append(req.Params.Cmds, cmd)
+	}
+
+	var resp eapiResponse
+	if err := postJSON(ctx, a.client, a.d.Credentials, a.d.apiURL(eapiPath), "application/json", req, &resp); err != nil {
+		return nil, fmt.Errorf("eapi: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	if len(resp.Result) != len(req.Params.Cmds) {
+		return nil, fmt.Errorf("eapi: want %d results, got %d", len(req.Params.Cmds), len(resp.Result))
+	}
+	return resp.Result[1:], nil
+}
+
+// command runs a command in the text format, show commands are
+// run in the json format too. Commands without structured
+// output are returned as text.
+func (a *eapi) command(ctx context.Context, cmd string) (data.CommandOutput, error) {
+	c := data.CommandOutput{Command: cmd}
+
+	res, err := a.run(ctx, []string{cmd}, "text")
+	var eapiErr *EAPIError
+	if errors.As(err, &eapiErr) {
+		c.Failed = true
+		c.Error = eapiErr.Error()
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	var text eapiData
+	if err := json.Unmarshal(res[0], &text); err != nil {
+		return c, fmt.Errorf("eapi: invalid output: %v", err)
+	}
+	c.Output = text.Output
+	if !showCommand(cmd) {
+		return c, nil
+	}
+
+	res, err = a.run(ctx, []string{cmd}, "json")
+	if errors.As(err, &eapiErr) {
+		// EG: 1003 the command has no JSON output
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	c.JSON = res[0]
+	return c, nil
+}
+
+// reads reports whether a command only reads from the device.
+func (a *eapi) reads(cmd string) bool {
+	return showCommand(cmd)
+}
+
+// config sends configuration lines between configure and end in a
+// single request. The lines after a line that fails are not run.
+func (a *eapi) config(ctx context.Context, lines []string) ([]data.CommandOutput, error) {
+	cmds := append([]string{"configure"}, lines...)
+	cmds = append(cmds, "end")
+
+	cmdOut := []data.CommandOutput{}
+	res, err := a.run(ctx, cmds, "text")
+	var eapiErr *EAPIError
+	ok := errors.As(err, &eapiErr)
+	if err != nil && !ok {
+		return cmdOut, err
+	}
+
+	// The outputs of the commands that ran, after enable's
+	var outputs []eapiData
+	if ok {
+		if len(eapiErr.Data) > 0 {
+			outputs = eapiErr.Data[1:]
+		}
+	} else {
+		outputs = make([]eapiData, len(res))
+		for i, r := range res {
+			json.Unmarshal(r, &outputs[i])
+		}
+	}
+
+	for i, line := range lines {
+		if i+1 >= len(outputs) {
+			break
+		}
+		o := outputs[i+1]
+		c := data.CommandOutput{Command: line, CommandU: util.Underscorer(line), Output: o.Output}
+		if len(o.Errors) > 0 {
+			c.Failed = true
+			c.Error = strings.Join(o.Errors, ", ")
+		}
+		cmdOut = append(cmdOut, c)
+	}
+	if err := configError(cmdOut); err != nil {
+		return cmdOut, err
+	}
+	if ok {
+		return cmdOut, eapiErr
+	}
+	return cmdOut, nil
+}
+
+// RunWithEAPI is the entrypoint to run a job with Arista's eAPI.
+func RunWithEAPI(ctx context.Context, nd NetDevice, job Job) data.Result {
+	api, err := nd.newEAPI()
+	if err != nil {
+		return data.Result{
+			Device:    nd.Name,
+			Error:     err,
+			Timestamp: time.Now().Unix(),
+		}
+	}
+	return runAPIJob(ctx, &nd, job, api)
+}
+
+func (d *NetDevice) newEAPI() (*eapi, error) {
+	if err := supports(d, "eapi"); err != nil {
+		return nil, err
+	}
+	InitHTTPParams(&d.HTTPParams)
+	client, err := httpClient(d.HTTPParams)
+	if err != nil {
+		return nil, err
+	}
+	return &eapi{d: d, client: client}, nil
+}
@@ -0,0 +1,349 @@
+package driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// fakeEAPI answers runCmds requests like the eAPI of
+// an Arista EOS device. It records the commands it runs.
+type fakeEAPI struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (f *fakeEAPI) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.cmds...)
+}
+
+func (f *fakeEAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/command-api" {
+		http.NotFound(w, r)
+		return
+	}
+	var req struct {
+		ID     string `json:"id"`
+		Params struct {
+			Cmds   []json.RawMessage `json:"cmds"`
+			Format string            `json:"format"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var results []interface{}
+	for _, raw := range req.Params.Cmds {
+		var cmd string
+		if json.Unmarshal(raw, &cmd) != nil {
+			var c struct {
+				Cmd   string `json:"cmd"`
+				Input string `json:"input"`
+			}
+			json.Unmarshal(raw, &c)
+			cmd = c.Cmd + " " + c.Input
+		}
+		f.mu.Lock()
+		f.cmds = append(f.cmds, req.Params.Format+":"+cmd)
+		f.mu.Unlock()
+
+		var result interface{}
+		errs := []string{}
+		switch {
+		case cmd == "show version" && req.Params.Format == "json":
+			result = map[string]interface{}{"modelName": "vEOS", "version": "4.26.1F"}
+		case cmd == "show version":
+			result = map[string]string{"output": "Arista vEOS\nSoftware image version: 4.26.1F\n"}
+		case cmd == "show running-config" && req.Params.Format == "json":
+			errs = append(errs, "Command not converted to JSON")
+		case strings.HasPrefix(cmd, "bad"):
+			errs = append(errs, "% Invalid input (at token 0: 'bad')")
+		case req.Params.Format == "json":
+			result = map[string]interface{}{}
+		default:
+			result = map[string]string{"output": ""}
+			if cmd == "show running-config" {
+				result = map[string]string{"output": "hostname veos-1\n"}
+			}
+		}
+		if len(errs) > 0 {
+			// The data of an error holds the outputs
+			// of the commands that ran and the error
+			data := append(results, map[string][]string{"errors": errs})
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"jsonrpc": "2.0", "id": req.ID,
+				"error": map[string]interface{}{"code": 1002, "message": "CLI command failed", "data": data},
+			})
+			return
+		}
+		results = append(results, result)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": results})
+}
+
+func TestRunWithEAPI(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name     string
+		job      driver.Job
+		creds    data.Credentials
+		wantOK   bool
+		wantErr  string
+		wantCmds []string
+		check    func(t *testing.T, result data.Result)
+	}
+	testCases := []testCase{
+		{
+			name:   "commands",
+			job:    driver.Job{Commands: []string{"show version", "show running-config"}},
+			wantOK: true,
+			wantCmds: []string{
+				"text:enable", "text:show version", "json:enable", "json:show version",
+				"text:enable", "text:show running-config", "json:enable", "json:show running-config",
+			},
+			check: func(t *testing.T, result data.Result) {
+				version := result.CommandOutputs[0]
+				if !strings.Contains(version.Output, "4.26.1F") || version.CommandU != "show_version" {
+					t.Errorf("want the text output, got %+v", version)
+				}
+				var v struct{ ModelName string }
+				if err := json.Unmarshal(version.JSON, &v); err != nil || v.ModelName != "vEOS" {
+					t.Errorf("want the JSON output, got %s", version.JSON)
+				}
+				config := result.CommandOutputs[1]
+				if config.Output != "hostname veos-1\n" || config.JSON != nil {
+					t.Errorf("want text output only, got %+v", config)
+				}
+			},
+		},
+		{
+			// Commands that change the device are sent once
+			name:     "commands that are not show commands",
+			job:      driver.Job{Commands: []string{"clear counters", "write memory"}},
+			wantOK:   true,
+			wantCmds: []string{"text:enable", "text:clear counters", "text:enable", "text:write memory"},
+		},
+		{
+			name:     "enable password",
+			job:      driver.Job{Commands: []string{"show clock"}},
+			creds:    data.Credentials{SuperPassword: "enable-secret"},
+			wantOK:   true,
+			wantCmds: []string{"text:enable enable-secret", "text:show clock", "json:enable enable-secret", "json:show clock"},
+		},
+		{
+			name:     "skip on error",
+			job:      driver.Job{Commands: []string{"bad command", "show clock"}, OnError: driver.SkipOnError},
+			wantErr:  "Invalid input",
+			wantCmds: []string{"text:enable", "text:bad command"},
+			check: func(t *testing.T, result data.Result) {
+				if len(result.CommandOutputs) != 1 || !result.CommandOutputs[0].Failed {
+					t.Errorf("want the command marked failed, got %+v", result.CommandOutputs)
+				}
+			},
+		},
+		{
+			name:     "continue on error",
+			job:      driver.Job{Commands: []string{"bad command", "show clock"}},
+			wantErr:  "Invalid input",
+			wantCmds: []string{"text:enable", "text:bad command", "text:enable", "text:show clock", "json:enable", "json:show clock"},
+		},
+		{
+			name:     "config",
+			job:      driver.Job{Config: []string{"hostname veos-1"}, Commands: []string{"show clock"}},
+			wantOK:   true,
+			wantCmds: []string{"text:enable", "text:configure", "text:hostname veos-1", "text:end", "text:enable", "text:show clock", "json:enable", "json:show clock"},
+		},
+		{
+			name:     "config error",
+			job:      driver.Job{Config: []string{"hostname veos-1", "bad line", "ip routing"}, Commands: []string{"show clock"}},
+			wantErr:  "configuration errors: 'bad line': % Invalid input (at token 0: 'bad')",
+			wantCmds: []string{"text:enable", "text:configure", "text:hostname veos-1", "text:bad line"},
+			check: func(t *testing.T, result data.Result) {
+				var configErr *driver.ConfigError
+				if !errors.As(result.Error, &configErr) {
+					t.Errorf("want a *driver.ConfigError, got %v", result.Error)
+				}
+				if len(result.CommandOutputs) != 2 {
+					t.Errorf("want the lines that ran, got %+v", result.CommandOutputs)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeEAPI{}
+			srv := newFakeAPIServer(t, api.ServeHTTP)
+			tc.creds.Username, tc.creds.Password = "admin", "secret"
+			d := newAPIDevice(t, srv, "arista", "eos", "eapi", driver.HTTPParams{CAFile: apiCAFile(t, srv)}, tc.creds)
+
+			result := driver.Run(context.Background(), d, tc.job)
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			if tc.wantErr != "" && (result.Error == nil || !strings.Contains(result.Error.Error(), tc.wantErr)) {
+				t.Errorf("want error %q, got %v", tc.wantErr, result.Error)
+			}
+			got := strings.Join(api.received(), "|")
+			want := strings.Join(tc.wantCmds, "|")
+			if got != want {
+				t.Errorf("want commands %s, got %s", want, got)
+			}
+			if tc.check != nil {
+				tc.check(t, result)
+			}
+		})
+	}
+}
+
+func TestRunWithEAPIConnection(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name    string
+		params  func(t *testing.T, caFile string) driver.HTTPParams
+		pass    string
+		wantErr string
+	}
+	testCases := []testCase{
+		{
+			name:   "insecure",
+			params: func(t *testing.T, _ string) driver.HTTPParams { return driver.HTTPParams{InsecureSkipVerify: true} },
+			pass:   "secret",
+		},
+		{
+			name:    "unknown authority",
+			params:  func(t *testing.T, _ string) driver.HTTPParams { return driver.HTTPParams{} },
+			pass:    "secret",
+			wantErr: "certificate",
+		},
+		{
+			name: "server name",
+			params: func(t *testing.T, ca string) driver.HTTPParams {
+				return driver.HTTPParams{CAFile: ca, ServerName: "veos-1"}
+			},
+			pass:    "secret",
+			wantErr: "certificate",
+		},
+		{
+			name:    "unauthorized",
+			params:  func(t *testing.T, _ string) driver.HTTPParams { return driver.HTTPParams{InsecureSkipVerify: true} },
+			pass:    "wrong",
+			wantErr: "eapi: http: 401 Unauthorized: Unauthorized",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newFakeAPIServer(t, (&fakeEAPI{}).ServeHTTP)
+			creds := data.Credentials{Username: "admin", Password: tc.pass}
+			d := newAPIDevice(t, srv, "arista", "eos", "eapi", tc.params(t, apiCAFile(t, srv)), creds)
+
+			result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+			if tc.wantErr == "" {
+				if !result.OK {
+					t.Errorf("want OK, got %v", result.Error)
+				}
+				return
+			}
+			if result.Error == nil || !strings.Contains(result.Error.Error(), tc.wantErr) {
+				t.Errorf("want error %q, got %v", tc.wantErr, result.Error)
+			}
+			var httpErr *driver.HTTPError
+			if tc.pass == "wrong" && (!errors.As(result.Error, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized) {
+				t.Errorf("want a *driver.HTTPError, got %v", result.Error)
+			}
+		})
+	}
+}
+
+func TestRunWithEAPINotSupported(t *testing.T) {
+	t.Parallel()
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "eapi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "does not support connector: eapi") {
+		t.Errorf("want eapi not supported, got %v", result.Error)
+	}
+}
+
+func TestRunWithEAPIRetries(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name     string
+		command  string
+		wantOK   bool
+		wantCmds []string
+	}
+	testCases := []testCase{
+		{
+			name:     "show command",
+			command:  "show version",
+			wantOK:   true,
+			wantCmds: []string{"text:enable", "text:show version", "json:enable", "json:show version"},
+		},
+		{
+			name:    "not retried",
+			command: "write memory",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			// The connection of the first request is dropped
+			api := &fakeEAPI{}
+			var dropped int32
+			srv := newFakeAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&dropped, 1) == 1 {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err == nil {
+						conn.Close()
+					}
+					return
+				}
+				api.ServeHTTP(w, r)
+			})
+			creds := data.Credentials{Username: "admin", Password: "secret"}
+			d := newAPIDevice(t, srv, "arista", "eos", "eapi", driver.HTTPParams{CAFile: apiCAFile(t, srv)}, creds)
+
+			job := driver.Job{
+				Commands:     []string{tc.command},
+				CommandRetry: driver.RetryPolicy{Attempts: 2, Backoff: time.Millisecond},
+			}
+			result := driver.Run(context.Background(), d, job)
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			if !tc.wantOK && result.Failure != string(driver.FailureDial) {
+				t.Errorf("want failure %q, got %q: %v", driver.FailureDial, result.Failure, result.Error)
+			}
+			got := strings.Join(api.received(), "|")
+			want := strings.Join(tc.wantCmds, "|")
+			if got != want {
+				t.Errorf("want commands %s, got %s", want, got)
+			}
+		})
+	}
+}
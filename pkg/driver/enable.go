@@ -0,0 +1,92 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/automatico/jato/pkg/constant"
+)
+
+// ErrEnableFailed is returned when a session at a user prompt
+// can not be escalated to a super user prompt.
+var ErrEnableFailed = errors.New("enable failed")
+
+// Enabler is implemented by drivers of platforms that escalate
+// from a user prompt to a super user prompt with a command.
+type Enabler interface {
+	// EnableCommand returns the command that escalates
+	// the session. EG: enable
+	EnableCommand() string
+}
+
+// sendFunc writes a command to a session and reads
+// the output until expect is matched.
+type sendFunc func(ctx context.Context, cmd string, expect *regexp.Regexp) (string, error)
+
+// anyPromptRE matches either a user or a super user prompt.
+func anyPromptRE(d *NetDevice) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?:%s)|(?:%s)`, d.UserPromptRE, d.SuperUserPromptRE))
+}
+
+// lastLine returns the last line of the output,
+// which holds the prompt the device is waiting at.
+func lastLine(s string) string {
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// atUserPrompt reports whether the output ends
+// with a user prompt rather than a super user prompt.
+func atUserPrompt(d *NetDevice, out string) bool {
+	line := lastLine(out)
+	return !d.SuperUserPromptRE.MatchString(line) && d.UserPromptRE.MatchString(line)
+}
+
+// enable escalates a session that logged in to a user prompt
+// with the driver's enable command and the super password.
+// out is the output read after login.
+func enable(ctx context.Context, d *NetDevice, drv Driver, out string, send sendFunc) error {
+
+	if !atUserPrompt(d, out) {
+		return nil
+	}
+
+	enabler, ok := drv.(Enabler)
+	if !ok || enabler.EnableCommand() == "" {
+		return nil
+	}
+
+	if d.SuperPassword == "" {
+		return fmt.Errorf("%w: a super password is required to leave the user prompt", ErrEnableFailed)
+	}
+
+	prompts := regexp.MustCompile(fmt.Sprintf(`(?:%s)|(?:%s)`, constant.EnablePasswordRE, anyPromptRE(d)))
+
+	ctx, cancel := d.commandContext(ctx)
+	defer cancel()
+
+	out, err := send(ctx, enabler.EnableCommand(), prompts)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEnableFailed, err)
+	}
+
+	// Some devices do not ask for a password
+	if constant.EnablePasswordRE.MatchString(lastLine(out)) {
+		out, err = send(ctx, d.SuperPassword, prompts)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrEnableFailed, err)
+		}
+	}
+
+	line := lastLine(out)
+	switch {
+	case d.SuperUserPromptRE.MatchString(line):
+		return nil
+	case constant.EnablePasswordRE.MatchString(line):
+		return fmt.Errorf("%w: the super password was rejected", ErrEnableFailed)
+	default:
+		return fmt.Errorf("%w: %s", ErrEnableFailed, strings.TrimSpace(out))
+	}
+}
@@ -0,0 +1,71 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// iosLogin answers a Telnet login to a Cisco IOS user prompt.
+func iosLogin(secret string) func(line string) string {
+	enabled := false
+	enabling := false
+	return func(line string) string {
+		prompt := "\r\nrouter>"
+		switch {
+		case enabling:
+			enabling = false
+			enabled = line == secret
+			if !enabled {
+				return "\r\n% Bad secrets\r\n\r\nrouter>"
+			}
+		case line == "admin":
+			return "\r\nPassword:"
+		case line == "enable":
+			enabling = true
+			return "\r\nPassword: "
+		}
+		if enabled {
+			prompt = "\r\nrouter#"
+		}
+		return prompt
+	}
+}
+
+func TestEnableWithTelnet(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		superPassword string
+		wantErr       error
+	}
+	testCases := []testCase{
+		{superPassword: "secret", wantErr: nil},
+		{superPassword: "wrong", wantErr: driver.ErrEnableFailed},
+		{superPassword: "", wantErr: driver.ErrEnableFailed},
+	}
+
+	for _, tc := range testCases {
+		fd := newFakeDevice(t, "\r\nUsername: ", iosLogin("secret"))
+
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+			TelnetParams: driver.TelnetParams{Port: fd.port()},
+			Credentials:  data.Credentials{Username: "admin", Password: "cisco", SuperPassword: tc.superPassword},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = d.ConnectWithTelnet(context.Background())
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("super password %q: want %v, got %v", tc.superPassword, tc.wantErr, err)
+		}
+		if err == nil {
+			d.DisconnectTelnet()
+		}
+	}
+
+}
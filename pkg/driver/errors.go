@@ -0,0 +1,53 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/automatico/jato/pkg/data"
+)
+
+// TimeoutError is returned when a device does not respond
+// with an expected prompt before the deadline of a context.
+type TimeoutError struct {
+	Expect *regexp.Regexp
+	// Output is what was read before the deadline.
+	Output string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout waiting for: '%s'", e.Expect)
+}
+
+// Timeout reports that the error is a timeout.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Unwrap allows errors.Is(err, context.DeadlineExceeded)
+// to identify a TimeoutError.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// CommandError is returned when a device reports
+// errors for one or more commands of a job.
+type CommandError struct {
+	Failed []data.CommandOutput
+	// Aborted is set when the job was abandoned
+	// under the AbortOnError policy.
+	Aborted bool
+}
+
+func (e *CommandError) Error() string {
+	msgs := []string{}
+	for _, c := range e.Failed {
+		msgs = append(msgs, fmt.Sprintf("'%s': %s", c.Command, c.Error))
+	}
+	if e.Aborted {
+		return fmt.Sprintf("aborted on command errors: %s", strings.Join(msgs, ", "))
+	}
+	return fmt.Sprintf("command errors: %s", strings.Join(msgs, ", "))
+}
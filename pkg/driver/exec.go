@@ -0,0 +1,177 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/automatico/jato/pkg/data"
+	"golang.org/x/crypto/ssh"
+)
+
+// Execer is implemented by drivers of platforms that run a
+// command passed to SSH, EG: ssh switch "show version". The
+// commands of a job are then run on their own exec channels
+// instead of being typed into an interactive shell.
+type Execer interface {
+	// ExecCommands reports whether commands
+	// are run on exec channels.
+	ExecCommands() bool
+}
+
+// errExecRefused is returned when a device refuses
+// to run a command on an exec channel.
+var errExecRefused = errors.New("exec: refused")
+
+// execs reports whether a job's commands are run on exec channels,
+// the device or its platform opt in. Config, commits and expect
+// steps need the interactive shell.
+func execs(d *NetDevice, job Job) bool {
+	if len(job.Config) > 0 || len(job.Expect) > 0 || len(job.Commands) == 0 {
+		return false
+	}
+	if d.SSHParams.Exec {
+		return true
+	}
+	drv, err := d.driver()
+	if err != nil {
+		return false
+	}
+	e, ok := drv.(Execer)
+	return ok && e.ExecCommands()
+}
+
+// execCommand runs a command on an exec channel of client and
+// returns its output. A command that exits with an error status
+// returns an *ssh.ExitError with the output.
+func execCommand(ctx context.Context, client *ssh.Client, cmd string) (string, error) {
+	session, err := newSession(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	stop := closeOnDone(ctx, session)
+	out, err := session.CombinedOutput(cmd)
+	stop()
+	return string(out), contextError(ctx, err)
+}
+
+// isExitError reports whether err is the
+// exit status of a command that ran.
+func isExitError(err error) bool {
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	return errors.As(err, &exitErr) || errors.As(err, &missingErr)
+}
+
+// execRefused reports whether err is a device refusing to open
+// an exec channel or to run a command on it, rather than a
+// failure to reach it. A refused exec request has no error type.
+func execRefused(err error) bool {
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		return true
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "ssh: command ") && strings.HasSuffix(msg, " failed")
+}
+
+// sshExec runs commands on exec channels.
+type sshExec struct {
+	d    *NetDevice
+	exec func(ctx context.Context, cmd string) (string, error)
+	// ran is set once a command has run, a device that
+	// refuses the first command does not support exec.
+	ran bool
+}
+
+// command runs a command, an error status or a match of the
+// driver's error patterns marks it as failed.
+func (e *sshExec) command(ctx context.Context, cmd string) (data.CommandOutput, error) {
+	c := data.CommandOutput{Command: cmd}
+	out, err := e.exec(ctx, cmd)
+
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	switch {
+	case errors.As(err, &exitErr):
+		c.ExitStatus = exitErr.ExitStatus()
+	case errors.As(err, &missingErr):
+		// EG: the device closes the channel without a status
+	case err != nil && !e.ran && execRefused(err):
+		return c, fmt.Errorf("%w: %v", errExecRefused, err)
+	case err != nil:
+		return c, err
+	}
+	e.ran = true
+
+	c.Output = out
+	markError(e.d, &c)
+	if c.ExitStatus != 0 && !c.Failed {
+		c.Failed = true
+		c.Error = fmt.Sprintf("exit status %d", c.ExitStatus)
+		// EG: the error the command printed before it exited
+		if line := strings.TrimSpace(lastLine(strings.TrimSpace(out))); line != "" {
+			c.Error = line
+		}
+	}
+	return c, nil
+}
+
+// reads reports whether a command only reads from the device.
+func (e *sshExec) reads(cmd string) bool {
+	return showCommand(cmd)
+}
+
+// config is not run on exec channels.
+func (e *sshExec) config(ctx context.Context, lines []string) ([]data.CommandOutput, error) {
+	return nil, errors.New("exec: config is sent in the interactive shell")
+}
+
+// runWithExec runs a job's commands on exec channels. It
+// reports false when the device refuses exec channels,
+// the job is then run in the interactive shell.
+func runWithExec(ctx context.Context, d *NetDevice, job Job) (data.Result, bool) {
+	e := &sshExec{d: d}
+	if d.SSHManager != nil {
+		err := retry(ctx, job.Retry, func() error {
+			_, err := d.SSHManager.Client(ctx, d)
+			return err
+		})
+		if err != nil {
+			return newResult(d.Name, nil, err), true
+		}
+		e.exec = func(ctx context.Context, cmd string) (string, error) {
+			return d.SSHManager.Exec(ctx, d, cmd)
+		}
+	} else {
+		clientConfig, err := SSHClientConfig(d.Credentials, d.SSHParams)
+		if err != nil {
+			return newResult(d.Name, nil, err), true
+		}
+		var client *ssh.Client
+		err = retry(ctx, job.Retry, func() error {
+			dial, err := jumpHosts.dialer(ctx, d.SSHParams.Proxy, d.SSHParams.JumpHosts, d.Credentials)
+			if err != nil {
+				return err
+			}
+			client, err = dialSSHClient(ctx, dial, fmt.Sprintf("%s:%d", d.IP, d.SSHParams.Port), clientConfig)
+			return err
+		})
+		if err != nil {
+			return newResult(d.Name, nil, err), true
+		}
+		defer client.Close()
+		e.exec = func(ctx context.Context, cmd string) (string, error) {
+			return execCommand(ctx, client, cmd)
+		}
+	}
+
+	result := runAPIJob(ctx, d, job, e)
+	if errors.Is(result.Error, errExecRefused) {
+		return result, false
+	}
+	return result, true
+}
@@ -0,0 +1,215 @@
+package driver_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// eosShell answers an SSH shell at an Arista EOS super
+// user prompt and the configuration mode commands.
+func eosShell() func(line string) string {
+	mode := ""
+	return func(line string) string {
+		switch line {
+		case "configure terminal":
+			mode = "(config)"
+		case "end":
+			mode = ""
+		}
+		return "\r\nveos-1" + mode + "#"
+	}
+}
+
+// eosExec answers commands run on exec channels like Arista EOS.
+func eosExec(cmd string) (string, uint32) {
+	switch cmd {
+	case "show version":
+		return "Arista vEOS\nSoftware image version: 4.26.1F\n", 0
+	case "show bogus":
+		return "% Invalid input (at token 1: 'bogus')\n", 0
+	case "bash false":
+		return "bash: running false\nexit code 1\n", 1
+	}
+	return "", 0
+}
+
+func TestRunWithSSHExec(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name       string
+		platform   string
+		vendor     string
+		job        driver.Job
+		exec       bool
+		refuseExec bool
+		dropExec   bool
+		wantOK     bool
+		wantExecs  []string
+		wantShells int
+		check      func(t *testing.T, result data.Result)
+	}
+	testCases := []testCase{
+		{
+			name:      "commands",
+			vendor:    "arista",
+			platform:  "eos",
+			exec:      true,
+			job:       driver.Job{Commands: []string{"show version", "show clock"}},
+			wantOK:    true,
+			wantExecs: []string{"show version", "show clock"},
+			check: func(t *testing.T, result data.Result) {
+				c := result.CommandOutputs[0]
+				if c.Output != "Arista vEOS\nSoftware image version: 4.26.1F\n" || c.CommandU != "show_version" {
+					t.Errorf("want the output of the command only, got %+v", c)
+				}
+			},
+		},
+		{
+			name:      "error pattern",
+			vendor:    "arista",
+			platform:  "eos",
+			exec:      true,
+			job:       driver.Job{Commands: []string{"show bogus", "show version"}},
+			wantExecs: []string{"show bogus", "show version"},
+			check: func(t *testing.T, result data.Result) {
+				c := result.CommandOutputs[0]
+				if !c.Failed || c.Error != "% Invalid input (at token 1: 'bogus')" {
+					t.Errorf("want the command marked failed, got %+v", c)
+				}
+			},
+		},
+		{
+			name:      "exit status",
+			vendor:    "arista",
+			platform:  "eos",
+			exec:      true,
+			job:       driver.Job{Commands: []string{"bash false", "show version"}, OnError: driver.SkipOnError},
+			wantExecs: []string{"bash false"},
+			check: func(t *testing.T, result data.Result) {
+				c := result.CommandOutputs[0]
+				if !c.Failed || c.ExitStatus != 1 || c.Error != "exit code 1" {
+					t.Errorf("want the command marked failed with its exit status, got %+v", c)
+				}
+			},
+		},
+		{
+			name:       "exec refused",
+			vendor:     "arista",
+			platform:   "eos",
+			job:        driver.Job{Commands: []string{"show version"}},
+			exec:       true,
+			refuseExec: true,
+			wantOK:     true,
+			wantShells: 1,
+		},
+		{
+			name:     "exec failed",
+			vendor:   "arista",
+			platform: "eos",
+			job:      driver.Job{Commands: []string{"show version"}},
+			exec:     true,
+			dropExec: true,
+		},
+		{
+			name:       "exec not enabled",
+			vendor:     "arista",
+			platform:   "eos",
+			job:        driver.Job{Commands: []string{"show version"}},
+			wantOK:     true,
+			wantShells: 1,
+		},
+		{
+			name:       "config",
+			vendor:     "arista",
+			platform:   "eos",
+			job:        driver.Job{Config: []string{"hostname veos-1"}, Commands: []string{"show version"}},
+			wantOK:     true,
+			wantShells: 1,
+		},
+		{
+			name:       "shell platform",
+			vendor:     "cisco",
+			platform:   "ios",
+			job:        driver.Job{Commands: []string{"show version"}},
+			wantOK:     true,
+			wantShells: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			shell := eosShell()
+			if tc.platform == "ios" {
+				shell = iosShell
+			}
+			fs := listenFakeSSHServer(t, passwordConfig("admin", "arista"), "\r\nveos-1#", shell)
+			fs.exec = eosExec
+			fs.refuseExec = tc.refuseExec
+			fs.dropExec = tc.dropExec
+			if tc.platform == "ios" {
+				fs.banner = "\r\nrouter#"
+			}
+			go fs.serve()
+
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "veos-1", IP: "127.0.0.1", Vendor: tc.vendor, Platform: tc.platform, Connector: "ssh",
+				SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true, Exec: tc.exec},
+				Credentials: data.Credentials{Username: "admin", Password: "arista"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := driver.Run(context.Background(), d, tc.job)
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			got := strings.Join(fs.execsReceived(), "|")
+			want := strings.Join(tc.wantExecs, "|")
+			if got != want {
+				t.Errorf("want exec commands %s, got %s", want, got)
+			}
+			if fs.shellsStarted() != tc.wantShells {
+				t.Errorf("want %d shells, got %d", tc.wantShells, fs.shellsStarted())
+			}
+			if tc.check != nil {
+				tc.check(t, result)
+			}
+		})
+	}
+}
+
+func TestRunWithSSHExecManager(t *testing.T) {
+	t.Parallel()
+	fs := listenFakeSSHServer(t, passwordConfig("admin", "arista"), "\r\nveos-1#", eosShell())
+	fs.exec = eosExec
+	go fs.serve()
+
+	m := &driver.SSHManager{}
+	defer m.Close()
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "veos-1", IP: "127.0.0.1", Vendor: "arista", Platform: "eos", Connector: "ssh",
+		SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true, Exec: true},
+		Credentials: data.Credentials{Username: "admin", Password: "arista"},
+		SSHManager:  m,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+		if !result.OK {
+			t.Fatalf("want OK, got %v", result.Error)
+		}
+	}
+	if fs.connections() != 1 || fs.shellsStarted() != 0 {
+		t.Errorf("want 1 connection and no shell, got %d and %d", fs.connections(), fs.shellsStarted())
+	}
+}
@@ -0,0 +1,127 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// ExpectStep is a command that is sent to a device and read
+// until Expect matches. Interactive prompts met on the way are
+// answered with the Response of the first Responses that matches.
+type ExpectStep struct {
+	Command string
+	// Expect matches the end of the step,
+	// nil expects the super user prompt.
+	Expect *regexp.Regexp
+	// Timeout in seconds for the whole step,
+	// 0 uses the device's timeout.
+	Timeout   int64
+	Responses []ExpectResponse
+}
+
+// ExpectResponse answers an interactive prompt.
+// EG: Destination filename [startup-config]?
+type ExpectResponse struct {
+	Prompt   *regexp.Regexp
+	Response string
+}
+
+// expectRE matches the end of a step or any of its prompts.
+func (s ExpectStep) expectRE(d *NetDevice) *regexp.Regexp {
+	res := []string{fmt.Sprintf("(?:%s)", s.expect(d))}
+	for _, r := range s.Responses {
+		res = append(res, fmt.Sprintf("(?:%s)", r.Prompt))
+	}
+	return regexp.MustCompile(strings.Join(res, "|"))
+}
+
+func (s ExpectStep) expect(d *NetDevice) *regexp.Regexp {
+	if s.Expect == nil {
+		return d.SuperUserPromptRE
+	}
+	return s.Expect
+}
+
+// response returns the response to the prompt the output
+// ends with. Prompts are matched against the last line.
+func (s ExpectStep) response(out string) (string, bool) {
+	line := lastLine(out)
+	for _, r := range s.Responses {
+		if r.Prompt.MatchString(line) {
+			return r.Response, true
+		}
+	}
+	return "", false
+}
+
+// runExpect sends a step's command and answers the prompts
+// met until the step's expect matches. The step's timeout
+// covers its command and all of its responses.
+func runExpect(ctx context.Context, d *NetDevice, step ExpectStep, send sendFunc) (string, error) {
+	timeout := step.Timeout
+	if timeout == 0 {
+		timeout = d.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	re := step.expectRE(d)
+	out, err := send(ctx, step.Command, re)
+	for err == nil {
+		response, ok := step.response(out)
+		if !ok {
+			break
+		}
+		var more string
+		more, err = send(ctx, response, re)
+		out += more
+	}
+	return out, err
+}
+
+// sendExpect runs expect steps against a device with a
+// connector's send function. Unless the policy is to continue,
+// the steps after a failed step are not run.
+func sendExpect(ctx context.Context, d *NetDevice, steps []ExpectStep, policy ErrorPolicy, send sendFunc) ([]data.CommandOutput, error) {
+
+	cmdOut := []data.CommandOutput{}
+
+	for _, step := range steps {
+		out, err := runExpect(ctx, d, step, send)
+		if err != nil {
+			return cmdOut, fmt.Errorf("%s: %w", step.Command, err)
+		}
+		c := data.CommandOutput{
+			Command:  step.Command,
+			CommandU: util.Underscorer(step.Command),
+			Output:   util.TruncateOutput(out),
+		}
+		markError(d, &c)
+		cmdOut = append(cmdOut, c)
+		if c.Failed && !continues(policy) {
+			break
+		}
+	}
+
+	return cmdOut, nil
+}
+
+// SendExpect runs expect steps against the
+// device with the device's connector.
+func (d NetDevice) SendExpect(ctx context.Context, steps []ExpectStep) data.Result {
+	send := d.sendSSH
+	if d.Connector == "telnet" {
+		send = d.sendTelnet
+	}
+	cmdOut, err := sendExpect(ctx, &d, steps, ContinueOnError, send)
+	if err == nil {
+		err = commandError(cmdOut, ContinueOnError)
+	}
+	return newResult(d.Name, cmdOut, err)
+}
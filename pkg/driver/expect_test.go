@@ -0,0 +1,107 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// iosCopy answers a Telnet login to a Cisco IOS super user
+// prompt and the interactive prompts of copy and reload.
+func iosCopy() func(line string) string {
+	step := ""
+	return func(line string) string {
+		switch {
+		case line == "admin":
+			return "\r\nPassword:"
+		case line == "copy running-config startup-config":
+			step = "copy"
+			return "\r\nDestination filename [startup-config]? "
+		case step == "copy":
+			step = ""
+			return "\r\nBuilding configuration...\r\n[OK]\r\nrouter#"
+		case line == "reload":
+			step = "save"
+			return "\r\nSystem configuration has been modified. Save? [yes/no]: "
+		case step == "save":
+			step = "reload"
+			return "\r\nProceed with reload? [confirm]"
+		case step == "reload":
+			step = ""
+			return "\r\n*Oct 18 10:00:00.000: %SYS-5-RELOAD: Reload requested by admin"
+		}
+		return "\r\nrouter#"
+	}
+}
+
+func TestSendExpectWithTelnet(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		step    driver.ExpectStep
+		want    string
+		wantErr error
+	}
+	testCases := []testCase{
+		{
+			step: driver.ExpectStep{
+				Command: "copy running-config startup-config",
+				Responses: []driver.ExpectResponse{
+					{Prompt: regexp.MustCompile(`\[startup-config\]\?`), Response: ""},
+				},
+			},
+			want: "[OK]",
+		},
+		{
+			step: driver.ExpectStep{
+				Command: "reload",
+				Expect:  regexp.MustCompile(`%SYS-5-RELOAD`),
+				Responses: []driver.ExpectResponse{
+					{Prompt: regexp.MustCompile(`\[yes/no\]:`), Response: "no"},
+					{Prompt: regexp.MustCompile(`\[confirm\]`), Response: ""},
+				},
+			},
+			want: "Proceed with reload? [confirm]",
+		},
+		{
+			step: driver.ExpectStep{
+				Command: "copy running-config startup-config",
+				Timeout: 1,
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		fd := newFakeDevice(t, "\r\nUsername: ", iosCopy())
+
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+			TelnetParams: driver.TelnetParams{Port: fd.port()},
+			Credentials:  data.Credentials{Username: "admin", Password: "cisco"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.ConnectWithTelnet(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		result := d.SendExpect(context.Background(), []driver.ExpectStep{tc.step})
+		d.DisconnectTelnet()
+
+		if !errors.Is(result.Error, tc.wantErr) {
+			t.Errorf("%s: want %v, got %v", tc.step.Command, tc.wantErr, result.Error)
+		}
+		if tc.wantErr != nil {
+			continue
+		}
+		if len(result.CommandOutputs) != 1 || !strings.Contains(result.CommandOutputs[0].Output, tc.want) {
+			t.Errorf("%s: want output containing %q, got %+v", tc.step.Command, tc.want, result.CommandOutputs)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package driver_test
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDevice is a line based device that answers each line it
+// receives with the output returned by respond. Telnet commands
+// it receives are recorded rather than read as lines.
+type fakeDevice struct {
+	ln      net.Listener
+	banner  string
+	respond func(line string) string
+
+	mu       sync.Mutex
+	commands []byte
+}
+
+func newFakeDevice(t *testing.T, banner string, respond func(line string) string) *fakeDevice {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &fakeDevice{ln: ln, banner: banner, respond: respond}
+	go fd.serve()
+	t.Cleanup(func() { ln.Close() })
+	return fd
+}
+
+func (fd *fakeDevice) port() int {
+	return fd.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (fd *fakeDevice) serve() {
+	for {
+		conn, err := fd.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			conn.Write([]byte(fd.banner))
+			s := bufio.NewScanner(&iacReader{r: bufio.NewReader(conn), fd: fd})
+			for s.Scan() {
+				line := strings.TrimRight(s.Text(), "\r")
+				conn.Write([]byte(fd.respond(line)))
+			}
+		}(conn)
+	}
+}
+
+// telnetCommands returns the Telnet commands the device received.
+func (fd *fakeDevice) telnetCommands() []byte {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return append([]byte{}, fd.commands...)
+}
+
+// iacReader reads the data of a Telnet connection, recording
+// the commands and subnegotiations it holds on the device.
+type iacReader struct {
+	r  *bufio.Reader
+	fd *fakeDevice
+}
+
+func (ir *iacReader) Read(p []byte) (int, error) {
+	for {
+		b, err := ir.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xff {
+			p[0] = b
+			return 1, nil
+		}
+		verb, err := ir.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		cmd := []byte{b, verb}
+		switch {
+		case verb == 0xff:
+			p[0] = verb
+			return 1, nil
+		case verb >= 251:
+			opt, err := ir.r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			cmd = append(cmd, opt)
+		case verb == 250:
+			for !bytes.HasSuffix(cmd, []byte{0xff, 240}) {
+				c, err := ir.r.ReadByte()
+				if err != nil {
+					return 0, err
+				}
+				cmd = append(cmd, c)
+			}
+		}
+		ir.fd.mu.Lock()
+		ir.fd.commands = append(ir.fd.commands, cmd...)
+		ir.fd.mu.Unlock()
+	}
+}
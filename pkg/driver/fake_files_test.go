@@ -0,0 +1,232 @@
+package driver_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// path maps a remote path, EG: flash:/image.bin, to
+// the file that holds it in the server's root.
+func (fs *fakeSSHServer) path(remote string) string {
+	if i := strings.Index(remote, ":"); i >= 0 {
+		remote = remote[i+1:]
+	}
+	return filepath.Join(fs.root, strings.TrimPrefix(remote, "/"))
+}
+
+// scp runs scp in sink, -t, or source, -f,
+// mode and returns its exit status.
+func (fs *fakeSSHServer) scp(ch ssh.Channel, cmd string) uint32 {
+	fields := strings.SplitN(cmd, " ", 3)
+	if len(fields) != 3 {
+		return 1
+	}
+	fields[2] = shellUnquote(fields[2])
+	fs.mu.Lock()
+	fs.execs = append(fs.execs, cmd)
+	fs.mu.Unlock()
+	name := fs.path(fields[2])
+	r := bufio.NewReader(ch)
+
+	switch fields[1] {
+	case "-t":
+		ch.Write([]byte{0})
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "C") {
+			return 1
+		}
+		parts := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		size, _ := strconv.ParseInt(parts[1], 10, 64)
+		f, err := os.Create(name)
+		if err != nil {
+			fmt.Fprintf(ch, "\x01scp: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		ch.Write([]byte{0})
+		if _, err := io.CopyN(f, r, size); err != nil {
+			return 1
+		}
+		if b, err := r.ReadByte(); err != nil || b != 0 {
+			return 1
+		}
+		ch.Write([]byte{0})
+		return 0
+	case "-f":
+		if b, err := r.ReadByte(); err != nil || b != 0 {
+			return 1
+		}
+		content, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(ch, "\x01scp: %s: No such file or directory\n", fields[2])
+			return 1
+		}
+		fmt.Fprintf(ch, "C0644 %d %s\n", len(content), filepath.Base(name))
+		if b, err := r.ReadByte(); err != nil || b != 0 {
+			return 1
+		}
+		ch.Write(content)
+		ch.Write([]byte{0})
+		r.ReadByte()
+		return 0
+	}
+	return 1
+}
+
+// shellUnquote removes the quotes and backslashes a
+// shell removes from a word. EG: 'a b'\'c' is a b'c
+func shellUnquote(s string) string {
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case c == '\\' && !quoted && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sftp serves the requests of an sftp
+// version 3 client until it disconnects.
+func (fs *fakeSSHServer) sftp(ch ssh.Channel) {
+	handles := map[string]*os.File{}
+	next := 0
+	defer func() {
+		for _, f := range handles {
+			f.Close()
+		}
+	}()
+
+	send := func(typ byte, id uint32, b []byte) {
+		p := make([]byte, 9, 9+len(b))
+		binary.BigEndian.PutUint32(p, uint32(5+len(b)))
+		p[4] = typ
+		binary.BigEndian.PutUint32(p[5:], id)
+		ch.Write(append(p, b...))
+	}
+	status := func(id, code uint32, msg string) {
+		b := appendUint32(nil, code)
+		b = appendString(b, msg)
+		b = appendString(b, "")
+		send(101, id, b)
+	}
+
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(ch, hdr[:]); err != nil {
+			return
+		}
+		p := make([]byte, binary.BigEndian.Uint32(hdr[:4])-1)
+		if _, err := io.ReadFull(ch, p); err != nil {
+			return
+		}
+		if hdr[4] == 1 {
+			// INIT
+			b := []byte{0, 0, 0, 5, 2, 0, 0, 0, 3}
+			ch.Write(b)
+			continue
+		}
+
+		id := binary.BigEndian.Uint32(p)
+		p = p[4:]
+		switch hdr[4] {
+		case 3:
+			// OPEN
+			name, rest := readString(p)
+			pflags := binary.BigEndian.Uint32(rest)
+			flags := os.O_RDONLY
+			if pflags&0x02 != 0 {
+				flags = os.O_WRONLY
+			}
+			if pflags&0x08 != 0 {
+				flags |= os.O_CREATE
+			}
+			if pflags&0x10 != 0 {
+				flags |= os.O_TRUNC
+			}
+			f, err := os.OpenFile(fs.path(name), flags, 0644)
+			if os.IsNotExist(err) {
+				status(id, 2, "No such file")
+				continue
+			}
+			if err != nil {
+				status(id, 4, err.Error())
+				continue
+			}
+			h := strconv.Itoa(next)
+			next++
+			handles[h] = f
+			send(102, id, appendString(nil, h))
+		case 4:
+			// CLOSE
+			h, _ := readString(p)
+			handles[h].Close()
+			delete(handles, h)
+			status(id, 0, "")
+		case 5:
+			// READ
+			h, rest := readString(p)
+			off := binary.BigEndian.Uint64(rest)
+			n := binary.BigEndian.Uint32(rest[8:])
+			b := make([]byte, n)
+			n2, err := handles[h].ReadAt(b, int64(off))
+			if n2 == 0 && err == io.EOF {
+				status(id, 1, "EOF")
+				continue
+			}
+			send(103, id, appendString(nil, string(b[:n2])))
+		case 6:
+			// WRITE
+			h, rest := readString(p)
+			off := binary.BigEndian.Uint64(rest)
+			b, _ := readString(rest[8:])
+			if _, err := handles[h].WriteAt([]byte(b), int64(off)); err != nil {
+				status(id, 4, err.Error())
+				continue
+			}
+			status(id, 0, "")
+		case 17:
+			// STAT
+			name, _ := readString(p)
+			fi, err := os.Stat(fs.path(name))
+			if err != nil {
+				status(id, 2, "No such file")
+				continue
+			}
+			b := appendUint32(nil, 0x01)
+			b = appendUint32(b, uint32(fi.Size()>>32))
+			b = appendUint32(b, uint32(fi.Size()))
+			send(105, id, b)
+		default:
+			status(id, 8, "unsupported")
+		}
+	}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte) {
+	n := binary.BigEndian.Uint32(b)
+	return string(b[4 : 4+n]), b[4+n:]
+}
@@ -0,0 +1,77 @@
+package driver_test
+
+import (
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// newFakeAPIServer starts an HTTPS server that answers the requests
+// of admin, authenticated with basic auth, with handler.
+func newFakeAPIServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}))
+	// Clients that refuse the certificate are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// apiPort returns the port a fake API server listens on.
+func apiPort(t *testing.T, srv *httptest.Server) int {
+	t.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// apiCAFile writes the certificate of a fake API
+// server to a file and returns the file's path.
+func apiCAFile(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newAPIDevice returns a device with a connector
+// to the HTTP API of a fake API server.
+func newAPIDevice(t *testing.T, srv *httptest.Server, vendor, platform, connector string, params driver.HTTPParams, creds data.Credentials) driver.NetDevice {
+	t.Helper()
+	params.Port = apiPort(t, srv)
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: platform + "-1", IP: "127.0.0.1", Vendor: vendor, Platform: platform, Connector: connector,
+		HTTPParams:  params,
+		Credentials: creds,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
@@ -0,0 +1,166 @@
+package driver_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeNetconf is a NETCONF server that answers each rpc with
+// the content of the rpc-reply returned by respond. It records
+// the operations it receives.
+type fakeNetconf struct {
+	capabilities []string
+	respond      func(op, rpc string) string
+
+	mu      sync.Mutex
+	ops     []string
+	chunked bool
+}
+
+// newFakeNetconfServer starts a fakeSSHServer with
+// a netconf subsystem served by nc.
+func newFakeNetconfServer(t *testing.T, nc *fakeNetconf) *fakeSSHServer {
+	t.Helper()
+	fs := listenFakeSSHServer(t, passwordConfig("admin", "secret"), "", nil)
+	fs.subsystems["netconf"] = nc.serve
+	go fs.serve()
+	return fs
+}
+
+func (nc *fakeNetconf) received() []string {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return append([]string{}, nc.ops...)
+}
+
+func (nc *fakeNetconf) usedChunks() bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.chunked
+}
+
+func (nc *fakeNetconf) serve(ch ssh.Channel) {
+	r := bufio.NewReader(ch)
+
+	caps := ""
+	for _, c := range nc.capabilities {
+		caps += "<capability>" + c + "</capability>"
+	}
+	fmt.Fprintf(ch, `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>%s</capabilities>`+
+		`<session-id>42</session-id></hello>]]>]]>`, caps)
+
+	hello, err := readEOM(r)
+	if err != nil {
+		return
+	}
+	chunked := strings.Contains(hello, "urn:ietf:params:netconf:base:1.1") &&
+		strings.Contains(caps, "urn:ietf:params:netconf:base:1.1")
+	nc.mu.Lock()
+	nc.chunked = chunked
+	nc.mu.Unlock()
+
+	for {
+		var msg string
+		if chunked {
+			msg, err = readChunks(r)
+		} else {
+			msg, err = readEOM(r)
+		}
+		if err != nil {
+			return
+		}
+		id, op := rpcOperation(msg)
+		nc.mu.Lock()
+		nc.ops = append(nc.ops, op)
+		nc.mu.Unlock()
+
+		content := "<ok/>"
+		if op != "close-session" && nc.respond != nil {
+			content = nc.respond(op, msg)
+		}
+		reply := fmt.Sprintf(`<rpc-reply message-id="%s" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">%s</rpc-reply>`, id, content)
+		if chunked {
+			// Split the reply to check it is reassembled
+			half := len(reply) / 2
+			fmt.Fprintf(ch, "\n#%d\n%s\n#%d\n%s\n##\n", half, reply[:half], len(reply)-half, reply[half:])
+		} else {
+			fmt.Fprintf(ch, "%s]]>]]>", reply)
+		}
+		if op == "close-session" {
+			return
+		}
+	}
+}
+
+// readEOM reads a message of the 1.0 framing.
+func readEOM(r *bufio.Reader) (string, error) {
+	var msg []byte
+	for !bytes.HasSuffix(msg, []byte("]]>]]>")) {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		msg = append(msg, b)
+	}
+	return string(msg[:len(msg)-6]), nil
+}
+
+// readChunks reads a message of the chunked framing.
+func readChunks(r *bufio.Reader) (string, error) {
+	var msg []byte
+	for {
+		if _, err := r.Discard(2); err != nil {
+			return "", err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "#" {
+			return string(msg), nil
+		}
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return "", err
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return "", err
+		}
+		msg = append(msg, chunk...)
+	}
+}
+
+// rpcOperation returns the message-id of an rpc and
+// the name of its operation. EG: get-config
+func rpcOperation(msg string) (string, string) {
+	d := xml.NewDecoder(strings.NewReader(msg))
+	id := ""
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return id, ""
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			if se.Name.Local == "rpc" {
+				for _, a := range se.Attr {
+					if a.Name.Local == "message-id" {
+						id = a.Value
+					}
+				}
+				continue
+			}
+			return id, se.Name.Local
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package driver_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeProxy is a SOCKS5 or HTTP CONNECT proxy that tunnels
+// to the addresses it is asked for. It asks for a user and
+// password when user is set.
+type fakeProxy struct {
+	ln       net.Listener
+	scheme   string
+	user     string
+	password string
+
+	mu sync.Mutex
+	// addrs holds the addresses tunnelled to.
+	addrs []string
+}
+
+func newFakeProxy(t *testing.T, scheme, user, password string) *fakeProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := &fakeProxy{ln: ln, scheme: scheme, user: user, password: password}
+	go fp.serve()
+	t.Cleanup(func() { ln.Close() })
+	return fp
+}
+
+// url returns the URL of the proxy with a user and password.
+func (fp *fakeProxy) url(user, password string) string {
+	if user == "" {
+		return fmt.Sprintf("%s://%s", fp.scheme, fp.ln.Addr())
+	}
+	return fmt.Sprintf("%s://%s:%s@%s", fp.scheme, user, password, fp.ln.Addr())
+}
+
+func (fp *fakeProxy) tunnelled() []string {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return append([]string{}, fp.addrs...)
+}
+
+func (fp *fakeProxy) serve() {
+	for {
+		conn, err := fp.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			br := bufio.NewReader(conn)
+			var addr string
+			if fp.scheme == "http" {
+				addr = fp.httpConnect(conn, br)
+			} else {
+				addr = fp.socks5Connect(conn, br)
+			}
+			if addr == "" {
+				return
+			}
+			fp.mu.Lock()
+			fp.addrs = append(fp.addrs, addr)
+			fp.mu.Unlock()
+			fp.tunnel(conn, br, addr)
+		}(conn)
+	}
+}
+
+// socks5Connect answers the SOCKS5 handshake and
+// returns the address asked for, "" when it failed.
+func (fp *fakeProxy) socks5Connect(conn net.Conn, br *bufio.Reader) string {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return ""
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return ""
+	}
+	want := byte(0)
+	if fp.user != "" {
+		want = 2
+	}
+	offered := false
+	for _, m := range methods {
+		offered = offered || m == want
+	}
+	if !offered {
+		conn.Write([]byte{5, 0xff})
+		return ""
+	}
+	conn.Write([]byte{5, want})
+
+	if want == 2 {
+		read := func() string {
+			n, _ := br.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(br, b)
+			return string(b)
+		}
+		br.ReadByte()
+		user, password := read(), read()
+		if user != fp.user || password != fp.password {
+			conn.Write([]byte{1, 1})
+			return ""
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil {
+		return ""
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(br, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := br.ReadByte()
+		name := make([]byte, n)
+		io.ReadFull(br, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(br, port)
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+}
+
+// httpConnect answers a CONNECT request and returns
+// the address asked for, "" when it failed.
+func (fp *fakeProxy) httpConnect(conn net.Conn, br *bufio.Reader) string {
+	req, err := http.ReadRequest(br)
+	if err != nil || req.Method != http.MethodConnect {
+		conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+		return ""
+	}
+	if fp.user != "" {
+		want := "Basic " + base64.StdEncoding.EncodeToString([]byte(fp.user+":"+fp.password))
+		if req.Header.Get("Proxy-Authorization") != want {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return ""
+		}
+	}
+	return req.Host
+}
+
+// tunnel copies between the client and the address,
+// after telling the client whether it is reachable.
+func (fp *fakeProxy) tunnel(conn net.Conn, br *bufio.Reader, addr string) {
+	target, err := net.Dial("tcp", addr)
+	if fp.scheme == "http" {
+		if err != nil {
+			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	} else {
+		if err != nil {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	}
+	defer target.Close()
+	go io.Copy(target, br)
+	io.Copy(conn, target)
+}
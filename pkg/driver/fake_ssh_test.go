@@ -0,0 +1,340 @@
+package driver_test
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSSHServer is an SSH server that answers each line of an
+// interactive shell with the output returned by respond, like
+// fakeDevice. It forwards direct-tcpip channels so it can be
+// used as a jump host.
+type fakeSSHServer struct {
+	ln      net.Listener
+	config  *ssh.ServerConfig
+	hostKey ssh.Signer
+	banner  string
+	respond func(line string) string
+	// root is the directory files copied with scp and
+	// sftp are kept in, file transfers are refused when empty.
+	root string
+	// subsystems serve the subsystems a client requests by name.
+	subsystems map[string]func(ch ssh.Channel)
+	// exec answers a command run on an exec channel with its
+	// output and exit status, respond answers it when nil.
+	exec func(cmd string) (string, uint32)
+	// refuseExec refuses exec channels, like a device that
+	// only offers an interactive shell.
+	refuseExec bool
+	// dropExec closes exec channels before answering them,
+	// like a device whose connection is lost.
+	dropExec bool
+	// shells counts the interactive shells started.
+	shells int32
+	// reset is the number of connections closed before the
+	// handshake, like a device that resets them.
+	reset int32
+	// accepts counts the connections accepted.
+	accepts int32
+	// conns counts the connections that authenticated.
+	conns int32
+	// keepalives counts the keepalives clients sent.
+	keepalives int32
+
+	mu sync.Mutex
+	// live holds the connections that are open.
+	live map[net.Conn]bool
+	// execs holds the commands run on exec channels.
+	execs []string
+}
+
+func newFakeSSHServer(t *testing.T, user, password, banner string, respond func(line string) string) *fakeSSHServer {
+	t.Helper()
+	return newFakeSSHServerConfig(t, passwordConfig(user, password), banner, respond)
+}
+
+// passwordConfig returns the config of a server
+// that accepts a user with a password.
+func passwordConfig(user, password string) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+}
+
+// newFakeFileServer starts a fakeSSHServer that also serves
+// scp and sftp, keeping the files it is sent in root.
+func newFakeFileServer(t *testing.T, user, password, banner, root string, respond func(line string) string) *fakeSSHServer {
+	t.Helper()
+	fs := listenFakeSSHServer(t, passwordConfig(user, password), banner, respond)
+	fs.root = root
+	fs.subsystems["sftp"] = fs.sftp
+	go fs.serve()
+	return fs
+}
+
+// newFakeSSHServerConfig starts a fakeSSHServer that
+// authenticates clients with the callbacks of config.
+func newFakeSSHServerConfig(t *testing.T, config *ssh.ServerConfig, banner string, respond func(line string) string) *fakeSSHServer {
+	t.Helper()
+	fs := listenFakeSSHServer(t, config, banner, respond)
+	go fs.serve()
+	return fs
+}
+
+// listenFakeSSHServer returns a fakeSSHServer that
+// is listening, but does not serve connections yet.
+func listenFakeSSHServer(t *testing.T, config *ssh.ServerConfig, banner string, respond func(line string) string) *fakeSSHServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &fakeSSHServer{
+		ln: ln, config: config, hostKey: hostKey, banner: banner, respond: respond,
+		subsystems: make(map[string]func(ch ssh.Channel)),
+		live:       make(map[net.Conn]bool),
+	}
+	fs.config.AddHostKey(hostKey)
+	t.Cleanup(func() { ln.Close() })
+	return fs
+}
+
+func (fs *fakeSSHServer) port() int {
+	return fs.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (fs *fakeSSHServer) connections() int {
+	return int(atomic.LoadInt32(&fs.conns))
+}
+
+// open returns the number of connections that are open.
+func (fs *fakeSSHServer) open() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.live)
+}
+
+// drop closes the open connections, like a device that reloads.
+func (fs *fakeSSHServer) drop() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for conn := range fs.live {
+		conn.Close()
+	}
+}
+
+func (fs *fakeSSHServer) shellsStarted() int {
+	return int(atomic.LoadInt32(&fs.shells))
+}
+
+func (fs *fakeSSHServer) execsReceived() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string{}, fs.execs...)
+}
+
+func (fs *fakeSSHServer) accepted() int {
+	return int(atomic.LoadInt32(&fs.accepts))
+}
+
+func (fs *fakeSSHServer) keepalivesReceived() int {
+	return int(atomic.LoadInt32(&fs.keepalives))
+}
+
+func (fs *fakeSSHServer) serve() {
+	for {
+		conn, err := fs.ln.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&fs.accepts, 1)
+		if atomic.AddInt32(&fs.reset, -1) >= 0 {
+			conn.Close()
+			continue
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *fakeSSHServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, fs.config)
+	if err != nil {
+		return
+	}
+	atomic.AddInt32(&fs.conns, 1)
+	fs.mu.Lock()
+	fs.live[conn] = true
+	fs.mu.Unlock()
+	defer func() {
+		fs.mu.Lock()
+		delete(fs.live, conn)
+		fs.mu.Unlock()
+	}()
+	go func() {
+		for req := range reqs {
+			if req.Type == "keepalive@openssh.com" {
+				atomic.AddInt32(&fs.keepalives, 1)
+			}
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}()
+
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "session":
+			ch, reqs, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+			go fs.session(ch, reqs)
+		case "direct-tcpip":
+			go forward(nc)
+		default:
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func (fs *fakeSSHServer) session(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			req.Reply(true, nil)
+		case "shell":
+			atomic.AddInt32(&fs.shells, 1)
+			req.Reply(true, nil)
+			ch.Write([]byte(fs.banner))
+			s := bufio.NewScanner(ch)
+			s.Split(scanCR)
+			for s.Scan() {
+				ch.Write([]byte(fs.respond(s.Text())))
+			}
+			return
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			if fs.refuseExec {
+				req.Reply(false, nil)
+				continue
+			}
+			if fs.dropExec {
+				return
+			}
+			req.Reply(true, nil)
+			var code uint32
+			switch {
+			case fs.root != "" && strings.HasPrefix(payload.Command, "scp "):
+				code = fs.scp(ch, payload.Command)
+			case fs.exec != nil:
+				fs.mu.Lock()
+				fs.execs = append(fs.execs, payload.Command)
+				fs.mu.Unlock()
+				var out string
+				out, code = fs.exec(payload.Command)
+				ch.Write([]byte(out))
+			default:
+				ch.Write([]byte(fs.respond(payload.Command)))
+			}
+			status := make([]byte, 4)
+			binary.BigEndian.PutUint32(status, code)
+			ch.SendRequest("exit-status", false, status)
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			ssh.Unmarshal(req.Payload, &payload)
+			serve, ok := fs.subsystems[payload.Name]
+			if !ok {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			serve(ch)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// scanCR splits lines ended by a carriage return, as
+// written by WriteSSH, or a line feed.
+func scanCR(data []byte, atEOF bool) (int, []byte, error) {
+	if i := strings.IndexAny(string(data), "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// forward connects a direct-tcpip channel to its destination.
+func forward(nc ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &payload); err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, ch)
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+	wg.Wait()
+	ch.Close()
+	conn.Close()
+}
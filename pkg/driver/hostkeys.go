@@ -0,0 +1,364 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies decide how the key an SSH server
+// presents is checked.
+const (
+	// HostKeyStrict accepts only keys that are already
+	// known. It is the default.
+	HostKeyStrict = "strict"
+	// HostKeyAcceptNew accepts and remembers the key of a host
+	// that is not known yet, trust on first use. A known host
+	// presenting a different key is still refused.
+	HostKeyAcceptNew = "accept-new"
+	// HostKeyInsecure accepts any key. NOT RECOMMENDED FOR PRODUCTION
+	HostKeyInsecure = "insecure"
+)
+
+// knownHostsMu serializes access to the managed known hosts
+// file between the workers of a job, the file is also locked
+// for other jato processes.
+var knownHostsMu sync.Mutex
+
+// ParseHostKeyPolicy returns the host key policy
+// named s, an empty name is the strict policy.
+func ParseHostKeyPolicy(s string) (string, error) {
+	switch s {
+	case "":
+		return HostKeyStrict, nil
+	case HostKeyStrict, HostKeyAcceptNew, HostKeyInsecure:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown host key policy: %s", s)
+}
+
+// hostKeyPolicy returns the policy of the SSH parameters.
+func hostKeyPolicy(s SSHParams) (string, error) {
+	if s.InsecureConnection {
+		return HostKeyInsecure, nil
+	}
+	return ParseHostKeyPolicy(s.HostKeyPolicy)
+}
+
+// hostKeyCallback returns a callback that checks host keys against
+// the known hosts file of the SSH parameters and the managed known
+// hosts file according to the parameters' host key policy.
+func hostKeyCallback(s SSHParams) (ssh.HostKeyCallback, error) {
+	policy, err := hostKeyPolicy(s)
+	if err != nil {
+		return nil, err
+	}
+	if policy == HostKeyInsecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	if s.KnownHostsFile == "" {
+		s.KnownHostsFile = constant.SSHKnownHostsFile
+	}
+	managed := constant.JatoKnownHostsFile
+
+	if policy == HostKeyStrict {
+		if err := createKnownHosts(s.KnownHostsFile); err != nil {
+			return nil, err
+		}
+		return knownhosts.New(existing(s.KnownHostsFile, managed)...)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return withKnownHosts(managed, func() error {
+			check, err := knownhosts.New(existing(s.KnownHostsFile, managed)...)
+			if err != nil {
+				return err
+			}
+			err = check(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+				return err
+			}
+			return appendHostKey(managed, hostname, key)
+		})
+	}, nil
+}
+
+// existing returns the files that exist.
+func existing(files ...string) []string {
+	found := []string{}
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+// createKnownHosts creates an empty known hosts
+// file and its directory if it does not exist.
+func createKnownHosts(file string) error {
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("unable to create known hosts file: %v", err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create known hosts file: %v", err)
+	}
+	return f.Close()
+}
+
+// withKnownHosts calls fn with the known hosts file locked
+// against the other workers and jato processes.
+func withKnownHosts(file string, fn func() error) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if err := createKnownHosts(file); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("unable to lock known hosts file: %v", err)
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
+
+// appendHostKey appends the key of a host to a known hosts file.
+func appendHostKey(file, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+	return err
+}
+
+// HostKey is an entry of a known hosts file.
+type HostKey struct {
+	Hosts []string
+	Key   ssh.PublicKey
+}
+
+func (k HostKey) String() string {
+	return fmt.Sprintf("%s %s %s", strings.Join(k.Hosts, ","), k.Key.Type(), ssh.FingerprintSHA256(k.Key))
+}
+
+// ListHostKeys returns the entries of a known hosts file.
+func ListHostKeys(file string) ([]HostKey, error) {
+	keys := []HostKey{}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return keys, err
+	}
+	for len(b) > 0 {
+		var hosts []string
+		var key ssh.PublicKey
+		_, hosts, key, _, b, err = ssh.ParseKnownHosts(b)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return keys, fmt.Errorf("%s: %v", file, err)
+		}
+		keys = append(keys, HostKey{Hosts: hosts, Key: key})
+	}
+	return keys, nil
+}
+
+// PruneHostKeys removes the entries of a known hosts file whose
+// hosts are not kept, it returns the entries it removed.
+// Comments and entries it cannot parse are kept.
+func PruneHostKeys(file string, keep func(host string) bool) ([]HostKey, error) {
+	removed := []HostKey{}
+	err := withKnownHosts(file, func() error {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		out := bytes.Buffer{}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			line := s.Bytes()
+			_, hosts, key, _, _, err := ssh.ParseKnownHosts(line)
+			if err == nil && !keepAny(hosts, keep) {
+				removed = append(removed, HostKey{Hosts: hosts, Key: key})
+				continue
+			}
+			out.Write(line)
+			out.WriteByte('\n')
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, out.Bytes(), 0600)
+	})
+	return removed, err
+}
+
+func keepAny(hosts []string, keep func(host string) bool) bool {
+	for _, h := range hosts {
+		if keep(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// errHostKey stops a handshake once the host key is known.
+var errHostKey = errors.New("host key received")
+
+// SSHHost is an SSH server whose host key is checked to connect
+// to a device: the device, its console server or a jump host.
+type SSHHost struct {
+	Host string
+	Port int
+	// Proxy and JumpHosts are what the host is reached
+	// through, Credentials log in to the jump hosts.
+	Proxy       string
+	JumpHosts   []JumpHost
+	Credentials data.Credentials
+}
+
+// Addr returns the address of the host. EG: 10.0.0.1:22
+func (h SSHHost) Addr() string {
+	return net.JoinHostPort(h.Host, fmt.Sprint(h.Port))
+}
+
+// SSHHosts returns the SSH servers whose host keys are checked to
+// connect to an initialized device with its connector, in the
+// order they are connected to: its jump hosts, then the device or
+// its console server. It is empty for connectors that do not use
+// SSH.
+func SSHHosts(d NetDevice) []SSHHost {
+	var port int
+	switch {
+	case d.Connector == "ssh":
+		port = d.SSHParams.Port
+	case d.Connector == "netconf":
+		port = d.NetconfParams.Port
+	case d.Connector == "console" && d.ConsoleParams.Protocol == "ssh":
+		c := d.ConsoleParams
+		return []SSHHost{{Host: c.Host, Port: c.Port, Proxy: c.Proxy}}
+	default:
+		return nil
+	}
+
+	hops := d.SSHParams.JumpHosts
+	hosts := []SSHHost{}
+	for i, hop := range hops {
+		hosts = append(hosts, SSHHost{
+			Host: hop.Host, Port: hop.Port, Proxy: d.SSHParams.Proxy,
+			JumpHosts: hops[:i], Credentials: d.Credentials,
+		})
+	}
+	return append(hosts, SSHHost{
+		Host: d.IP, Port: port, Proxy: d.SSHParams.Proxy,
+		JumpHosts: hops, Credentials: d.Credentials,
+	})
+}
+
+// deviceHost returns the SSH server of a device, the
+// device's SSH port for connectors that do not use SSH.
+func deviceHost(d NetDevice) SSHHost {
+	if hosts := SSHHosts(d); len(hosts) > 0 {
+		return hosts[len(hosts)-1]
+	}
+	return SSHHost{
+		Host: d.IP, Port: d.SSHParams.Port, Proxy: d.SSHParams.Proxy,
+		JumpHosts: d.SSHParams.JumpHosts, Credentials: d.Credentials,
+	}
+}
+
+// ScanHostKey connects to a device, through its jump hosts,
+// and returns the host key it presents. It does not log in.
+func ScanHostKey(ctx context.Context, d NetDevice) (ssh.PublicKey, error) {
+	return ScanSSHHostKey(ctx, deviceHost(d))
+}
+
+// ScanSSHHostKey connects to an SSH server, through its jump
+// hosts, and returns the host key it presents. It does not log
+// in to the server, only to its jump hosts.
+func ScanSSHHostKey(ctx context.Context, h SSHHost) (ssh.PublicKey, error) {
+	dial, err := jumpHosts.dialer(ctx, h.Proxy, h.JumpHosts, h.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	addr := h.Addr()
+	netConn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer netConn.Close()
+	stop := closeOnDone(ctx, netConn)
+	defer stop()
+
+	var hostKey ssh.PublicKey
+	conf := &ssh.ClientConfig{
+		User: "jato",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKey
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(netConn, addr, conf)
+	if hostKey == nil {
+		return nil, contextError(ctx, err)
+	}
+	return hostKey, nil
+}
+
+// AddHostKey adds the key of a device to a known hosts file,
+// added is false when the key is already known. A device that
+// is known with a different key is not replaced, a
+// *knownhosts.KeyError is returned.
+func AddHostKey(file string, d NetDevice, key ssh.PublicKey) (added bool, err error) {
+	return AddSSHHostKey(file, deviceHost(d), key)
+}
+
+// AddSSHHostKey is AddHostKey for an SSH server.
+func AddSSHHostKey(file string, h SSHHost, key ssh.PublicKey) (added bool, err error) {
+	addr := h.Addr()
+	err = withKnownHosts(file, func() error {
+		check, err := knownhosts.New(file)
+		if err != nil {
+			return err
+		}
+		err = check(addr, &net.TCPAddr{IP: net.ParseIP(h.Host), Port: h.Port}, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+		added = true
+		return appendHostKey(file, addr, key)
+	})
+	return added, err
+}
@@ -0,0 +1,363 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/constant"
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// useKnownHosts points the managed known hosts file at a temporary
+// directory. Tests that use it cannot run in parallel. It returns
+// a known hosts file for the SSH parameters that does not exist.
+func useKnownHosts(t *testing.T) (sshFile, managed string) {
+	dir := t.TempDir()
+	old := constant.JatoKnownHostsFile
+	constant.JatoKnownHostsFile = filepath.Join(dir, "jato", "known_hosts")
+	t.Cleanup(func() { constant.JatoKnownHostsFile = old })
+	return filepath.Join(dir, "ssh", "known_hosts"), constant.JatoKnownHostsFile
+}
+
+func newHostKeyServer(t *testing.T) *fakeSSHServer {
+	return newFakeSSHServer(t, "cisco", "cisco", "", func(string) string { return "" })
+}
+
+// connectHostKey connects to a fake SSH server with the host key
+// checking of params.
+func connectHostKey(params driver.SSHParams, port int) error {
+	clientConfig, err := driver.SSHClientConfig(data.Credentials{Username: "cisco", Password: "cisco"}, params)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := driver.ConnectWithSSH(ctx, "127.0.0.1", port, clientConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func hostKeyDevice(port int) driver.NetDevice {
+	return driver.NetDevice{IP: "127.0.0.1", SSHParams: driver.SSHParams{Port: port}}
+}
+
+func TestParseHostKeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		s       string
+		want    string
+		wantErr bool
+	}
+	testCases := []testCase{
+		{s: "", want: driver.HostKeyStrict},
+		{s: "strict", want: driver.HostKeyStrict},
+		{s: "accept-new", want: driver.HostKeyAcceptNew},
+		{s: "insecure", want: driver.HostKeyInsecure},
+		{s: "yes", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := driver.ParseHostKeyPolicy(tc.s)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: got error: %v, want error: %v", tc.s, err, tc.wantErr)
+		}
+		if got != tc.want {
+			t.Errorf("%q: got: %q, want: %q", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestHostKeyPolicyStrict(t *testing.T) {
+	sshFile, managed := useKnownHosts(t)
+	fs := newHostKeyServer(t)
+	params := driver.SSHParams{KnownHostsFile: sshFile}
+
+	err := connectHostKey(params, fs.port())
+	if err == nil {
+		t.Fatal("connected to a host that is not known")
+	}
+
+	// Keys accepted into the managed file are known
+	if _, err := driver.AddHostKey(managed, hostKeyDevice(fs.port()), fs.hostKey.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	if err := connectHostKey(params, fs.port()); err != nil {
+		t.Fatalf("got: %v, want: connected to a known host", err)
+	}
+
+	keys, err := driver.ListHostKeys(sshFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("got: %d keys in the known hosts file, want: 0", len(keys))
+	}
+}
+
+func TestHostKeyPolicyAcceptNew(t *testing.T) {
+	sshFile, managed := useKnownHosts(t)
+	fs := newHostKeyServer(t)
+	params := driver.SSHParams{KnownHostsFile: sshFile, HostKeyPolicy: driver.HostKeyAcceptNew}
+
+	for i := 0; i < 2; i++ {
+		if err := connectHostKey(params, fs.port()); err != nil {
+			t.Fatalf("connection %d: %v", i+1, err)
+		}
+	}
+
+	keys, err := driver.ListHostKeys(managed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("got: %d keys, want: 1", len(keys))
+	}
+	wantHost := fmt.Sprintf("[127.0.0.1]:%d", fs.port())
+	if keys[0].Hosts[0] != wantHost {
+		t.Errorf("got host: %s, want: %s", keys[0].Hosts[0], wantHost)
+	}
+	if string(keys[0].Key.Marshal()) != string(fs.hostKey.PublicKey().Marshal()) {
+		t.Error("got a key that is not the server's")
+	}
+
+	// A known host presenting another key is refused
+	other := newHostKeyServer(t)
+	if _, err := driver.AddHostKey(managed, hostKeyDevice(other.port()), fs.hostKey.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	// The handshake does not wrap the *knownhosts.KeyError
+	err = connectHostKey(params, other.port())
+	if err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Fatalf("got: %v, want: a host key mismatch", err)
+	}
+}
+
+func TestHostKeyPolicyAcceptNewConcurrent(t *testing.T) {
+	sshFile, managed := useKnownHosts(t)
+	fs := newHostKeyServer(t)
+	params := driver.SSHParams{KnownHostsFile: sshFile, HostKeyPolicy: driver.HostKeyAcceptNew}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- connectHostKey(params, fs.port())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	keys, err := driver.ListHostKeys(managed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("got: %d keys, want: 1", len(keys))
+	}
+}
+
+func TestHostKeyPolicyInsecure(t *testing.T) {
+	sshFile, managed := useKnownHosts(t)
+	fs := newHostKeyServer(t)
+
+	for _, params := range []driver.SSHParams{
+		{KnownHostsFile: sshFile, HostKeyPolicy: driver.HostKeyInsecure},
+		{KnownHostsFile: sshFile, InsecureConnection: true},
+	} {
+		if err := connectHostKey(params, fs.port()); err != nil {
+			t.Error(err)
+		}
+	}
+
+	keys, err := driver.ListHostKeys(managed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("got: %d keys, want: 0", len(keys))
+	}
+
+	_, err = driver.SSHClientConfig(data.Credentials{Password: "cisco"}, driver.SSHParams{HostKeyPolicy: "yes"})
+	if err == nil {
+		t.Error("got no error for an unknown host key policy")
+	}
+}
+
+func TestScanHostKey(t *testing.T) {
+	t.Parallel()
+	fs := newHostKeyServer(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	d := hostKeyDevice(fs.port())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key, err := driver.ScanHostKey(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key.Marshal()) != string(fs.hostKey.PublicKey().Marshal()) {
+		t.Error("got a key that is not the server's")
+	}
+	if fs.connections() != 0 {
+		t.Errorf("got: %d logins, want: 0", fs.connections())
+	}
+
+	for i, want := range []bool{true, false} {
+		added, err := driver.AddHostKey(file, d, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != want {
+			t.Errorf("add %d: got added: %v, want: %v", i+1, added, want)
+		}
+	}
+
+	other := newHostKeyServer(t)
+	_, err = driver.AddHostKey(file, d, other.hostKey.PublicKey())
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		t.Errorf("got: %v, want: a host key mismatch", err)
+	}
+}
+
+func TestSSHHosts(t *testing.T) {
+	t.Parallel()
+	hops := []driver.JumpHost{{Host: "bastion1"}, {Host: "bastion2", Port: 2222}}
+	type testCase struct {
+		name string
+		d    driver.NetDevice
+		want []string
+	}
+	testCases := []testCase{
+		{
+			name: "ssh",
+			d:    driver.NetDevice{Connector: "ssh", SSHParams: driver.SSHParams{JumpHosts: hops}},
+			want: []string{"bastion1:22", "bastion2:2222", "10.0.0.1:22"},
+		},
+		{
+			name: "netconf",
+			d:    driver.NetDevice{Connector: "netconf", SSHParams: driver.SSHParams{JumpHosts: hops[:1]}},
+			want: []string{"bastion1:22", "10.0.0.1:830"},
+		},
+		{
+			name: "console ssh",
+			d:    driver.NetDevice{Connector: "console", ConsoleParams: driver.ConsoleParams{Host: "ts1", Protocol: "ssh"}},
+			want: []string{"ts1:22"},
+		},
+		{
+			name: "console telnet",
+			d:    driver.NetDevice{Connector: "console", ConsoleParams: driver.ConsoleParams{Host: "ts1"}},
+		},
+		{
+			name: "eapi",
+			d:    driver.NetDevice{Connector: "eapi"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc.d.Name, tc.d.IP, tc.d.Vendor, tc.d.Platform = "r1", "10.0.0.1", "juniper", "junos"
+			tc.d.SSHParams.JumpHosts = append([]driver.JumpHost{}, tc.d.SSHParams.JumpHosts...)
+			d, err := driver.NewDevice(tc.d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for i, h := range driver.SSHHosts(d) {
+				got = append(got, h.Addr())
+				if len(h.JumpHosts) != i && tc.d.Connector != "console" {
+					t.Errorf("%s: want %d jump hosts, got %d", h.Addr(), i, len(h.JumpHosts))
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestScanSSHHostKeyJumpHost(t *testing.T) {
+	t.Parallel()
+	bastion := newFakeSSHServer(t, "admin", "cisco", "", iosShell)
+	fs := newHostKeyServer(t)
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "ssh",
+		SSHParams: driver.SSHParams{
+			Port:      fs.port(),
+			JumpHosts: []driver.JumpHost{{Host: "127.0.0.1", Port: bastion.port(), InsecureConnection: true}},
+		},
+		Credentials: data.Credentials{Username: "admin", Password: "cisco"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := driver.SSHHosts(d)
+	if len(hosts) != 2 {
+		t.Fatalf("want the jump host and the device, got %v", hosts)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i, want := range []ssh.PublicKey{bastion.hostKey.PublicKey(), fs.hostKey.PublicKey()} {
+		key, err := driver.ScanSSHHostKey(ctx, hosts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(key.Marshal()) != string(want.Marshal()) {
+			t.Errorf("%s: got a key that is not the server's", hosts[i].Addr())
+		}
+	}
+}
+
+func TestPruneHostKeys(t *testing.T) {
+	t.Parallel()
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	key := newHostKeyServer(t).hostKey.PublicKey()
+
+	for _, port := range []int{22, 2222} {
+		d := hostKeyDevice(port)
+		if _, err := driver.AddHostKey(file, d, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := driver.PruneHostKeys(file, func(host string) bool { return host == "127.0.0.1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Hosts[0] != "[127.0.0.1]:2222" {
+		t.Errorf("got removed: %v, want: [127.0.0.1]:2222", removed)
+	}
+
+	keys, err := driver.ListHostKeys(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Hosts[0] != "127.0.0.1" {
+		t.Errorf("got: %v, want: 127.0.0.1", keys)
+	}
+	if keys[0].Key.Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("got key type: %s, want: %s", keys[0].Key.Type(), ssh.KeyAlgoED25519)
+	}
+}
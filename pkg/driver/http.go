@@ -0,0 +1,246 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// HTTPParams hold the parameters of the HTTP API
+// connectors. EG: eapi, nxapi and restconf
+type HTTPParams struct {
+	Port int `json:"port"`
+	// Scheme is https or http, https when empty.
+	Scheme string `json:"scheme"`
+	// CAFile holds the PEM certificates of the authorities
+	// that sign the device's certificate, the system's
+	// authorities are used when it is empty.
+	CAFile string `json:"caFile"`
+	// ServerName is the name the device's certificate is
+	// checked against, the device's IP when it is empty.
+	ServerName string `json:"serverName"`
+	// InsecureSkipVerify accepts any certificate.
+	// NOT RECOMMENDED FOR PRODUCTION
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+func InitHTTPParams(s *HTTPParams) {
+	if s.Scheme == "" {
+		s.Scheme = "https"
+	}
+	if s.Port == 0 {
+		s.Port = 443
+		if s.Scheme == "http" {
+			s.Port = 80
+		}
+	}
+}
+
+// HTTPError is returned when a device answers
+// a request with an HTTP error status.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// Body of the response, EG: an error message.
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	if body := strings.TrimSpace(e.Body); body != "" && len(body) < 512 {
+		return fmt.Sprintf("http: %s: %s", e.Status, body)
+	}
+	return fmt.Sprintf("http: %s", e.Status)
+}
+
+// httpClient returns a client that checks the device's
+// certificate as the HTTP parameters configure.
+func httpClient(s HTTPParams) (*http.Client, error) {
+	conf := &tls.Config{
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if s.CAFile != "" {
+		b, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%s: no certificates found", s.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	return &http.Client{Transport: transport}, nil
+}
+
+// apiURL returns the URL of a path of the device's HTTP API.
+func (d *NetDevice) apiURL(path string) string {
+	return fmt.Sprintf("%s://%s:%d%s", d.HTTPParams.Scheme, d.IP, d.HTTPParams.Port, path)
+}
+
+// doHTTP sends a request authenticated with the device's
+// credentials and returns the response's body. An error
+// status is returned as an *HTTPError.
+func doHTTP(ctx context.Context, client *http.Client, creds data.Credentials, req *http.Request) ([]byte, error) {
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(creds.Username, creds.Password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return b, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(b)}
+	}
+	return b, nil
+}
+
+// postJSON posts a JSON request and decodes the JSON response.
+func postJSON(ctx context.Context, client *http.Client, creds data.Credentials, url, contentType string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	body, err := doHTTP(ctx, client, creds, req)
+	if err != nil {
+		// JSON-RPC errors come with an error status on some
+		// platforms, the response holds the error's details.
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || json.Unmarshal(body, out) != nil {
+			return err
+		}
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	return nil
+}
+
+// commandAPI is implemented by the connectors that
+// run CLI commands over an HTTP API.
+type commandAPI interface {
+	// command runs a command, the output holds
+	// its text and structured output.
+	command(ctx context.Context, cmd string) (data.CommandOutput, error)
+	// config sends configuration lines.
+	config(ctx context.Context, lines []string) ([]data.CommandOutput, error)
+	// reads reports whether a command only reads from the device,
+	// it can be sent again when it may have run. EG: timed out
+	reads(cmd string) bool
+}
+
+// showCommand reports whether a command is a show command.
+// Only show commands are run a second time for their
+// structured output, others can change the device.
+// EG: clear counters or write memory
+func showCommand(cmd string) bool {
+	fields := strings.Fields(cmd)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "show")
+}
+
+// runAPIJob runs a job with a connector's command API. Commands
+// the device reports an error for are marked as failed. Each
+// command is retried as the job's command retry policy decides,
+// commands that change the device only when the device reported
+// an error for them, they may have run when they failed otherwise.
+func runAPIJob(ctx context.Context, d *NetDevice, job Job, api commandAPI) data.Result {
+
+	result := data.Result{}
+
+	result.Device = d.Name
+	result.Timestamp = time.Now().Unix()
+
+	if len(job.Expect) > 0 {
+		result.Error = fmt.Errorf("%s: expect steps are not supported", d.Connector)
+		return result
+	}
+
+	if len(job.Config) > 0 {
+		ctx, cancel := d.commandContext(ctx)
+		cmdOut, err := api.config(ctx, job.Config)
+		cancel()
+		result.CommandOutputs = cmdOut
+		if err != nil {
+			result.OK = false
+			result.Error = err
+			return result
+		}
+	}
+
+	var err error
+	for _, cmd := range job.Commands {
+		policy := job.CommandRetry
+		if !api.reads(cmd) {
+			policy = commandErrorRetry(policy)
+		}
+		var c data.CommandOutput
+		c, err = retryCommand(ctx, policy, func() (data.CommandOutput, error) {
+			cmdCtx, cancel := d.commandContext(ctx)
+			defer cancel()
+			return api.command(cmdCtx, cmd)
+		})
+		if err != nil {
+			break
+		}
+		c.CommandU = util.Underscorer(cmd)
+		result.CommandOutputs = append(result.CommandOutputs, c)
+		if c.Failed && !continues(job.OnError) {
+			break
+		}
+	}
+	if err == nil {
+		err = commandError(result.CommandOutputs, job.OnError)
+	}
+
+	if err != nil {
+		result.OK = false
+		result.Error = err
+		return result
+	}
+
+	result.OK = true
+	return result
+}
+
+// configError returns a *ConfigError for the
+// lines the device reported an error for.
+func configError(cmdOut []data.CommandOutput) error {
+	configErr := &ConfigError{}
+	for _, c := range cmdOut {
+		if c.Failed {
+			configErr.Lines = append(configErr.Lines, ConfigLineError{Line: c.Command, Message: c.Error})
+		}
+	}
+	if len(configErr.Lines) == 0 {
+		return nil
+	}
+	return configErr
+}
@@ -0,0 +1,219 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// ErrorPolicy decides how a job goes on when a device
+// reports an error for one of the job's commands.
+type ErrorPolicy string
+
+const (
+	// ContinueOnError runs the remaining commands.
+	ContinueOnError ErrorPolicy = "continue"
+	// SkipOnError skips the remaining commands. A commit
+	// is still rolled back.
+	SkipOnError ErrorPolicy = "skip"
+	// AbortOnError skips the remaining commands and abandons
+	// the device. A commit is neither rolled back nor confirmed,
+	// a confirmed commit is rolled back by the device.
+	AbortOnError ErrorPolicy = "abort"
+)
+
+// ParseErrorPolicy returns the ErrorPolicy named s,
+// "" is ContinueOnError.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(s); p {
+	case "":
+		return ContinueOnError, nil
+	case ContinueOnError, SkipOnError, AbortOnError:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown error policy: %s", s)
+}
+
+// continues reports whether a policy runs the
+// remaining commands after a failed command.
+func continues(policy ErrorPolicy) bool {
+	return policy == ContinueOnError || policy == ""
+}
+
+// Job holds the work to run against a device. Config is
+// sent first, then the Expect steps and the Commands are run.
+type Job struct {
+	Commands []string
+	Config   []string
+	Expect   []ExpectStep
+	// Commit controls how Config is committed on
+	// platforms with a candidate configuration.
+	Commit CommitOptions
+	// OnError decides how the job goes on when the device
+	// reports an error for a command, "" continues.
+	OnError ErrorPolicy
+	// Retry retries connecting to the device.
+	Retry RetryPolicy
+	// CommandRetry retries each command. In an interactive
+	// shell only the commands the device reports an error for
+	// are retried, a command that timed out may still answer.
+	CommandRetry RetryPolicy
+}
+
+// runJob runs a job against a connected device with the
+// connector's send function. On platforms with a candidate
+// configuration the expect steps and commands are the
+// post-checks of the commit, it is rolled back when they fail.
+func runJob(ctx context.Context, d *NetDevice, job Job, send sendFunc) data.Result {
+
+	result := data.Result{}
+
+	result.Device = d.Name
+	result.Timestamp = time.Now().Unix()
+
+	_, commits := committer(d)
+
+	if len(job.Config) > 0 {
+		var cmdOut []data.CommandOutput
+		var err error
+		if commits {
+			result.Commit, cmdOut, err = commitConfigSet(ctx, d, job.Config, job.Commit, send)
+		} else {
+			cmdOut, err = sendConfigSet(ctx, d, job.Config, send)
+		}
+		result.CommandOutputs = cmdOut
+		if err != nil {
+			result.OK = false
+			result.Error = err
+			return result
+		}
+	}
+
+	cmdOut, err := sendExpect(ctx, d, job.Expect, job.OnError, send)
+	result.CommandOutputs = append(result.CommandOutputs, cmdOut...)
+	if err == nil && (continues(job.OnError) || !failed(cmdOut)) {
+		cmdOut, err = sendCommands(ctx, d, job.Commands, job.OnError, commandErrorRetry(job.CommandRetry), send)
+		result.CommandOutputs = append(result.CommandOutputs, cmdOut...)
+	}
+	if err == nil {
+		err = commandError(result.CommandOutputs, job.OnError)
+	}
+
+	var cmdErr *CommandError
+	aborted := errors.As(err, &cmdErr) && cmdErr.Aborted
+	if result.Commit != nil && !aborted {
+		if err != nil {
+			if rbErr := rollbackCommit(ctx, d, send); rbErr != nil {
+				err = fmt.Errorf("%v, %v", err, rbErr)
+			} else {
+				result.Commit.RolledBack = true
+			}
+		} else if job.Commit.Confirmed > 0 {
+			err = confirmCommit(ctx, d, send)
+			result.Commit.Confirmed = err == nil
+		}
+	}
+
+	if err != nil {
+		result.OK = false
+		result.Error = err
+		return result
+	}
+
+	result.OK = true
+	return result
+}
+
+// markError marks a command's output as failed when it
+// matches one of the error patterns of the device's driver.
+func markError(d *NetDevice, c *data.CommandOutput) {
+	drv, err := d.driver()
+	if err != nil {
+		return
+	}
+	m, ok := drv.(ErrorMatcher)
+	if !ok {
+		return
+	}
+	if msg, ok := matchError(m.ErrorPatterns(), c.Output); ok {
+		c.Failed = true
+		c.Error = msg
+	}
+}
+
+// failed reports whether the device reported
+// an error for one of the commands.
+func failed(cmdOut []data.CommandOutput) bool {
+	for _, c := range cmdOut {
+		if c.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// commandError returns a *CommandError for the commands the
+// device reported an error for, nil when there are none.
+// Configuration lines are reported by their own error.
+func commandError(cmdOut []data.CommandOutput, policy ErrorPolicy) error {
+	cmdErr := &CommandError{Aborted: policy == AbortOnError}
+	for _, c := range cmdOut {
+		if c.Failed {
+			cmdErr.Failed = append(cmdErr.Failed, c)
+		}
+	}
+	if len(cmdErr.Failed) == 0 {
+		return nil
+	}
+	return cmdErr
+}
+
+// sendSessionCommands prepares a session with the driver's session
+// commands. A command the device rejects does not fail the session,
+// EG: disabling paging on a read-only account.
+func sendSessionCommands(ctx context.Context, d *NetDevice, drv Driver, send sendFunc) error {
+	_, err := sendCommands(ctx, d, drv.SessionCommands(), ContinueOnError, RetryPolicy{}, send)
+	return err
+}
+
+// sendCommands sends commands to a device with a
+// connector's send function. The device's timeout
+// applies to each command. Unless the policy is to
+// continue, the commands after a failed command
+// are not sent. Failed commands are sent again as
+// the retry policy decides.
+func sendCommands(ctx context.Context, d *NetDevice, commands []string, policy ErrorPolicy, retry RetryPolicy, send sendFunc) ([]data.CommandOutput, error) {
+
+	cmdOut := []data.CommandOutput{}
+
+	for _, cmd := range commands {
+		c, err := retryCommand(ctx, retry, func() (data.CommandOutput, error) {
+			cmdCtx, cancel := d.commandContext(ctx)
+			out, err := send(cmdCtx, cmd, d.SuperUserPromptRE)
+			cancel()
+			if err != nil {
+				return data.CommandOutput{}, err
+			}
+			c := data.CommandOutput{
+				Command:  cmd,
+				CommandU: util.Underscorer(cmd),
+				Output:   util.TruncateOutput(out),
+			}
+			markError(d, &c)
+			return c, nil
+		})
+		if err != nil {
+			return cmdOut, err
+		}
+		cmdOut = append(cmdOut, c)
+		if c.Failed && !continues(policy) {
+			break
+		}
+	}
+
+	return cmdOut, nil
+}
@@ -0,0 +1,86 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+func TestRunJobOnError(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		policy      driver.ErrorPolicy
+		commands    []string
+		wantOutputs int
+		wantFailed  int
+		wantAborted bool
+		wantErr     bool
+	}
+	commands := []string{"show version", "bogus 1", "show clock", "bogus 2"}
+	testCases := []testCase{
+		{policy: "", commands: commands, wantOutputs: 4, wantFailed: 2, wantErr: true},
+		{policy: driver.ContinueOnError, commands: commands, wantOutputs: 4, wantFailed: 2, wantErr: true},
+		{policy: driver.SkipOnError, commands: commands, wantOutputs: 2, wantFailed: 1, wantErr: true},
+		{policy: driver.AbortOnError, commands: commands, wantOutputs: 2, wantFailed: 1, wantAborted: true, wantErr: true},
+		{policy: driver.AbortOnError, commands: []string{"show version"}, wantOutputs: 1},
+	}
+
+	for _, tc := range testCases {
+		fd := newFakeDevice(t, "\r\nUsername: ", iosConfig())
+
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+			TelnetParams: driver.TelnetParams{Port: fd.port()},
+			Credentials:  data.Credentials{Username: "admin", Password: "cisco"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := driver.RunWithTelnet(context.Background(), d, driver.Job{Commands: tc.commands, OnError: tc.policy})
+		if tc.wantErr == result.OK {
+			t.Errorf("%q: want ok %t, got %t: %v", tc.policy, !tc.wantErr, result.OK, result.Error)
+		}
+		if len(result.CommandOutputs) != tc.wantOutputs {
+			t.Errorf("%q: want %d outputs, got %d", tc.policy, tc.wantOutputs, len(result.CommandOutputs))
+		}
+		if !tc.wantErr {
+			continue
+		}
+		var cmdErr *driver.CommandError
+		if !errors.As(result.Error, &cmdErr) {
+			t.Fatalf("%q: want a command error, got %v", tc.policy, result.Error)
+		}
+		if len(cmdErr.Failed) != tc.wantFailed || cmdErr.Aborted != tc.wantAborted {
+			t.Errorf("%q: want %d failed and aborted %t, got %d and %t", tc.policy, tc.wantFailed, tc.wantAborted, len(cmdErr.Failed), cmdErr.Aborted)
+		}
+		if c := result.CommandOutputs[1]; !c.Failed || c.Error != "% Invalid input detected at '^' marker." {
+			t.Errorf("%q: want %s failed with the device's error, got %+v", tc.policy, c.Command, c)
+		}
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		have    string
+		want    driver.ErrorPolicy
+		wantErr bool
+	}
+	testCases := []testCase{
+		{have: "", want: driver.ContinueOnError},
+		{have: "skip", want: driver.SkipOnError},
+		{have: "abort", want: driver.AbortOnError},
+		{have: "halt", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := driver.ParseErrorPolicy(tc.have)
+		if tc.wantErr != (err != nil) || got != tc.want {
+			t.Errorf("%q: want %q and error %t, got %q and %v", tc.have, tc.want, tc.wantErr, got, err)
+		}
+	}
+}
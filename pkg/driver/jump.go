@@ -0,0 +1,226 @@
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/automatico/jato/pkg/data"
+	"golang.org/x/crypto/ssh"
+)
+
+// JumpHost is an SSH server that a device is reached
+// through, the way OpenSSH's ProxyJump works.
+type JumpHost struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Credentials names the credentials to log in to the jump
+	// host with, the device's credentials are used when empty.
+	Credentials        string `json:"credentials"`
+	KnownHostsFile     string `json:"knownHostsFile"`
+	InsecureConnection bool   `json:"insecureConnection"`
+	HostKeyPolicy      string `json:"hostKeyPolicy"`
+}
+
+// dialFunc connects to an address on a network.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialTCP connects to an address directly.
+func dialTCP(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// netDialer returns a dialFunc that connects through
+// the proxy of a URL, or directly when it is empty.
+func netDialer(proxy string) (dialFunc, error) {
+	if proxy == "" {
+		return dialTCP, nil
+	}
+	return proxyDialer(proxy)
+}
+
+// connKey identifies the credentials a connection is authenticated
+// with and how the server's host key is checked. Connections are
+// only shared by devices with the same key, so none of them uses a
+// connection authenticated as another user or that was checked
+// with a looser host key policy. The secrets are hashed.
+func connKey(creds data.Credentials, params SSHParams) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", creds.Password, creds.SSHKeyFile, params.CertificateFile)
+	return fmt.Sprintf("%s#%x[%s %s %t %s]",
+		creds.Username, h.Sum(nil)[:8], params.HostKeyPolicy, params.KnownHostsFile,
+		params.InsecureConnection, strings.Join(params.AuthMethods, " "))
+}
+
+// jumpHosts holds the connections to jump hosts, they
+// are shared by the devices reached through them.
+var jumpHosts = &jumpPool{conns: make(map[string]*jumpConn)}
+
+// CloseJumpHosts closes the connections to jump hosts.
+// Call it once the devices reached through them are done.
+func CloseJumpHosts() {
+	jumpHosts.closeAll()
+}
+
+type jumpPool struct {
+	mu    sync.Mutex
+	conns map[string]*jumpConn
+}
+
+// jumpConn is a connection to a jump host. ready
+// is closed once client or err is set.
+type jumpConn struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+// dialer returns a dialFunc that tunnels through each of the
+// hops in turn, the first is reached through the proxy when
+// there is one. The connection to a hop is made once and shared
+// by every device reached through the same proxy and hops, with
+// the same credentials and host key checks.
+func (p *jumpPool) dialer(ctx context.Context, proxy string, hops []JumpHost, creds data.Credentials) (dialFunc, error) {
+	dial, err := netDialer(proxy)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{proxy}
+	for _, hop := range hops {
+		hopCreds := creds
+		if hop.Credentials != "" {
+			hopCreds = data.GetCredentials(hop.Credentials)
+		}
+		params := SSHParams{
+			Port:               hop.Port,
+			KnownHostsFile:     hop.KnownHostsFile,
+			InsecureConnection: hop.InsecureConnection,
+			HostKeyPolicy:      hop.HostKeyPolicy,
+		}
+		InitSSHParams(&params)
+		clientConfig, err := SSHClientConfig(hopCreds, params)
+		if err != nil {
+			return nil, fmt.Errorf("jump host: %s: %v", hop.Host, err)
+		}
+
+		addr := net.JoinHostPort(hop.Host, fmt.Sprint(params.Port))
+		keys = append(keys, fmt.Sprintf("%s@%s", connKey(hopCreds, params), addr))
+		hopDial := dial
+		client, err := p.get(ctx, strings.Join(keys, ","), func() (*ssh.Client, error) {
+			return dialSSHClient(ctx, hopDial, addr, clientConfig)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("jump host: %s: %w", hop.Host, err)
+		}
+		dial = clientDialer(client)
+	}
+	return dial, nil
+}
+
+// get returns the connection stored under key, calling
+// connect to make it if there is none. A connection that
+// fails or is closed by the jump host is forgotten.
+func (p *jumpPool) get(ctx context.Context, key string, connect func() (*ssh.Client, error)) (*ssh.Client, error) {
+	p.mu.Lock()
+	jc, ok := p.conns[key]
+	if !ok {
+		jc = &jumpConn{ready: make(chan struct{})}
+		p.conns[key] = jc
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		jc.client, jc.err = connect()
+		close(jc.ready)
+		if jc.err != nil {
+			p.forget(key, jc)
+		} else {
+			go func() {
+				jc.client.Wait()
+				p.forget(key, jc)
+			}()
+		}
+	}
+
+	select {
+	case <-jc.ready:
+		return jc.client, jc.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forget removes a connection from the pool.
+func (p *jumpPool) forget(key string, jc *jumpConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns[key] == jc {
+		delete(p.conns, key)
+	}
+}
+
+func (p *jumpPool) closeAll() {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = make(map[string]*jumpConn)
+	p.mu.Unlock()
+
+	for _, jc := range conns {
+		<-jc.ready
+		if jc.client != nil {
+			jc.client.Close()
+		}
+	}
+}
+
+// dialSSHClient connects and authenticates to an SSH server.
+// The handshake is abandoned when the context is done.
+func dialSSHClient(ctx context.Context, dial dialFunc, addr string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	netConn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := closeOnDone(ctx, netConn)
+	c, chans, reqs, err := ssh.NewClientConn(netConn, addr, clientConfig)
+	if err != nil {
+		stop()
+		netConn.Close()
+		return nil, contextError(ctx, err)
+	}
+	if !stop() {
+		c.Close()
+		return nil, ctx.Err()
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// clientDialer returns a dialFunc that tunnels through client.
+func clientDialer(client *ssh.Client) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		type dialed struct {
+			conn net.Conn
+			err  error
+		}
+		ch := make(chan dialed, 1)
+		go func() {
+			conn, err := client.Dial(network, addr)
+			ch <- dialed{conn: conn, err: err}
+		}()
+		select {
+		case d := <-ch:
+			return d.conn, d.err
+		case <-ctx.Done():
+			go func() {
+				if d := <-ch; d.conn != nil {
+					d.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package driver_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// iosShell answers an SSH shell at a Cisco IOS super user prompt.
+func iosShell(line string) string {
+	return "\r\nrouter#"
+}
+
+func TestRunWithSSHJumpHosts(t *testing.T) {
+	t.Parallel()
+	bastion1 := newFakeSSHServer(t, "admin", "cisco", "", iosShell)
+	bastion2 := newFakeSSHServer(t, "admin", "cisco", "", iosShell)
+
+	hops := []driver.JumpHost{
+		{Host: "127.0.0.1", Port: bastion1.port(), InsecureConnection: true},
+		{Host: "127.0.0.1", Port: bastion2.port(), InsecureConnection: true},
+	}
+
+	devices := []*fakeSSHServer{}
+	for i := 0; i < 3; i++ {
+		devices = append(devices, newFakeSSHServer(t, "admin", "cisco", "\r\nrouter#", iosShell))
+	}
+	for _, fs := range devices {
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "ssh",
+			SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true, JumpHosts: hops},
+			Credentials: data.Credentials{Username: "admin", Password: "cisco"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := driver.RunWithSSH(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+		if !result.OK {
+			t.Fatalf("want ok, got %v", result.Error)
+		}
+	}
+	// The pool is shared by the parallel tests, it is not closed
+
+	if bastion1.connections() != 1 || bastion2.connections() != 1 {
+		t.Errorf("want 1 connection to each jump host, got %d and %d", bastion1.connections(), bastion2.connections())
+	}
+	for _, fs := range devices {
+		if fs.connections() != 1 {
+			t.Errorf("want 1 connection to each device, got %d", fs.connections())
+		}
+	}
+}
+
+func TestRunWithSSHJumpHostsNotShared(t *testing.T) {
+	t.Parallel()
+	bastion := newFakeSSHServer(t, "admin", "cisco", "", iosShell)
+	hop := driver.JumpHost{Host: "127.0.0.1", Port: bastion.port(), InsecureConnection: true}
+	strict := driver.JumpHost{
+		Host: "127.0.0.1", Port: bastion.port(), HostKeyPolicy: "strict",
+		KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+	}
+
+	type testCase struct {
+		name     string
+		hop      driver.JumpHost
+		password string
+		wantOK   bool
+	}
+	// The first device connects to the jump host, the others
+	// must not use its connection unless they would have
+	// authenticated and accepted the host key the same way
+	testCases := []testCase{
+		{name: "first", hop: hop, password: "cisco", wantOK: true},
+		{name: "same credentials", hop: hop, password: "cisco", wantOK: true},
+		{name: "other password", hop: hop, password: "wrong"},
+		{name: "strict host key policy", hop: strict, password: "cisco"},
+	}
+
+	for _, tc := range testCases {
+		fs := newFakeSSHServer(t, "admin", tc.password, "\r\nrouter#", iosShell)
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "ssh",
+			SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true, JumpHosts: []driver.JumpHost{tc.hop}},
+			Credentials: data.Credentials{Username: "admin", Password: tc.password},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := driver.RunWithSSH(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+		if result.OK != tc.wantOK {
+			t.Errorf("%s: want OK %t, got %v", tc.name, tc.wantOK, result.Error)
+		}
+	}
+	// The devices that were refused made their own connections
+	if bastion.connections() != 1 || bastion.accepted() != 3 {
+		t.Errorf("want 1 of 3 connections to the jump host authenticated, got %d of %d", bastion.connections(), bastion.accepted())
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package driver
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on a file,
+// waiting for other processes to release theirs.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,13 @@
+package driver
+
+import "os"
+
+// lockFile is a no-op on Windows, jato
+// processes do not share a lock there.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
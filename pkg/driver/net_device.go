@@ -1,12 +1,13 @@
 package driver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"time"
 
 	"github.com/automatico/jato/pkg/data"
-	"github.com/reiver/go-telnet"
 )
 
 // Devices holds a collection of Device structs
@@ -20,170 +21,242 @@ type NetDevice struct {
 	Vendor            string `json:"vendor"`
 	Platform          string `json:"platform"`
 	Connector         string `json:"connector"`
+	Site              string `json:"site"`
 	SSHParams         `json:"sshParams"`
 	TelnetParams      `json:"telnetParams"`
+	ConsoleParams     `json:"consoleParams"`
+	NetconfParams     `json:"netconfParams"`
+	HTTPParams        `json:"httpParams"`
 	data.Variables    `json:"variables"`
 	Timeout           int64
 	UserPromptRE      *regexp.Regexp
 	SuperUserPromptRE *regexp.Regexp
 	ConfigPromtRE     *regexp.Regexp
 	SSHConn
-	TelnetConn *telnet.Conn
+	TelnetConn     TelnetConn
+	NetconfSession *NetconfSession `json:"-"`
+	// SSHManager, when set, holds the device's SSH connection
+	// so that it is reused by the jobs run against the device.
+	SSHManager *SSHManager `json:"-"`
+	Driver     Driver      `json:"-"`
 	data.Credentials
 }
 
-func (d *NetDevice) ConnectWithSSH() error {
+// driver returns the device's driver, looking it up in the
+// registry when the device was not initialized with one.
+func (d *NetDevice) driver() (Driver, error) {
+	if d.Driver != nil {
+		return d.Driver, nil
+	}
+	drv, err := Lookup(d.Vendor, d.Platform)
+	if err != nil {
+		return nil, fmt.Errorf("device: %s with %v", d.Name, err)
+	}
+	return drv, nil
+}
 
-	vendorPlatform := fmt.Sprintf("%s_%s", d.Vendor, d.Platform)
-	switch vendorPlatform {
-	case "arista_eos":
-		err := AristaEOSConnectWithSSH(d)
-		if err != nil {
+// Run connects to a device with its connector, runs
+// a job and disconnects. The platform of a device of
+// the AutoVendor is detected first. The class of a
+// failure is recorded on the result.
+func Run(ctx context.Context, nd NetDevice, job Job) data.Result {
+	if nd.Vendor == AutoVendor {
+		err := retry(ctx, job.Retry, func() error {
+			detected, err := detectDevice(ctx, nd)
+			if err == nil {
+				nd = detected
+			}
 			return err
-		}
-	case "aruba_aoscx":
-		err := ArubaAOSCXConnectWithSSH(d)
+		})
 		if err != nil {
-			return err
-		}
-	case "cisco_aireos":
-		err := CiscoAireOSConnectWithSSH(d)
-		if err != nil {
-			return err
-		}
-	case "cisco_asa":
-		err := CiscoASAConnectWithSSH(d)
-		if err != nil {
-			return err
-		}
-	case "cisco_ios":
-		err := CiscoIOSConnectWithSSH(d)
-		if err != nil {
-			return err
-		}
-	case "cisco_iosxr":
-		err := CiscoIOSXRConnectWithSSH(d)
-		if err != nil {
-			return err
-		}
-	case "cisco_nxos":
-		err := CiscoNXOSConnectWithSSH(d)
-		if err != nil {
-			return err
-		}
-	case "cisco_smb":
-		err := CiscoSMBConnectWithSSH(d)
-		if err != nil {
-			return err
-		}
-	case "juniper_junos":
-		err := JuniperJunosConnectWithSSH(d)
-		if err != nil {
-			return err
+			return data.Result{
+				Device:    nd.Name,
+				Error:     err,
+				Failure:   string(Classify(err)),
+				Timestamp: time.Now().Unix(),
+			}
 		}
+	}
+
+	var result data.Result
+	switch nd.Connector {
+	case "ssh":
+		result = RunWithSSH(ctx, nd, job)
+	case "telnet":
+		result = RunWithTelnet(ctx, nd, job)
+	case "console":
+		result = RunWithConsole(ctx, nd, job)
+	case "netconf":
+		result = RunWithNetconf(ctx, nd, job)
+	case "eapi":
+		result = RunWithEAPI(ctx, nd, job)
+	case "nxapi":
+		result = RunWithNXAPI(ctx, nd, job)
+	case "restconf":
+		result = RunWithRESTCONF(ctx, nd, job)
 	default:
-		return fmt.Errorf("device: %s with vendor: %s and platform: %s not supported", d.Name, d.Vendor, d.Platform)
+		result = data.Result{
+			Device:    nd.Name,
+			Error:     notSupported(&nd, nd.Connector),
+			Timestamp: time.Now().Unix(),
+		}
 	}
-	return nil
+	if !result.OK {
+		result.Failure = string(Classify(result.Error))
+	}
+	return result
+}
+
+// commandContext returns a context that applies
+// the device's command timeout.
+func (d NetDevice) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Second)
+}
 
+// ConnectWithSSH connects to the device with
+// SSH using the device's driver.
+func (d *NetDevice) ConnectWithSSH(ctx context.Context) error {
+	drv, err := d.driver()
+	if err != nil {
+		return err
+	}
+	return drv.ConnectWithSSH(ctx, d)
 }
 
+// DisconnectSSH closes the device's SSH session. The connection
+// is closed too, unless it is held by the device's SSHManager.
 func (d NetDevice) DisconnectSSH() error {
-	return d.SSHConn.Session.Close()
+	return d.SSHConn.Close()
 }
 
-func (d NetDevice) SendCommandWithSSH(command string) data.Result {
+// SendCommandWithSSH sends a command to the device. The
+// device's timeout applies to the command.
+func (d NetDevice) SendCommandWithSSH(ctx context.Context, command string) data.Result {
 
 	result := data.Result{}
 
 	result.Device = d.Name
 	result.Timestamp = time.Now().Unix()
 
-	cmdOut, err := SendCommandWithSSH(d.SSHConn, command, d.SuperUserPromptRE, d.Timeout)
+	ctx, cancel := d.commandContext(ctx)
+	defer cancel()
+
+	cmdOut, err := SendCommandWithSSH(ctx, d.SSHConn, command, d.SuperUserPromptRE, d.pager())
 	if err != nil {
 		result.OK = false
 		result.Error = err
 		return result
 	}
 
+	markError(&d, &cmdOut)
 	result.CommandOutputs = append(result.CommandOutputs, cmdOut)
+	if err := commandError(result.CommandOutputs, ContinueOnError); err != nil {
+		result.OK = false
+		result.Error = err
+		return result
+	}
 	result.OK = true
 	return result
 }
 
-func (d NetDevice) SendCommandsWithSSH(commands []string) data.Result {
+// SendCommandsWithSSH sends commands to the device. The
+// device's timeout applies to each command.
+func (d NetDevice) SendCommandsWithSSH(ctx context.Context, commands []string) data.Result {
 
 	result := data.Result{}
 
 	result.Device = d.Name
 	result.Timestamp = time.Now().Unix()
 
-	cmdOut, err := SendCommandsWithSSH(d.SSHConn, commands, d.SuperUserPromptRE, d.Timeout)
-	if err != nil {
+	for _, cmd := range commands {
+		res := d.SendCommandWithSSH(ctx, cmd)
+		result.CommandOutputs = append(result.CommandOutputs, res.CommandOutputs...)
+		var cmdErr *CommandError
+		if res.Error != nil && !errors.As(res.Error, &cmdErr) {
+			result.OK = false
+			result.Error = res.Error
+			return result
+		}
+	}
+
+	if err := commandError(result.CommandOutputs, ContinueOnError); err != nil {
 		result.OK = false
 		result.Error = err
 		return result
 	}
-
-	result.CommandOutputs = cmdOut
 	result.OK = true
 	return result
 }
 
-func (d *NetDevice) ConnectWithTelnet() error {
-
-	vendorPlatform := fmt.Sprintf("%s_%s", d.Vendor, d.Platform)
-	switch vendorPlatform {
-	case "cisco_ios":
-		err := CiscoIOSConnectWithTelnet(d)
-		if err != nil {
-			return err
-		}
-	default:
-		return fmt.Errorf("device: %s with vendor: %s and platform: %s not supported", d.Name, d.Vendor, d.Platform)
+// ConnectWithTelnet connects to the device with
+// Telnet using the device's driver.
+func (d *NetDevice) ConnectWithTelnet(ctx context.Context) error {
+	drv, err := d.driver()
+	if err != nil {
+		return err
 	}
-	return nil
-
+	return drv.ConnectWithTelnet(ctx, d)
 }
 
 func (d NetDevice) DisconnectTelnet() error {
 	return d.TelnetConn.Close()
 }
 
-func (d NetDevice) SendCommandWithTelnet(cmd string) data.Result {
+// SendCommandWithTelnet sends a command to the device. The
+// device's timeout applies to the command.
+func (d NetDevice) SendCommandWithTelnet(ctx context.Context, cmd string) data.Result {
 
 	result := data.Result{}
 
 	result.Device = d.Name
 	result.Timestamp = time.Now().Unix()
 
-	cmdOut, err := SendCommandWithTelnet(d.TelnetConn, cmd, d.SuperUserPromptRE, d.Timeout)
+	ctx, cancel := d.commandContext(ctx)
+	defer cancel()
+
+	cmdOut, err := SendCommandWithTelnet(ctx, d.TelnetConn, cmd, d.SuperUserPromptRE, d.pager())
 	if err != nil {
 		result.OK = false
 		result.Error = err
 		return result
 	}
 
+	markError(&d, &cmdOut)
 	result.CommandOutputs = append(result.CommandOutputs, cmdOut)
+	if err := commandError(result.CommandOutputs, ContinueOnError); err != nil {
+		result.OK = false
+		result.Error = err
+		return result
+	}
 	result.OK = true
 	return result
 }
 
-func (d NetDevice) SendCommandsWithTelnet(commands []string) data.Result {
+// SendCommandsWithTelnet sends commands to the device. The
+// device's timeout applies to each command.
+func (d NetDevice) SendCommandsWithTelnet(ctx context.Context, commands []string) data.Result {
 
 	result := data.Result{}
 
 	result.Device = d.Name
 	result.Timestamp = time.Now().Unix()
 
-	cmdOut, err := SendCommandsWithTelnet(d.TelnetConn, commands, d.SuperUserPromptRE, d.Timeout)
-	if err != nil {
+	for _, cmd := range commands {
+		res := d.SendCommandWithTelnet(ctx, cmd)
+		result.CommandOutputs = append(result.CommandOutputs, res.CommandOutputs...)
+		var cmdErr *CommandError
+		if res.Error != nil && !errors.As(res.Error, &cmdErr) {
+			result.OK = false
+			result.Error = res.Error
+			return result
+		}
+	}
+
+	if err := commandError(result.CommandOutputs, ContinueOnError); err != nil {
 		result.OK = false
 		result.Error = err
 		return result
 	}
-
-	result.CommandOutputs = cmdOut
 	result.OK = true
 	return result
 }
@@ -0,0 +1,436 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/automatico/jato/pkg/constant"
+	"golang.org/x/crypto/ssh"
+)
+
+// NETCONF capabilities, RFC 6241.
+const (
+	NetconfBase10    = "urn:ietf:params:netconf:base:1.0"
+	NetconfBase11    = "urn:ietf:params:netconf:base:1.1"
+	NetconfCandidate = "urn:ietf:params:netconf:capability:candidate:1.0"
+	NetconfValidate  = "urn:ietf:params:netconf:capability:validate:1.1"
+	// NetconfValidate10 is the validate capability of RFC 4741.
+	NetconfValidate10      = "urn:ietf:params:netconf:capability:validate:1.0"
+	NetconfConfirmedCommit = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+	// NetconfConfirmedCommit10 is the confirmed-commit capability
+	// of RFC 4741, it has no cancel-commit operation.
+	NetconfConfirmedCommit10 = "urn:ietf:params:netconf:capability:confirmed-commit:1.0"
+)
+
+// netconfNS is the namespace of the NETCONF protocol's elements.
+const netconfNS = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+// netconfEOM ends the messages of the NETCONF 1.0 framing.
+const netconfEOM = "]]>]]>"
+
+// netconfMaxChunk is the largest chunk size RFC 6242 allows.
+const netconfMaxChunk = 4294967295
+
+// NetconfParams hold the NETCONF connection parameters. The
+// SSH parameters, EG: host keys and jump hosts, also apply.
+type NetconfParams struct {
+	Port int `json:"port"`
+}
+
+func InitNetconfParams(s *NetconfParams) {
+	if s.Port == 0 {
+		s.Port = constant.NetconfPort
+	}
+}
+
+// RPCError is an error reported in an rpc-reply,
+// or in the errors of a RESTCONF response.
+type RPCError struct {
+	Type     string `xml:"error-type" json:"error-type"`
+	Tag      string `xml:"error-tag" json:"error-tag"`
+	Severity string `xml:"error-severity" json:"error-severity"`
+	Path     string `xml:"error-path" json:"error-path"`
+	Message  string `xml:"error-message" json:"error-message"`
+}
+
+func (e *RPCError) Error() string {
+	msg := strings.TrimSpace(e.Message)
+	if msg == "" {
+		msg = e.Tag
+	}
+	if e.Path != "" {
+		return fmt.Sprintf("rpc-error: %s: %s", strings.TrimSpace(e.Path), msg)
+	}
+	return fmt.Sprintf("rpc-error: %s", msg)
+}
+
+// rpcReply holds the parts of an rpc-reply checked by jato.
+type rpcReply struct {
+	MessageID string     `xml:"message-id,attr"`
+	Errors    []RPCError `xml:"rpc-error"`
+}
+
+// netconfHello holds the hello message of a NETCONF server.
+type netconfHello struct {
+	XMLName      xml.Name `xml:"hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id"`
+}
+
+// netconfMessage is a message read from a NETCONF server.
+type netconfMessage struct {
+	b   []byte
+	err error
+}
+
+// NetconfSession is a NETCONF session over the netconf
+// subsystem of an SSH connection. RPCs are sent one at a time.
+type NetconfSession struct {
+	// Capabilities advertised by the server.
+	Capabilities []string
+	SessionID    string
+
+	client  *ssh.Client
+	session *ssh.Session
+	w       io.Writer
+	r       *bufio.Reader
+	// chunked is set when both ends support the
+	// NETCONF 1.1 chunked framing.
+	chunked bool
+	msgs    chan netconfMessage
+	done    chan struct{}
+	once    sync.Once
+
+	closeOnce sync.Once
+	closeErr  error
+
+	mu sync.Mutex
+	id int
+}
+
+// ConnectWithNetconf dials a host, authenticates, starts the
+// netconf subsystem and exchanges hello messages. Connecting is
+// abandoned when the context is done.
+func ConnectWithNetconf(ctx context.Context, host string, port int, clientConfig *ssh.ClientConfig) (*NetconfSession, error) {
+	return connectWithNetconf(ctx, dialTCP, host, port, clientConfig)
+}
+
+// connectWithNetconf is ConnectWithNetconf with the
+// connection to the host made by dial.
+func connectWithNetconf(ctx context.Context, dial dialFunc, host string, port int, clientConfig *ssh.ClientConfig) (*NetconfSession, error) {
+	client, err := dialSSHClient(ctx, dial, fmt.Sprintf("%s:%d", host, port), clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := closeOnDone(ctx, client)
+	defer stop()
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, contextError(ctx, err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		client.Close()
+		return nil, contextError(ctx, fmt.Errorf("netconf: %v", err))
+	}
+
+	s := &NetconfSession{client: client, session: session, w: w, r: bufio.NewReader(r)}
+	if err := s.hello(); err != nil {
+		client.Close()
+		return nil, contextError(ctx, err)
+	}
+	if !stop() {
+		client.Close()
+		return nil, ctx.Err()
+	}
+
+	s.msgs = make(chan netconfMessage)
+	s.done = make(chan struct{})
+	go s.read()
+	return s, nil
+}
+
+// hello exchanges hello messages with the server and chooses
+// the framing of the session, chunked when both ends support
+// NETCONF 1.1.
+func (s *NetconfSession) hello() error {
+	hello := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>`+
+		`<hello xmlns="%s"><capabilities><capability>%s</capability><capability>%s</capability></capabilities></hello>`,
+		netconfNS, NetconfBase10, NetconfBase11)
+	if err := s.write([]byte(hello)); err != nil {
+		return err
+	}
+
+	b, err := s.readMessage()
+	if err != nil {
+		return fmt.Errorf("netconf: hello: %w", err)
+	}
+	var h netconfHello
+	if err := xml.Unmarshal(b, &h); err != nil {
+		return fmt.Errorf("netconf: hello: %v", err)
+	}
+	for i, c := range h.Capabilities {
+		h.Capabilities[i] = strings.TrimSpace(c)
+	}
+	s.Capabilities = h.Capabilities
+	s.SessionID = strings.TrimSpace(h.SessionID)
+
+	if !s.HasCapability(NetconfBase10) && !s.HasCapability(NetconfBase11) {
+		return errors.New("netconf: the server supports neither base:1.0 nor base:1.1")
+	}
+	s.chunked = s.HasCapability(NetconfBase11)
+	return nil
+}
+
+// HasCapability reports whether the server advertised a
+// capability. Parameters of the capability are ignored.
+// EG: urn:ietf:params:netconf:capability:candidate:1.0
+func (s *NetconfSession) HasCapability(capability string) bool {
+	for _, c := range s.Capabilities {
+		if c == capability || strings.HasPrefix(c, capability+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the NETCONF session and its SSH connection.
+// Closing a closed session does nothing.
+func (s *NetconfSession) Close() error {
+	s.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		s.RPC(ctx, "<close-session/>")
+		cancel()
+		s.once.Do(func() { close(s.done) })
+		s.closeErr = s.client.Close()
+	})
+	return s.closeErr
+}
+
+// write sends a message with the session's framing.
+func (s *NetconfSession) write(b []byte) error {
+	var msg []byte
+	if s.chunked {
+		msg = append([]byte(fmt.Sprintf("\n#%d\n", len(b))), b...)
+		msg = append(msg, "\n##\n"...)
+	} else {
+		msg = append(b, netconfEOM...)
+	}
+	_, err := s.w.Write(msg)
+	return err
+}
+
+// read reads messages until the session ends, delivering
+// them to the RPCs waiting for replies.
+func (s *NetconfSession) read() {
+	for {
+		b, err := s.readMessage()
+		select {
+		case s.msgs <- netconfMessage{b: b, err: err}:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			close(s.msgs)
+			return
+		}
+	}
+}
+
+// readMessage reads a message with the session's framing.
+func (s *NetconfSession) readMessage() ([]byte, error) {
+	if s.chunked {
+		return s.readChunked()
+	}
+	var msg []byte
+	for {
+		b, err := s.r.ReadSlice('>')
+		msg = append(msg, b...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasSuffix(msg, []byte(netconfEOM)) {
+			return bytes.TrimSpace(msg[:len(msg)-len(netconfEOM)]), nil
+		}
+	}
+}
+
+// readChunked reads a message of the chunked framing,
+// EG: \n#4\n<rpc\n#18\n message-id="1">...\n##\n
+func (s *NetconfSession) readChunked() ([]byte, error) {
+	var msg []byte
+	for {
+		for {
+			c, err := s.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if c == '#' {
+				break
+			}
+			if c != '\n' && c != '\r' && c != ' ' && c != '\t' {
+				return nil, fmt.Errorf("netconf: invalid chunk header: %q", c)
+			}
+		}
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "#" {
+			return msg, nil
+		}
+		size, err := strconv.ParseUint(line, 10, 32)
+		if err != nil || size == 0 || size > netconfMaxChunk {
+			return nil, fmt.Errorf("netconf: invalid chunk size: %q", line)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(s.r, chunk); err != nil {
+			return nil, err
+		}
+		msg = append(msg, chunk...)
+	}
+}
+
+// RPC sends an rpc with the operation in body and returns the
+// rpc-reply. An rpc-error with a severity of error is returned
+// as an *RPCError along with the reply. A reply that arrives
+// after the context is done is discarded.
+func (s *NetconfSession) RPC(ctx context.Context, body string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.id++
+	id := strconv.Itoa(s.id)
+	rpc := fmt.Sprintf(`<rpc message-id="%s" xmlns="%s">%s</rpc>`, id, netconfNS, body)
+	if err := s.write([]byte(rpc)); err != nil {
+		return "", err
+	}
+
+	for {
+		var m netconfMessage
+		var ok bool
+		select {
+		case m, ok = <-s.msgs:
+		case <-ctx.Done():
+			return "", fmt.Errorf("netconf: waiting for the reply to rpc %s: %w", id, ctx.Err())
+		}
+		if !ok {
+			return "", errors.New("netconf: the session is closed")
+		}
+		if m.err != nil {
+			return "", fmt.Errorf("netconf: %w", m.err)
+		}
+
+		var reply rpcReply
+		if err := xml.Unmarshal(m.b, &reply); err != nil {
+			return string(m.b), fmt.Errorf("netconf: invalid rpc-reply: %v", err)
+		}
+		// Replies to RPCs that timed out are discarded
+		if reply.MessageID != id {
+			continue
+		}
+		for _, e := range reply.Errors {
+			if e.Severity != "warning" {
+				e := e
+				return string(m.b), &e
+			}
+		}
+		return string(m.b), nil
+	}
+}
+
+// datastore returns the element of a datastore.
+// EG: <candidate/>
+func datastore(name string) string {
+	return fmt.Sprintf("<%s/>", name)
+}
+
+// subtreeFilter returns a subtree filter, none when filter is empty.
+func subtreeFilter(filter string) string {
+	if filter == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<filter type="subtree">%s</filter>`, filter)
+}
+
+// Get retrieves the running configuration and state data
+// selected by a subtree filter, all of it when it is empty.
+func (s *NetconfSession) Get(ctx context.Context, filter string) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<get>%s</get>", subtreeFilter(filter)))
+}
+
+// GetConfig retrieves the configuration of a datastore, EG:
+// running, selected by a subtree filter.
+func (s *NetconfSession) GetConfig(ctx context.Context, source, filter string) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<get-config><source>%s</source>%s</get-config>", datastore(source), subtreeFilter(filter)))
+}
+
+// EditConfig loads configuration, the content of the
+// config element, into a datastore. EG: candidate
+func (s *NetconfSession) EditConfig(ctx context.Context, target, config string) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<edit-config><target>%s</target><config>%s</config></edit-config>", datastore(target), config))
+}
+
+// Lock locks a datastore for the session.
+func (s *NetconfSession) Lock(ctx context.Context, target string) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<lock><target>%s</target></lock>", datastore(target)))
+}
+
+// Unlock releases the session's lock of a datastore.
+func (s *NetconfSession) Unlock(ctx context.Context, target string) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<unlock><target>%s</target></unlock>", datastore(target)))
+}
+
+// Validate validates the configuration of a datastore.
+func (s *NetconfSession) Validate(ctx context.Context, source string) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<validate><source>%s</source></validate>", datastore(source)))
+}
+
+// Commit commits the candidate configuration.
+func (s *NetconfSession) Commit(ctx context.Context) (string, error) {
+	return s.RPC(ctx, "<commit/>")
+}
+
+// CommitConfirmed commits the candidate configuration, the
+// commit is rolled back after timeout unless it is confirmed
+// with Commit.
+func (s *NetconfSession) CommitConfirmed(ctx context.Context, timeout time.Duration) (string, error) {
+	return s.RPC(ctx, fmt.Sprintf("<commit><confirmed/><confirm-timeout>%d</confirm-timeout></commit>", int(timeout.Seconds())))
+}
+
+// CancelCommit rolls back a confirmed commit
+// that was not confirmed yet.
+func (s *NetconfSession) CancelCommit(ctx context.Context) (string, error) {
+	return s.RPC(ctx, "<cancel-commit/>")
+}
+
+// DiscardChanges reverts the candidate configuration
+// to the running configuration.
+func (s *NetconfSession) DiscardChanges(ctx context.Context) (string, error) {
+	return s.RPC(ctx, "<discard-changes/>")
+}
@@ -0,0 +1,309 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// ConnectWithNetconf opens a NETCONF session to the device with
+// its credentials and SSH parameters, including its jump hosts.
+func (d *NetDevice) ConnectWithNetconf(ctx context.Context) error {
+	if err := supports(d, "netconf"); err != nil {
+		return err
+	}
+
+	InitNetconfParams(&d.NetconfParams)
+	clientConfig, err := SSHClientConfig(d.Credentials, d.SSHParams)
+	if err != nil {
+		return err
+	}
+	dial, err := jumpHosts.dialer(ctx, d.SSHParams.Proxy, d.SSHParams.JumpHosts, d.Credentials)
+	if err != nil {
+		return err
+	}
+	s, err := connectWithNetconf(ctx, dial, d.IP, d.NetconfParams.Port, clientConfig)
+	if err != nil {
+		return err
+	}
+	d.NetconfSession = s
+	return nil
+}
+
+// DisconnectNetconf closes the device's NETCONF session.
+func (d NetDevice) DisconnectNetconf() error {
+	if d.NetconfSession == nil {
+		return nil
+	}
+	return d.NetconfSession.Close()
+}
+
+// RunWithNetconf is the entrypoint to run a job with NETCONF.
+// Config is the XML content of an edit-config, each command is
+// an operation, EG: get-config running, or the XML of an RPC.
+// The replies are stored as XML in the command outputs.
+func RunWithNetconf(ctx context.Context, nd NetDevice, job Job) data.Result {
+
+	err := retry(ctx, job.Retry, func() error { return nd.ConnectWithNetconf(ctx) })
+	if err != nil {
+		return data.Result{
+			Device:    nd.Name,
+			Error:     err,
+			Timestamp: time.Now().Unix(),
+		}
+	}
+	defer nd.DisconnectNetconf()
+
+	return runNetconfJob(ctx, &nd, job)
+
+}
+
+// runNetconfJob runs a job over a device's NETCONF session. When
+// the configuration is committed to the candidate datastore, the
+// commands are its post-checks. A confirmed commit is cancelled
+// when they fail, other commits are kept and the error says so.
+func runNetconfJob(ctx context.Context, d *NetDevice, job Job) data.Result {
+
+	result := data.Result{}
+
+	result.Device = d.Name
+	result.Timestamp = time.Now().Unix()
+
+	if len(job.Expect) > 0 {
+		result.Error = errors.New("netconf: expect steps are not supported")
+		return result
+	}
+
+	s := d.NetconfSession
+	if len(job.Config) > 0 {
+		var cmdOut []data.CommandOutput
+		var err error
+		result.Commit, cmdOut, err = editNetconfConfig(ctx, d, strings.Join(job.Config, "\n"), job.Commit)
+		result.CommandOutputs = cmdOut
+		if err != nil {
+			result.OK = false
+			result.Error = err
+			return result
+		}
+	}
+
+	cmdOut := []data.CommandOutput{}
+	var err error
+	for _, cmd := range job.Commands {
+		var c data.CommandOutput
+		c, err = sendNetconfCommand(ctx, d, cmd)
+		if err != nil {
+			break
+		}
+		cmdOut = append(cmdOut, c)
+		if c.Failed && !continues(job.OnError) {
+			break
+		}
+	}
+	result.CommandOutputs = append(result.CommandOutputs, cmdOut...)
+	if err == nil {
+		err = commandError(result.CommandOutputs, job.OnError)
+	}
+
+	var cmdErr *CommandError
+	aborted := errors.As(err, &cmdErr) && cmdErr.Aborted
+	if result.Commit != nil && job.Commit.Confirmed > 0 && !aborted {
+		cmdCtx, cancel := d.commandContext(ctx)
+		if err != nil {
+			if cErr := cancelNetconfCommit(cmdCtx, s); cErr != nil {
+				err = fmt.Errorf("%v, unable to cancel the commit: %v", err, cErr)
+			} else {
+				result.Commit.RolledBack = true
+			}
+		} else {
+			_, err = s.Commit(cmdCtx)
+			result.Commit.Confirmed = err == nil
+		}
+		cancel()
+	} else if result.Commit != nil && err != nil && !aborted {
+		// NETCONF has no operation to roll back a commit
+		// that was not confirmed, unlike the CLI's rollback
+		err = fmt.Errorf("%v, the commit was not rolled back, it is only rolled back when it is confirmed", err)
+	}
+
+	if err != nil {
+		result.OK = false
+		result.Error = err
+		return result
+	}
+
+	result.OK = true
+	return result
+}
+
+// cancelNetconfCommit rolls back a confirmed commit. Without
+// cancel-commit, confirmed-commit 1.0, the session is closed:
+// the server rolls back a confirmed commit when the session
+// that issued it ends, RFC 4741 section 8.4.
+func cancelNetconfCommit(ctx context.Context, s *NetconfSession) error {
+	if s.HasCapability(NetconfConfirmedCommit) {
+		_, err := s.CancelCommit(ctx)
+		return err
+	}
+	return s.Close()
+}
+
+// netconfOutput returns the command output of an RPC's reply,
+// an *RPCError marks it as failed.
+func netconfOutput(cmd, reply string, err error) (data.CommandOutput, error) {
+	c := data.CommandOutput{
+		Command:  cmd,
+		CommandU: util.Underscorer(cmd),
+		Output:   reply,
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		c.Failed = true
+		c.Error = rpcErr.Error()
+		return c, nil
+	}
+	return c, err
+}
+
+// configTarget returns the datastore configuration is
+// edited in, candidate when the device has one.
+func configTarget(s *NetconfSession) string {
+	if s.HasCapability(NetconfCandidate) {
+		return "candidate"
+	}
+	return "running"
+}
+
+// sendNetconfCommand runs an operation or RPC. The device's
+// timeout applies to it.
+func sendNetconfCommand(ctx context.Context, d *NetDevice, cmd string) (data.CommandOutput, error) {
+	s := d.NetconfSession
+	ctx, cancel := d.commandContext(ctx)
+	defer cancel()
+
+	cmd = strings.TrimSpace(cmd)
+	if strings.HasPrefix(cmd, "<") {
+		reply, err := s.RPC(ctx, cmd)
+		return netconfOutput(cmd, reply, err)
+	}
+
+	op, arg := cmd, ""
+	if i := strings.IndexAny(cmd, " \t"); i >= 0 {
+		op, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	datastoreArg := func(def string) string {
+		if arg == "" {
+			return def
+		}
+		return arg
+	}
+
+	var reply string
+	var err error
+	switch op {
+	case "get":
+		reply, err = s.Get(ctx, arg)
+	case "get-config":
+		source := "running"
+		if arg != "" && !strings.HasPrefix(arg, "<") {
+			source = strings.Fields(arg)[0]
+			arg = strings.TrimSpace(arg[len(source):])
+		}
+		reply, err = s.GetConfig(ctx, source, arg)
+	case "lock":
+		reply, err = s.Lock(ctx, datastoreArg(configTarget(s)))
+	case "unlock":
+		reply, err = s.Unlock(ctx, datastoreArg(configTarget(s)))
+	case "validate":
+		reply, err = s.Validate(ctx, datastoreArg(configTarget(s)))
+	case "commit":
+		reply, err = s.Commit(ctx)
+	case "discard-changes":
+		reply, err = s.DiscardChanges(ctx)
+	default:
+		return data.CommandOutput{}, fmt.Errorf("netconf: unknown operation: %s", op)
+	}
+	return netconfOutput(cmd, reply, err)
+}
+
+// editNetconfConfig edits the device's configuration with the
+// content of an edit-config. The target datastore is locked for
+// the edit. On devices with a candidate datastore the candidate
+// is validated when opts.Check is set, which fails on devices
+// without the validate capability, committed and discarded on
+// failure. A commit is returned when the candidate was
+// committed.
+func editNetconfConfig(ctx context.Context, d *NetDevice, config string, opts CommitOptions) (*data.Commit, []data.CommandOutput, error) {
+	s := d.NetconfSession
+	target := configTarget(s)
+	candidate := target == "candidate"
+	cmdOut := []data.CommandOutput{}
+
+	if opts.Confirmed > 0 && !s.HasCapability(NetconfConfirmedCommit) && !s.HasCapability(NetconfConfirmedCommit10) {
+		return nil, cmdOut, notSupported(d, "confirmed commit")
+	}
+	if opts.Check && candidate && !s.HasCapability(NetconfValidate) && !s.HasCapability(NetconfValidate10) {
+		return nil, cmdOut, notSupported(d, "commit check")
+	}
+
+	rpc := func(name string, fn func(ctx context.Context) (string, error)) error {
+		ctx, cancel := d.commandContext(ctx)
+		defer cancel()
+		reply, err := fn(ctx)
+		c, err := netconfOutput(name, reply, err)
+		if err != nil {
+			return err
+		}
+		cmdOut = append(cmdOut, c)
+		if c.Failed {
+			return &ConfigError{Lines: []ConfigLineError{{Line: name, Message: c.Error}}}
+		}
+		return nil
+	}
+
+	if err := rpc("lock "+target, func(ctx context.Context) (string, error) { return s.Lock(ctx, target) }); err != nil {
+		return nil, cmdOut, fmt.Errorf("unable to lock the %s configuration: %w", target, err)
+	}
+	unlock := func(cause error) error {
+		ctx, cancel := d.commandContext(ctx)
+		defer cancel()
+		if candidate && cause != nil {
+			if _, err := s.DiscardChanges(ctx); err != nil {
+				return fmt.Errorf("%v, unable to discard the candidate configuration: %v", cause, err)
+			}
+		}
+		if _, err := s.Unlock(ctx, target); err != nil && cause == nil {
+			return fmt.Errorf("unable to unlock the %s configuration: %w", target, err)
+		}
+		return cause
+	}
+
+	err := rpc("edit-config "+target, func(ctx context.Context) (string, error) { return s.EditConfig(ctx, target, config) })
+	if err != nil || !candidate {
+		return nil, cmdOut, unlock(err)
+	}
+
+	if opts.Check {
+		if err := rpc("validate candidate", func(ctx context.Context) (string, error) { return s.Validate(ctx, target) }); err != nil {
+			return nil, cmdOut, unlock(err)
+		}
+	}
+
+	commit := &data.Commit{}
+	if opts.Confirmed > 0 {
+		err = rpc("commit confirmed", func(ctx context.Context) (string, error) {
+			return s.CommitConfirmed(ctx, time.Duration(opts.Confirmed)*time.Minute)
+		})
+	} else {
+		err = rpc("commit", s.Commit)
+	}
+	if err != nil {
+		return nil, cmdOut, unlock(err)
+	}
+	return commit, cmdOut, unlock(nil)
+}
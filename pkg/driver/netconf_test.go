@@ -0,0 +1,247 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+const (
+	base10      = "urn:ietf:params:netconf:base:1.0"
+	base11      = "urn:ietf:params:netconf:base:1.1"
+	candidate   = "urn:ietf:params:netconf:capability:candidate:1.0"
+	validate    = "urn:ietf:params:netconf:capability:validate:1.1"
+	confirmed   = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+	confirmed10 = "urn:ietf:params:netconf:capability:confirmed-commit:1.0"
+)
+
+// junosNetconf answers like the NETCONF server of a Juniper
+// Junos device. Operations in fail are answered with an rpc-error.
+func junosNetconf(fail ...string) func(op, rpc string) string {
+	return func(op, rpc string) string {
+		for _, f := range fail {
+			if op == f {
+				return "<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag>" +
+					"<error-severity>error</error-severity><error-message>\nsyntax error\n</error-message></rpc-error>"
+			}
+		}
+		switch op {
+		case "get-config":
+			return "<data><configuration><system><host-name>vmx-1</host-name></system></configuration></data>"
+		case "get-software-information":
+			return "<software-information><host-name>vmx-1</host-name><junos-version>20.4R1.12</junos-version></software-information>"
+		}
+		return "<ok/>"
+	}
+}
+
+// newNetconfDevice returns a Juniper Junos
+// device served by a fakeNetconf.
+func newNetconfDevice(t *testing.T, nc *fakeNetconf) driver.NetDevice {
+	t.Helper()
+	fs := newFakeNetconfServer(t, nc)
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "vmx-1", IP: "127.0.0.1", Vendor: "juniper", Platform: "junos", Connector: "netconf",
+		SSHParams:     driver.SSHParams{InsecureConnection: true},
+		NetconfParams: driver.NetconfParams{Port: fs.port()},
+		Credentials:   data.Credentials{Username: "admin", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRunWithNetconfFraming(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name         string
+		capabilities []string
+		wantChunked  bool
+	}
+	testCases := []testCase{
+		{name: "1.0", capabilities: []string{base10}},
+		{name: "1.1", capabilities: []string{base10, base11}, wantChunked: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			nc := &fakeNetconf{capabilities: tc.capabilities, respond: junosNetconf()}
+			d := newNetconfDevice(t, nc)
+
+			result := driver.Run(context.Background(), d, driver.Job{
+				Commands: []string{"get-config running <configuration><system/></configuration>", "<get-software-information/>"},
+			})
+			if !result.OK {
+				t.Fatalf("want OK, got %v", result.Error)
+			}
+			if len(result.CommandOutputs) != 2 {
+				t.Fatalf("want 2 replies, got %v", result.CommandOutputs)
+			}
+			if !strings.Contains(result.CommandOutputs[0].Output, "<host-name>vmx-1</host-name>") {
+				t.Errorf("want the configuration, got %q", result.CommandOutputs[0].Output)
+			}
+			if !strings.Contains(result.CommandOutputs[1].Output, "<junos-version>20.4R1.12</junos-version>") {
+				t.Errorf("want the software information, got %q", result.CommandOutputs[1].Output)
+			}
+			if nc.usedChunks() != tc.wantChunked {
+				t.Errorf("want chunked framing %t, got %t", tc.wantChunked, nc.usedChunks())
+			}
+
+			got := strings.Join(nc.received(), "|")
+			want := "get-config|get-software-information|close-session"
+			if got != want {
+				t.Errorf("want operations %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestRunWithNetconfConfig(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name         string
+		capabilities []string
+		fail         []string
+		commit       driver.CommitOptions
+		wantOps      []string
+		wantCommit   *data.Commit
+		wantErr      bool
+	}
+	testCases := []testCase{
+		{
+			name:         "running",
+			capabilities: []string{base10},
+			wantOps:      []string{"lock", "edit-config", "unlock", "get-software-information", "close-session"},
+		},
+		{
+			name:         "candidate",
+			capabilities: []string{base10, base11, candidate, validate},
+			commit:       driver.CommitOptions{Check: true},
+			wantOps:      []string{"lock", "edit-config", "validate", "commit", "unlock", "get-software-information", "close-session"},
+			wantCommit:   &data.Commit{},
+		},
+		{
+			name:         "check without validate",
+			capabilities: []string{base10, base11, candidate},
+			commit:       driver.CommitOptions{Check: true},
+			wantOps:      []string{"close-session"},
+			wantErr:      true,
+		},
+		{
+			// Only a confirmed commit is rolled back
+			name:         "post-check error without confirmed",
+			capabilities: []string{base10, candidate, confirmed},
+			fail:         []string{"get-software-information"},
+			wantOps:      []string{"lock", "edit-config", "commit", "unlock", "get-software-information", "close-session"},
+			wantCommit:   &data.Commit{},
+			wantErr:      true,
+		},
+		{
+			name:         "edit error",
+			capabilities: []string{base10, base11, candidate},
+			fail:         []string{"edit-config"},
+			wantOps:      []string{"lock", "edit-config", "discard-changes", "unlock", "close-session"},
+			wantErr:      true,
+		},
+		{
+			name:         "confirmed",
+			capabilities: []string{base10, candidate, confirmed},
+			commit:       driver.CommitOptions{Confirmed: 5},
+			wantOps:      []string{"lock", "edit-config", "commit", "unlock", "get-software-information", "commit", "close-session"},
+			wantCommit:   &data.Commit{Confirmed: true},
+		},
+		{
+			name:         "post-check error",
+			capabilities: []string{base10, candidate, confirmed},
+			fail:         []string{"get-software-information"},
+			commit:       driver.CommitOptions{Confirmed: 5},
+			wantOps:      []string{"lock", "edit-config", "commit", "unlock", "get-software-information", "cancel-commit", "close-session"},
+			wantCommit:   &data.Commit{RolledBack: true},
+			wantErr:      true,
+		},
+		{
+			name:         "confirmed 1.0",
+			capabilities: []string{base10, candidate, confirmed10},
+			commit:       driver.CommitOptions{Confirmed: 5},
+			wantOps:      []string{"lock", "edit-config", "commit", "unlock", "get-software-information", "commit", "close-session"},
+			wantCommit:   &data.Commit{Confirmed: true},
+		},
+		{
+			// The commit is rolled back by closing the session
+			name:         "confirmed 1.0 post-check error",
+			capabilities: []string{base10, candidate, confirmed10},
+			fail:         []string{"get-software-information"},
+			commit:       driver.CommitOptions{Confirmed: 5},
+			wantOps:      []string{"lock", "edit-config", "commit", "unlock", "get-software-information", "close-session"},
+			wantCommit:   &data.Commit{RolledBack: true},
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			nc := &fakeNetconf{capabilities: tc.capabilities, respond: junosNetconf(tc.fail...)}
+			d := newNetconfDevice(t, nc)
+
+			result := driver.Run(context.Background(), d, driver.Job{
+				Config:   []string{"<configuration><system><host-name>vmx-1</host-name></system></configuration>"},
+				Commands: []string{"<get-software-information/>"},
+				Commit:   tc.commit,
+			})
+			if tc.wantErr == result.OK {
+				t.Errorf("want error %t, got %v", tc.wantErr, result.Error)
+			}
+
+			got := strings.Join(nc.received(), "|")
+			want := strings.Join(tc.wantOps, "|")
+			if got != want {
+				t.Errorf("want operations %s, got %s", want, got)
+			}
+			if (result.Commit == nil) != (tc.wantCommit == nil) || (result.Commit != nil && *result.Commit != *tc.wantCommit) {
+				t.Errorf("want commit %+v, got %+v", tc.wantCommit, result.Commit)
+			}
+		})
+	}
+}
+
+func TestRunWithNetconfRPCError(t *testing.T) {
+	t.Parallel()
+	nc := &fakeNetconf{capabilities: []string{base10, candidate}, respond: junosNetconf("edit-config")}
+	d := newNetconfDevice(t, nc)
+
+	result := driver.Run(context.Background(), d, driver.Job{Config: []string{"<configuration/>"}})
+	var configErr *driver.ConfigError
+	if !errors.As(result.Error, &configErr) {
+		t.Fatalf("want a *driver.ConfigError, got %v", result.Error)
+	}
+	want := "configuration errors: 'edit-config candidate': rpc-error: syntax error"
+	if result.Error.Error() != want {
+		t.Errorf("want %q, got %q", want, result.Error)
+	}
+	if len(result.CommandOutputs) != 2 || !strings.Contains(result.CommandOutputs[1].Output, "<rpc-error>") {
+		t.Errorf("want the rpc-reply with the error, got %v", result.CommandOutputs)
+	}
+}
+
+func TestRunWithNetconfNotSupported(t *testing.T) {
+	t.Parallel()
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "netconf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"get"}})
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "does not support connector: netconf") {
+		t.Errorf("want netconf not supported, got %v", result.Error)
+	}
+}
@@ -0,0 +1,206 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// nxapiPath is the path of Cisco's NX-API.
+const nxapiPath = "/ins"
+
+// NX-API JSON-RPC methods.
+const (
+	// nxapiCLI returns the structured output of a command.
+	nxapiCLI = "cli"
+	// nxapiCLIASCII returns the text output of a command.
+	nxapiCLIASCII = "cli_ascii"
+)
+
+// nxapiRequest is a JSON-RPC request of a command.
+type nxapiRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  nxapiParams `json:"params"`
+	ID      int         `json:"id"`
+}
+
+type nxapiParams struct {
+	Cmd     string `json:"cmd"`
+	Version int    `json:"version"`
+}
+
+type nxapiResponse struct {
+	Result *struct {
+		Body json.RawMessage `json:"body"`
+		Msg  string          `json:"msg"`
+	} `json:"result"`
+	Error *NXAPIError `json:"error"`
+	ID    int         `json:"id"`
+}
+
+// NXAPIError is a JSON-RPC error returned by NX-API.
+type NXAPIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		// Msg is the error the CLI reported.
+		// EG: % Invalid command at '^' marker.
+		Msg string `json:"msg"`
+	} `json:"data"`
+}
+
+func (e *NXAPIError) Error() string {
+	if msg := strings.TrimSpace(e.Data.Msg); msg != "" {
+		return msg
+	}
+	return e.Message
+}
+
+// nxapiResponses is a batch of responses. A request
+// of one command is answered with a single response.
+type nxapiResponses []nxapiResponse
+
+func (r *nxapiResponses) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		var one nxapiResponse
+		if err := json.Unmarshal(b, &one); err != nil {
+			return err
+		}
+		*r = nxapiResponses{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]nxapiResponse)(r))
+}
+
+// nxapi runs commands with Cisco's NX-API.
+type nxapi struct {
+	d      *NetDevice
+	client *http.Client
+}
+
+// run runs commands with a method in a batch and returns the
+// response to each of the commands, in order.
+func (a *nxapi) run(ctx context.Context, cmds []string, method string) ([]nxapiResponse, error) {
+	reqs := make([]nxapiRequest, len(cmds))
+	for i, cmd := range cmds {
+		reqs[i] = nxapiRequest{JSONRPC: "2.0", Method: method, Params: nxapiParams{Cmd: cmd, Version: 1}, ID: i + 1}
+	}
+
+	var resps nxapiResponses
+	if err := postJSON(ctx, a.client, a.d.Credentials, a.d.apiURL(nxapiPath), "application/json-rpc", reqs, &resps); err != nil {
+		return nil, fmt.Errorf("nxapi: %w", err)
+	}
+
+	// The commands after a failed command may not be answered
+	ordered := make([]nxapiResponse, len(cmds))
+	for _, r := range resps {
+		if r.ID >= 1 && r.ID <= len(cmds) {
+			ordered[r.ID-1] = r
+		}
+	}
+	return ordered, nil
+}
+
+// command runs a command with the cli_ascii method, show commands
+// are run with the cli method too. Commands without structured
+// output are returned as text.
+func (a *nxapi) command(ctx context.Context, cmd string) (data.CommandOutput, error) {
+	c := data.CommandOutput{Command: cmd}
+
+	resps, err := a.run(ctx, []string{cmd}, nxapiCLIASCII)
+	if err != nil {
+		return c, err
+	}
+	r := resps[0]
+	switch {
+	case r.ID == 0:
+		return c, errors.New("nxapi: no response to the command")
+	case r.Error != nil:
+		c.Failed = true
+		c.Error = r.Error.Error()
+		return c, nil
+	case r.Result != nil:
+		// The result is null when the command has no output
+		c.Output = r.Result.Msg
+	}
+	if !showCommand(cmd) {
+		return c, nil
+	}
+
+	resps, err = a.run(ctx, []string{cmd}, nxapiCLI)
+	if err != nil {
+		return c, err
+	}
+	// EG: Structured output unsupported
+	if r := resps[0]; r.Error == nil && r.Result != nil {
+		c.JSON = r.Result.Body
+	}
+	return c, nil
+}
+
+// reads reports whether a command only reads from the device.
+func (a *nxapi) reads(cmd string) bool {
+	return showCommand(cmd)
+}
+
+// config sends configuration lines in a single batch,
+// NX-API runs them in configuration mode.
+func (a *nxapi) config(ctx context.Context, lines []string) ([]data.CommandOutput, error) {
+	cmdOut := []data.CommandOutput{}
+	resps, err := a.run(ctx, lines, nxapiCLIASCII)
+	if err != nil {
+		return cmdOut, err
+	}
+
+	for i, line := range lines {
+		r := resps[i]
+		if r.ID == 0 {
+			// The line was not run
+			break
+		}
+		c := data.CommandOutput{Command: line, CommandU: util.Underscorer(line)}
+		if r.Result != nil {
+			c.Output = r.Result.Msg
+		}
+		if r.Error != nil {
+			c.Failed = true
+			c.Error = r.Error.Error()
+		}
+		cmdOut = append(cmdOut, c)
+	}
+	return cmdOut, configError(cmdOut)
+}
+
+// RunWithNXAPI is the entrypoint to run a job with Cisco's NX-API.
+func RunWithNXAPI(ctx context.Context, nd NetDevice, job Job) data.Result {
+	api, err := nd.newNXAPI()
+	if err != nil {
+		return data.Result{
+			Device:    nd.Name,
+			Error:     err,
+			Timestamp: time.Now().Unix(),
+		}
+	}
+	return runAPIJob(ctx, &nd, job, api)
+}
+
+func (d *NetDevice) newNXAPI() (*nxapi, error) {
+	if err := supports(d, "nxapi"); err != nil {
+		return nil, err
+	}
+	InitHTTPParams(&d.HTTPParams)
+	client, err := httpClient(d.HTTPParams)
+	if err != nil {
+		return nil, err
+	}
+	return &nxapi{d: d, client: client}, nil
+}
@@ -0,0 +1,206 @@
+package driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// fakeNXAPI answers JSON-RPC requests like the NX-API of a
+// Cisco NX-OS device. It records the commands it runs.
+type fakeNXAPI struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (f *fakeNXAPI) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.cmds...)
+}
+
+func (f *fakeNXAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ins" || r.Header.Get("Content-Type") != "application/json-rpc" {
+		http.NotFound(w, r)
+		return
+	}
+	var reqs []struct {
+		Method string `json:"method"`
+		Params struct {
+			Cmd string `json:"cmd"`
+		} `json:"params"`
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resps []map[string]interface{}
+	for _, req := range reqs {
+		cmd := req.Params.Cmd
+		f.mu.Lock()
+		f.cmds = append(f.cmds, req.Method+":"+cmd)
+		f.mu.Unlock()
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		var errMsg string
+		switch {
+		case strings.HasPrefix(cmd, "bad"):
+			errMsg = "% Invalid command at '^' marker.\n"
+		case cmd == "show running-config" && req.Method == "cli":
+			errMsg = "Structured output unsupported"
+		case cmd == "show version" && req.Method == "cli":
+			resp["result"] = map[string]interface{}{"body": map[string]string{"chassis_id": "Nexus9000 C9300v Chassis", "nxos_ver_str": "9.3(8)"}}
+		case cmd == "show version":
+			resp["result"] = map[string]string{"msg": "Cisco Nexus Operating System (NX-OS) Software\nNXOS: version 9.3(8)\n"}
+		case cmd == "show running-config":
+			resp["result"] = map[string]string{"msg": "hostname nxos-1\n"}
+		case req.Method == "cli":
+			resp["result"] = map[string]interface{}{"body": map[string]string{}}
+		default:
+			// Configuration lines have no output
+			resp["result"] = nil
+		}
+		if errMsg != "" {
+			delete(resp, "result")
+			resp["error"] = map[string]interface{}{
+				"code": -32602, "message": "Invalid params", "data": map[string]string{"msg": errMsg},
+			}
+		}
+		resps = append(resps, resp)
+		if errMsg != "" {
+			// The commands after an error are not run
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json-rpc")
+	if len(resps) == 1 {
+		json.NewEncoder(w).Encode(resps[0])
+		return
+	}
+	json.NewEncoder(w).Encode(resps)
+}
+
+func TestRunWithNXAPI(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name     string
+		job      driver.Job
+		wantOK   bool
+		wantErr  string
+		wantCmds []string
+		check    func(t *testing.T, result data.Result)
+	}
+	testCases := []testCase{
+		{
+			name:     "commands",
+			job:      driver.Job{Commands: []string{"show version", "show running-config"}},
+			wantOK:   true,
+			wantCmds: []string{"cli_ascii:show version", "cli:show version", "cli_ascii:show running-config", "cli:show running-config"},
+			check: func(t *testing.T, result data.Result) {
+				version := result.CommandOutputs[0]
+				if !strings.Contains(version.Output, "9.3(8)") || version.CommandU != "show_version" {
+					t.Errorf("want the text output, got %+v", version)
+				}
+				var v struct {
+					ChassisID string `json:"chassis_id"`
+				}
+				if err := json.Unmarshal(version.JSON, &v); err != nil || v.ChassisID != "Nexus9000 C9300v Chassis" {
+					t.Errorf("want the JSON output, got %s", version.JSON)
+				}
+				config := result.CommandOutputs[1]
+				if config.Output != "hostname nxos-1\n" || config.JSON != nil {
+					t.Errorf("want text output only, got %+v", config)
+				}
+			},
+		},
+		{
+			// Commands that change the device are sent once
+			name:     "commands that are not show commands",
+			job:      driver.Job{Commands: []string{"clear counters", "copy running-config startup-config"}},
+			wantOK:   true,
+			wantCmds: []string{"cli_ascii:clear counters", "cli_ascii:copy running-config startup-config"},
+		},
+		{
+			name:     "command error",
+			job:      driver.Job{Commands: []string{"bad command", "show clock"}},
+			wantErr:  "% Invalid command at '^' marker.",
+			wantCmds: []string{"cli_ascii:bad command", "cli_ascii:show clock", "cli:show clock"},
+			check: func(t *testing.T, result data.Result) {
+				if len(result.CommandOutputs) != 2 || !result.CommandOutputs[0].Failed || result.CommandOutputs[1].Failed {
+					t.Errorf("want the first command marked failed, got %+v", result.CommandOutputs)
+				}
+			},
+		},
+		{
+			name:     "config",
+			job:      driver.Job{Config: []string{"hostname nxos-1", "feature bgp"}, Commands: []string{"show clock"}},
+			wantOK:   true,
+			wantCmds: []string{"cli_ascii:hostname nxos-1", "cli_ascii:feature bgp", "cli_ascii:show clock", "cli:show clock"},
+		},
+		{
+			name:     "config error",
+			job:      driver.Job{Config: []string{"hostname nxos-1", "bad line", "feature bgp"}, Commands: []string{"show clock"}},
+			wantErr:  "configuration errors: 'bad line': % Invalid command at '^' marker.",
+			wantCmds: []string{"cli_ascii:hostname nxos-1", "cli_ascii:bad line"},
+			check: func(t *testing.T, result data.Result) {
+				var configErr *driver.ConfigError
+				if !errors.As(result.Error, &configErr) {
+					t.Errorf("want a *driver.ConfigError, got %v", result.Error)
+				}
+				if len(result.CommandOutputs) != 2 {
+					t.Errorf("want the lines that ran, got %+v", result.CommandOutputs)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeNXAPI{}
+			srv := newFakeAPIServer(t, api.ServeHTTP)
+			creds := data.Credentials{Username: "admin", Password: "secret"}
+			d := newAPIDevice(t, srv, "cisco", "nxos", "nxapi", driver.HTTPParams{CAFile: apiCAFile(t, srv)}, creds)
+
+			result := driver.Run(context.Background(), d, tc.job)
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			if tc.wantErr != "" && (result.Error == nil || !strings.Contains(result.Error.Error(), tc.wantErr)) {
+				t.Errorf("want error %q, got %v", tc.wantErr, result.Error)
+			}
+			got := strings.Join(api.received(), "|")
+			want := strings.Join(tc.wantCmds, "|")
+			if got != want {
+				t.Errorf("want commands %s, got %s", want, got)
+			}
+			if tc.check != nil {
+				tc.check(t, result)
+			}
+		})
+	}
+}
+
+func TestRunWithNXAPIUnauthorized(t *testing.T) {
+	t.Parallel()
+	srv := newFakeAPIServer(t, (&fakeNXAPI{}).ServeHTTP)
+	creds := data.Credentials{Username: "admin", Password: "wrong"}
+	d := newAPIDevice(t, srv, "cisco", "nxos", "nxapi", driver.HTTPParams{InsecureSkipVerify: true}, creds)
+
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+	var httpErr *driver.HTTPError
+	if !errors.As(result.Error, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want a 401 *driver.HTTPError, got %v", result.Error)
+	}
+}
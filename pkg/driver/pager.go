@@ -0,0 +1,92 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Pager answers the prompt a platform pauses long output with
+// when paging was not disabled by the session commands.
+// EG: --More--
+type Pager struct {
+	Prompt *regexp.Regexp
+	// Response is sent to show the next page. EG: a space
+	Response string
+}
+
+// Paginator is implemented by drivers of platforms
+// that page long output.
+type Paginator interface {
+	Pager() *Pager
+}
+
+var (
+	// backspaceRE matches the backspaces and spaces a
+	// device erases a pager prompt with.
+	backspaceRE = regexp.MustCompile(`[ ]*\x08+[ ]*\x08*`)
+	// eraseLineRE matches a line erased with spaces
+	// between carriage returns.
+	eraseLineRE = regexp.MustCompile(`\r[ ]{2,}\r`)
+	// ansiRE matches ANSI escape sequences.
+	ansiRE = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+)
+
+// cleanOutput strips the backspaces, erased lines and
+// escape sequences devices write when paging.
+func cleanOutput(s string) string {
+	s = backspaceRE.ReplaceAllString(s, "")
+	s = eraseLineRE.ReplaceAllString(s, "")
+	return ansiRE.ReplaceAllString(s, "")
+}
+
+// ReadPaged reads from r until expect is matched. Each time the
+// output stops at the pager's prompt, the prompt is removed and
+// the pager's response is written to w. The output is returned
+// without pager artefacts. A nil pager reads with ReadUntil.
+func ReadPaged(ctx context.Context, r io.Reader, w io.Writer, expect *regexp.Regexp, pager *Pager) (string, error) {
+	if pager == nil {
+		out, err := ReadUntil(ctx, r, expect)
+		return cleanOutput(out), err
+	}
+
+	// r is read from several times, it must keep
+	// what arrives between reads.
+	if _, ok := r.(ContextReader); !ok {
+		ar := NewAsyncReader(r)
+		defer ar.Close()
+		r = ar
+	}
+
+	re := regexp.MustCompile(fmt.Sprintf(`(?:%s)|(?:%s)`, expect, pager.Prompt))
+	out := ""
+	for {
+		more, err := ReadUntil(ctx, r, re)
+		out += more
+		if err != nil {
+			return cleanOutput(out), err
+		}
+		line := lastLine(out)
+		loc := pager.Prompt.FindStringIndex(line)
+		if loc == nil {
+			return cleanOutput(out), nil
+		}
+		out = out[:len(out)-len(line)+loc[0]]
+		if _, err := io.WriteString(w, pager.Response); err != nil {
+			return cleanOutput(out), err
+		}
+	}
+}
+
+// pager returns the pager of the device's driver, if it has one.
+func (d *NetDevice) pager() *Pager {
+	drv, err := d.driver()
+	if err != nil {
+		return nil
+	}
+	if p, ok := drv.(Paginator); ok {
+		return p.Pager()
+	}
+	return nil
+}
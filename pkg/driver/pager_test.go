@@ -0,0 +1,144 @@
+package driver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// pagingDevice writes its first page when it is created and the
+// next page each time a space is written to it.
+type pagingDevice struct {
+	pw    *io.PipeWriter
+	pages chan string
+}
+
+func newPagingDevice(pages []string) (*pagingDevice, io.Reader) {
+	pr, pw := io.Pipe()
+	pd := &pagingDevice{pw: pw, pages: make(chan string, len(pages))}
+	for _, p := range pages {
+		pd.pages <- p
+	}
+	pd.next()
+	return pd, pr
+}
+
+func (pd *pagingDevice) next() {
+	select {
+	case p := <-pd.pages:
+		go pd.pw.Write([]byte(p))
+	default:
+	}
+}
+
+func (pd *pagingDevice) Write(p []byte) (int, error) {
+	if string(p) == " " {
+		pd.next()
+	}
+	return len(p), nil
+}
+
+func TestReadPaged(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name  string
+		pages []string
+		pager *driver.Pager
+		want  string
+	}
+	iosPager := &driver.Pager{Prompt: regexp.MustCompile(`--More--`), Response: " "}
+	junosPager := &driver.Pager{Prompt: regexp.MustCompile(`---\(more( \d+%)?\)---`), Response: " "}
+	testCases := []testCase{
+		{
+			name:  "no pager",
+			pages: []string{"show version\r\nline 1\r\nrouter#"},
+			want:  "show version\r\nline 1\r\nrouter#",
+		},
+		{
+			name: "ios",
+			pages: []string{
+				"show running-config\r\nline 1\r\n --More-- ",
+				"\x08\x08\x08\x08\x08\x08\x08\x08\x08        \x08\x08\x08\x08\x08\x08\x08\x08\x08line 2\r\n --More-- ",
+				"\x08\x08\x08\x08\x08\x08\x08\x08\x08        \x08\x08\x08\x08\x08\x08\x08\x08\x08line 3\r\nrouter#",
+			},
+			pager: iosPager,
+			want:  "show running-config\r\nline 1\r\nline 2\r\nline 3\r\nrouter#",
+		},
+		{
+			name: "junos",
+			pages: []string{
+				"show configuration\r\nline 1\r\n---(more 50%)---",
+				"\r                                        \rline 2\r\n\r\nadmin@vmx-1> ",
+			},
+			pager: junosPager,
+			want:  "show configuration\r\nline 1\r\nline 2\r\n\r\nadmin@vmx-1> ",
+		},
+	}
+
+	for _, tc := range testCases {
+		pd, r := newPagingDevice(tc.pages)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		out, err := driver.ReadPaged(ctx, r, pd, regexp.MustCompile(`(?m)(router#|admin@vmx-1> )$`), tc.pager)
+		cancel()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if out != tc.want {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, out)
+		}
+	}
+}
+
+// pagingConn is a Telnet connection to a pagingDevice.
+type pagingConn struct {
+	net.Conn
+	pd *pagingDevice
+}
+
+func (pc pagingConn) Write(p []byte) (int, error) {
+	return pc.pd.Write(p)
+}
+
+func TestSendCommandsPages(t *testing.T) {
+	t.Parallel()
+	pages := []string{
+		"show running-config\r\nline 1\r\n --More-- ",
+		"\x08\x08\x08\x08\x08\x08\x08\x08\x08        \x08\x08\x08\x08\x08\x08\x08\x08\x08line 2\r\nrouter#",
+	}
+
+	for _, connector := range []string{"ssh", "telnet"} {
+		connector := connector
+		t.Run(connector, func(t *testing.T) {
+			t.Parallel()
+			d, err := driver.NewDevice(driver.NetDevice{Name: "iosv-1", Vendor: "cisco", Platform: "ios", Connector: connector})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Timeout = 1
+
+			pd, r := newPagingDevice(pages)
+			var result data.Result
+			if connector == "ssh" {
+				d.SSHConn = driver.SSHConn{StdIn: pd, StdOut: r}
+				result = d.SendCommandsWithSSH(context.Background(), []string{"show running-config"})
+			} else {
+				d.TelnetConn = driver.TelnetConn{Conn: pagingConn{pd: pd}, StdOut: r}
+				result = d.SendCommandsWithTelnet(context.Background(), []string{"show running-config"})
+			}
+			if !result.OK {
+				t.Fatalf("want OK, got %v", result.Error)
+			}
+			out := result.CommandOutputs[0].Output
+			if !strings.Contains(out, "line 1\r\nline 2") || strings.Contains(out, "--More--") {
+				t.Errorf("want the output paged through, got %q", out)
+			}
+		})
+	}
+}
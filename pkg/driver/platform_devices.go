@@ -0,0 +1,92 @@
+package driver
+
+import "fmt"
+
+// The constructors of the built-in platforms, from before they
+// were described by definition files. They are kept for the
+// packages that use them.
+
+// newPlatformDevice initializes a device with the
+// driver registered for a vendor and platform. The
+// built-in platforms are always registered, it panics
+// when one is not.
+func newPlatformDevice(d NetDevice, vendor, platform string) NetDevice {
+	d.Vendor, d.Platform = vendor, platform
+	nd, err := NewDevice(d)
+	if err != nil {
+		panic(fmt.Sprintf("driver: built-in platform %s %s: %v", vendor, platform, err))
+	}
+	return nd
+}
+
+// NewAristaEOSDevice takes a NetDevice and initializes
+// a AristaEOSDevice.
+//
+// Deprecated: use NewDevice with the vendor arista and platform eos.
+func NewAristaEOSDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "arista", "eos")
+}
+
+// NewArubaAOSCXDevice takes a NetDevice and initializes
+// a ArubaAOSCXDevice.
+//
+// Deprecated: use NewDevice with the vendor aruba and platform aoscx.
+func NewArubaAOSCXDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "aruba", "aoscx")
+}
+
+// NewCiscoAireOSDevice takes a NetDevice and initializes
+// a CiscoAireOSDevice.
+//
+// Deprecated: use NewDevice with the vendor cisco and platform aireos.
+func NewCiscoAireOSDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "cisco", "aireos")
+}
+
+// NewCiscoASADevice takes a NetDevice and initializes
+// a CiscoASADevice.
+//
+// Deprecated: use NewDevice with the vendor cisco and platform asa.
+func NewCiscoASADevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "cisco", "asa")
+}
+
+// NewCiscoIOSDevice takes a NetDevice and initializes
+// a CiscoIOSDevice.
+//
+// Deprecated: use NewDevice with the vendor cisco and platform ios.
+func NewCiscoIOSDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "cisco", "ios")
+}
+
+// NewCiscoIOSXRDevice takes a NetDevice and initializes
+// a CiscoIOSXRDevice.
+//
+// Deprecated: use NewDevice with the vendor cisco and platform iosxr.
+func NewCiscoIOSXRDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "cisco", "iosxr")
+}
+
+// NewCiscoNXOSDevice takes a NetDevice and initializes
+// a CiscoNXOSDevice.
+//
+// Deprecated: use NewDevice with the vendor cisco and platform nxos.
+func NewCiscoNXOSDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "cisco", "nxos")
+}
+
+// NewCiscoSMBDevice takes a NetDevice and initializes
+// a CiscoSMBDevice.
+//
+// Deprecated: use NewDevice with the vendor cisco and platform smb.
+func NewCiscoSMBDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "cisco", "smb")
+}
+
+// NewJuniperJunosDevice takes a NetDevice and initializes
+// a JuniperJunosDevice.
+//
+// Deprecated: use NewDevice with the vendor juniper and platform junos.
+func NewJuniperJunosDevice(d NetDevice) NetDevice {
+	return newPlatformDevice(d, "juniper", "junos")
+}
@@ -0,0 +1,134 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// ContextReader is implemented by readers whose reads
+// can be abandoned when a context is done.
+type ContextReader interface {
+	ReadContext(ctx context.Context, p []byte) (int, error)
+}
+
+type chunk struct {
+	b   []byte
+	err error
+}
+
+// AsyncReader reads from an io.Reader in a goroutine so reads
+// can be abandoned when a context is done without losing the
+// data that arrives afterwards. Close stops the goroutine once
+// the underlying reader is unblocked.
+type AsyncReader struct {
+	size    int
+	ch      chan chunk
+	done    chan struct{}
+	close   sync.Once
+	pending []byte
+	err     error
+}
+
+// NewAsyncReader starts reading from r.
+func NewAsyncReader(r io.Reader) *AsyncReader {
+	return NewAsyncReaderSize(r, 8192)
+}
+
+// NewAsyncReaderSize starts reading from r, size bytes at
+// most at a time. A small size suits readers that block until
+// the buffer they are given is full.
+func NewAsyncReaderSize(r io.Reader, size int) *AsyncReader {
+	ar := &AsyncReader{
+		size: size,
+		ch:   make(chan chunk),
+		done: make(chan struct{}),
+	}
+	go ar.pump(r)
+	return ar
+}
+
+func (ar *AsyncReader) pump(r io.Reader) {
+	for {
+		buf := make([]byte, ar.size)
+		n, err := r.Read(buf)
+		select {
+		case ar.ch <- chunk{b: buf[:n], err: err}:
+		case <-ar.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ReadContext reads into p, returning the context's
+// error if it is done before any data arrives.
+func (ar *AsyncReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if len(ar.pending) == 0 {
+		if ar.err != nil {
+			return 0, ar.err
+		}
+		select {
+		case c := <-ar.ch:
+			ar.pending = c.b
+			ar.err = c.err
+		case <-ar.done:
+			return 0, io.ErrClosedPipe
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	n := copy(p, ar.pending)
+	ar.pending = ar.pending[n:]
+	if n == 0 && ar.err != nil {
+		return 0, ar.err
+	}
+	return n, nil
+}
+
+func (ar *AsyncReader) Read(p []byte) (int, error) {
+	return ar.ReadContext(context.Background(), p)
+}
+
+// Close stops the reader.
+func (ar *AsyncReader) Close() error {
+	ar.close.Do(func() { close(ar.done) })
+	return nil
+}
+
+// ReadUntil reads from r until the output matches expect. When the
+// context is done first, a *TimeoutError is returned for a deadline
+// and the context's error otherwise, along with the partial output.
+// Readers that are not a ContextReader are wrapped in an AsyncReader
+// that is abandoned if the context is done.
+func ReadUntil(ctx context.Context, r io.Reader, expect *regexp.Regexp) (string, error) {
+	cr, ok := r.(ContextReader)
+	if !ok {
+		ar := NewAsyncReader(r)
+		defer ar.Close()
+		cr = ar
+	}
+
+	buf := make([]byte, 8192)
+	out := []byte{}
+	for {
+		n, err := cr.ReadContext(ctx, buf)
+		out = append(out, buf[:n]...)
+		// Uncommenting this might help you debug if you are coming into
+		// errors with timeouts when correct details entered
+		// logger.Debug(string(out))
+		if expect.Match(out) {
+			return string(out), nil
+		}
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return string(out), &TimeoutError{Expect: expect, Output: string(out)}
+			}
+			return string(out), err
+		}
+	}
+}
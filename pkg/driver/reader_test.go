@@ -0,0 +1,54 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/driver"
+)
+
+func TestReadUntil(t *testing.T) {
+	t.Parallel()
+	r, w := io.Pipe()
+	defer w.Close()
+	ar := driver.NewAsyncReader(r)
+	defer ar.Close()
+	prompt := regexp.MustCompile(`(?m)^router#$`)
+
+	go w.Write([]byte("show clock\r\n12:00:00\r\nrouter#"))
+
+	got, err := driver.ReadUntil(context.Background(), ar, prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "show clock\r\n12:00:00\r\nrouter#"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// Nothing is written so the deadline passes.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = driver.ReadUntil(ctx, ar, prompt)
+	var timeoutErr *driver.TimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want a timeout error, got %v", err)
+	}
+
+	// Output that arrives after the timeout is not lost.
+	go w.Write([]byte("router#"))
+	got, err = driver.ReadUntil(context.Background(), ar, prompt)
+	if err != nil || got != "router#" {
+		t.Errorf("want %q, got %q, %v", "router#", got, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = driver.ReadUntil(ctx, ar, prompt)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want %v, got %v", context.Canceled, err)
+	}
+}
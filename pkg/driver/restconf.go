@@ -0,0 +1,287 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/internal/util"
+	"github.com/automatico/jato/pkg/data"
+)
+
+// restconfRoot is the root of the RESTCONF
+// API of the supported platforms.
+const restconfRoot = "/restconf"
+
+// RESTCONF media types.
+const (
+	restconfJSON = "application/yang-data+json"
+	restconfXML  = "application/yang-data+xml"
+)
+
+// RESTCONFRequest is a request to a path of the RESTCONF
+// API. EG: GET /data/ietf-interfaces:interfaces
+type RESTCONFRequest struct {
+	Method string
+	// Path is relative to the RESTCONF root, /restconf.
+	Path string
+	// Payload is the JSON or XML body of a PUT, PATCH or POST.
+	Payload string
+	// Format is the format, json or xml, the response is
+	// requested in, the payload's format when it is empty.
+	Format string
+}
+
+// ParseRESTCONFRequest parses a request of a commands file,
+// the method, the path and the payload or the format of the
+// response. EG:
+//
+//	GET /data/ietf-interfaces:interfaces xml
+//	PATCH /data/Cisco-IOS-XE-native:native {"hostname": "csr-1"}
+func ParseRESTCONFRequest(s string) (RESTCONFRequest, error) {
+	req := RESTCONFRequest{}
+	fields := []string{}
+	rest := strings.TrimSpace(s)
+	for len(fields) < 2 && rest != "" {
+		field := rest
+		if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			field = rest[:i]
+		}
+		fields = append(fields, field)
+		rest = strings.TrimSpace(rest[len(field):])
+	}
+	if len(fields) < 2 {
+		return req, fmt.Errorf("restconf: invalid request: %s", s)
+	}
+	req.Method, req.Path = strings.ToUpper(fields[0]), fields[1]
+
+	switch req.Method {
+	case http.MethodGet, http.MethodDelete:
+		switch rest {
+		case "", "json", "xml":
+			req.Format = rest
+		default:
+			return req, fmt.Errorf("restconf: %s takes no payload: %s", req.Method, s)
+		}
+	case http.MethodPut, http.MethodPatch:
+		if rest == "" {
+			return req, fmt.Errorf("restconf: %s needs a payload: %s", req.Method, s)
+		}
+		req.Payload = rest
+	case http.MethodPost:
+		req.Payload = rest
+	default:
+		return req, fmt.Errorf("restconf: unknown method: %s", fields[0])
+	}
+	return req, nil
+}
+
+// format returns the format the response is requested in.
+func (r RESTCONFRequest) format() string {
+	switch {
+	case r.Format != "":
+		return r.Format
+	case strings.HasPrefix(r.Payload, "<"):
+		return "xml"
+	}
+	return "json"
+}
+
+// RESTCONFError is returned when a device answers a
+// request with errors. Errors holds the errors of the
+// response's body, EG: the invalid value of a PATCH.
+type RESTCONFError struct {
+	*HTTPError
+	Errors []RPCError
+}
+
+func (e *RESTCONFError) Error() string {
+	msgs := []string{}
+	for _, r := range e.Errors {
+		msg := strings.TrimSpace(r.Message)
+		if msg == "" {
+			msg = r.Tag
+		}
+		if path := strings.TrimSpace(r.Path); path != "" {
+			msg = fmt.Sprintf("%s: %s", path, msg)
+		}
+		msgs = append(msgs, msg)
+	}
+	return fmt.Sprintf("restconf: %s: %s", e.Status, strings.Join(msgs, ", "))
+}
+
+func (e *RESTCONFError) Unwrap() error {
+	return e.HTTPError
+}
+
+// restconfErrors returns the errors of the body of an error
+// response, in the JSON or XML encoding of ietf-restconf.
+func restconfErrors(body []byte) []RPCError {
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("<")) {
+		var errs struct {
+			XMLName xml.Name   `xml:"errors"`
+			Errors  []RPCError `xml:"error"`
+		}
+		if xml.Unmarshal(body, &errs) != nil {
+			return nil
+		}
+		return errs.Errors
+	}
+
+	type errorList struct {
+		Error []RPCError `json:"error"`
+	}
+	var errs struct {
+		Errors       *errorList `json:"ietf-restconf:errors"`
+		ErrorsNoName *errorList `json:"errors"`
+	}
+	if json.Unmarshal(body, &errs) != nil {
+		return nil
+	}
+	switch {
+	case errs.Errors != nil:
+		return errs.Errors.Error
+	case errs.ErrorsNoName != nil:
+		return errs.ErrorsNoName.Error
+	}
+	return nil
+}
+
+// RESTCONFClient sends requests to the RESTCONF API of a device.
+type RESTCONFClient struct {
+	d      *NetDevice
+	client *http.Client
+}
+
+// NewRESTCONFClient returns a client of the RESTCONF API of
+// a device with its credentials and HTTP parameters.
+func NewRESTCONFClient(d NetDevice) (*RESTCONFClient, error) {
+	if err := supports(&d, "restconf"); err != nil {
+		return nil, err
+	}
+	InitHTTPParams(&d.HTTPParams)
+	client, err := httpClient(d.HTTPParams)
+	if err != nil {
+		return nil, err
+	}
+	return &RESTCONFClient{d: &d, client: client}, nil
+}
+
+// Do sends a request and returns the response's body, which is
+// empty when the device has no content to return. A response
+// with RESTCONF errors is returned as a *RESTCONFError.
+func (c *RESTCONFClient) Do(ctx context.Context, r RESTCONFRequest) ([]byte, error) {
+	path := r.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if path != restconfRoot && !strings.HasPrefix(path, restconfRoot+"/") {
+		path = restconfRoot + path
+	}
+
+	var body io.Reader
+	if r.Payload != "" {
+		body = strings.NewReader(r.Payload)
+	}
+	req, err := http.NewRequest(r.Method, c.d.apiURL(path), body)
+	if err != nil {
+		return nil, fmt.Errorf("restconf: %w", err)
+	}
+	mediaType := restconfJSON
+	if r.format() == "xml" {
+		mediaType = restconfXML
+	}
+	req.Header.Set("Accept", mediaType)
+	if r.Payload != "" {
+		req.Header.Set("Content-Type", restconfJSON)
+		if strings.HasPrefix(r.Payload, "<") {
+			req.Header.Set("Content-Type", restconfXML)
+		}
+	}
+
+	b, err := doHTTP(ctx, c.client, c.d.Credentials, req)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		// EG: an authentication error has no RESTCONF errors
+		if errs := restconfErrors(b); len(errs) > 0 {
+			return b, &RESTCONFError{HTTPError: httpErr, Errors: errs}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restconf: %w", err)
+	}
+	return b, nil
+}
+
+// command sends the request of a command, a *RESTCONFError
+// marks it as failed.
+func (c *RESTCONFClient) command(ctx context.Context, cmd string) (data.CommandOutput, error) {
+	out := data.CommandOutput{Command: cmd}
+	r, err := ParseRESTCONFRequest(cmd)
+	if err != nil {
+		return out, err
+	}
+
+	b, err := c.Do(ctx, r)
+	var restconfErr *RESTCONFError
+	if errors.As(err, &restconfErr) {
+		out.Output = string(b)
+		out.Failed = true
+		out.Error = restconfErr.Error()
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+	out.Output = string(b)
+	if r.format() == "json" && json.Valid(b) {
+		out.JSON = b
+	}
+	return out, nil
+}
+
+// reads reports whether a request only reads from the device,
+// a GET. Other methods change its configuration.
+func (c *RESTCONFClient) reads(cmd string) bool {
+	r, err := ParseRESTCONFRequest(cmd)
+	return err == nil && r.Method == http.MethodGet
+}
+
+// config sends the requests of configuration lines, the
+// lines after a line that fails are not sent.
+func (c *RESTCONFClient) config(ctx context.Context, lines []string) ([]data.CommandOutput, error) {
+	cmdOut := []data.CommandOutput{}
+	for _, line := range lines {
+		out, err := c.command(ctx, line)
+		if err != nil {
+			return cmdOut, err
+		}
+		out.CommandU = util.Underscorer(line)
+		cmdOut = append(cmdOut, out)
+		if out.Failed {
+			break
+		}
+	}
+	return cmdOut, configError(cmdOut)
+}
+
+// RunWithRESTCONF is the entrypoint to run a job with RESTCONF.
+func RunWithRESTCONF(ctx context.Context, nd NetDevice, job Job) data.Result {
+	c, err := NewRESTCONFClient(nd)
+	if err != nil {
+		return data.Result{
+			Device:    nd.Name,
+			Error:     err,
+			Timestamp: time.Now().Unix(),
+		}
+	}
+	return runAPIJob(ctx, c.d, job, c)
+}
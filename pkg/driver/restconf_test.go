@@ -0,0 +1,292 @@
+package driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// fakeRESTCONF answers requests like the RESTCONF API of a Cisco
+// IOS-XE device, the hostname can be read and changed. It records
+// the requests it receives.
+type fakeRESTCONF struct {
+	mu       sync.Mutex
+	hostname string
+	reqs     []string
+}
+
+func (f *fakeRESTCONF) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.reqs...)
+}
+
+func (f *fakeRESTCONF) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reqs = append(f.reqs, r.Method+" "+r.URL.Path+" "+r.Header.Get("Content-Type"))
+
+	xmlRequested := r.Header.Get("Accept") == "application/yang-data+xml"
+	errorResponse := func(status int, tag, msg string) {
+		if xmlRequested {
+			w.Header().Set("Content-Type", "application/yang-data+xml")
+			w.WriteHeader(status)
+			io.WriteString(w, `<errors xmlns="urn:ietf:params:xml:ns:yang:ietf-restconf"><error>`+
+				`<error-type>application</error-type><error-tag>`+tag+`</error-tag>`+
+				`<error-message>`+msg+`</error-message></error></errors>`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yang-data+json")
+		w.WriteHeader(status)
+		io.WriteString(w, `{"ietf-restconf:errors": {"error": [{"error-type": "application", "error-tag": "`+tag+`",`+
+			` "error-path": "/Cisco-IOS-XE-native:native", "error-message": "`+msg+`"}]}}`)
+	}
+
+	switch {
+	case r.URL.Path != "/restconf/data/Cisco-IOS-XE-native:native/hostname":
+		errorResponse(http.StatusNotFound, "invalid-value", "uri keypath not found")
+	case r.Method == http.MethodGet && f.hostname == "":
+		errorResponse(http.StatusNotFound, "invalid-value", "uri keypath not found")
+	case r.Method == http.MethodGet && xmlRequested:
+		w.Header().Set("Content-Type", "application/yang-data+xml")
+		io.WriteString(w, `<hostname xmlns="http://cisco.com/ns/yang/Cisco-IOS-XE-native">`+f.hostname+`</hostname>`)
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/yang-data+json")
+		io.WriteString(w, `{"Cisco-IOS-XE-native:hostname": "`+f.hostname+`"}`)
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		var payload map[string]string
+		if json.Unmarshal(body, &payload) != nil || payload["Cisco-IOS-XE-native:hostname"] == "" {
+			errorResponse(http.StatusBadRequest, "malformed-message", "invalid hostname")
+			return
+		}
+		f.hostname = payload["Cisco-IOS-XE-native:hostname"]
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		f.hostname = ""
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRunWithRESTCONF(t *testing.T) {
+	t.Parallel()
+	const hostname = "/data/Cisco-IOS-XE-native:native/hostname"
+	type testCase struct {
+		name     string
+		job      driver.Job
+		wantOK   bool
+		wantErr  string
+		wantReqs []string
+		check    func(t *testing.T, result data.Result)
+	}
+	testCases := []testCase{
+		{
+			name:   "get",
+			job:    driver.Job{Commands: []string{"GET " + hostname, "get /restconf" + hostname + " xml"}},
+			wantOK: true,
+			wantReqs: []string{
+				"GET /restconf/data/Cisco-IOS-XE-native:native/hostname ",
+				"GET /restconf/data/Cisco-IOS-XE-native:native/hostname ",
+			},
+			check: func(t *testing.T, result data.Result) {
+				j := result.CommandOutputs[0]
+				if string(j.JSON) != `{"Cisco-IOS-XE-native:hostname": "csr-1"}` || j.Output != string(j.JSON) {
+					t.Errorf("want the JSON payload, got %+v", j)
+				}
+				x := result.CommandOutputs[1]
+				if !strings.Contains(x.Output, ">csr-1</hostname>") || x.JSON != nil {
+					t.Errorf("want the XML payload, got %+v", x)
+				}
+			},
+		},
+		{
+			name: "config",
+			job: driver.Job{
+				Config:   []string{"PATCH " + hostname + ` {"Cisco-IOS-XE-native:hostname": "csr-2"}`},
+				Commands: []string{"GET " + hostname},
+			},
+			wantOK: true,
+			wantReqs: []string{
+				"PATCH /restconf/data/Cisco-IOS-XE-native:native/hostname application/yang-data+json",
+				"GET /restconf/data/Cisco-IOS-XE-native:native/hostname ",
+			},
+			check: func(t *testing.T, result data.Result) {
+				if !strings.Contains(result.CommandOutputs[1].Output, "csr-2") {
+					t.Errorf("want the new hostname, got %+v", result.CommandOutputs[1])
+				}
+			},
+		},
+		{
+			name: "delete",
+			job:  driver.Job{Commands: []string{"DELETE " + hostname, "GET " + hostname}},
+			wantReqs: []string{
+				"DELETE /restconf/data/Cisco-IOS-XE-native:native/hostname ",
+				"GET /restconf/data/Cisco-IOS-XE-native:native/hostname ",
+			},
+			wantErr: "command errors: 'GET " + hostname + "': restconf: 404 Not Found: /Cisco-IOS-XE-native:native: uri keypath not found",
+			check: func(t *testing.T, result data.Result) {
+				c := result.CommandOutputs[1]
+				if !c.Failed || !strings.Contains(c.Output, "ietf-restconf:errors") {
+					t.Errorf("want the request marked failed with the error body, got %+v", c)
+				}
+			},
+		},
+		{
+			name: "config error",
+			job: driver.Job{
+				Config: []string{
+					"PUT " + hostname + ` <hostname xmlns="http://cisco.com/ns/yang/Cisco-IOS-XE-native">bad</hostname>`,
+					"PATCH " + hostname + ` {"Cisco-IOS-XE-native:hostname": "csr-2"}`,
+				},
+			},
+			wantReqs: []string{"PUT /restconf/data/Cisco-IOS-XE-native:native/hostname application/yang-data+xml"},
+			wantErr:  "configuration errors: 'PUT " + hostname,
+			check: func(t *testing.T, result data.Result) {
+				var configErr *driver.ConfigError
+				if !errors.As(result.Error, &configErr) || configErr.Lines[0].Message != "restconf: 400 Bad Request: invalid hostname" {
+					t.Errorf("want a *driver.ConfigError, got %v", result.Error)
+				}
+			},
+		},
+		{
+			name:    "invalid request",
+			job:     driver.Job{Commands: []string{"show version"}},
+			wantErr: "restconf: unknown method: show",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeRESTCONF{hostname: "csr-1"}
+			srv := newFakeAPIServer(t, api.ServeHTTP)
+			creds := data.Credentials{Username: "admin", Password: "secret"}
+			d := newAPIDevice(t, srv, "cisco", "ios", "restconf", driver.HTTPParams{CAFile: apiCAFile(t, srv)}, creds)
+
+			result := driver.Run(context.Background(), d, tc.job)
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			if tc.wantErr != "" && (result.Error == nil || !strings.HasPrefix(result.Error.Error(), tc.wantErr)) {
+				t.Errorf("want error %q, got %v", tc.wantErr, result.Error)
+			}
+			got := strings.Join(api.received(), "|")
+			want := strings.Join(tc.wantReqs, "|")
+			if got != want {
+				t.Errorf("want requests %s, got %s", want, got)
+			}
+			if tc.check != nil {
+				tc.check(t, result)
+			}
+		})
+	}
+}
+
+func TestRESTCONFClientErrors(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name       string
+		pass       string
+		req        driver.RESTCONFRequest
+		wantStatus int
+		wantErrors int
+		wantErr    string
+	}
+	testCases := []testCase{
+		{
+			name:       "json errors",
+			pass:       "secret",
+			req:        driver.RESTCONFRequest{Method: http.MethodGet, Path: "/data/missing"},
+			wantStatus: http.StatusNotFound,
+			wantErrors: 1,
+			wantErr:    "restconf: 404 Not Found: /Cisco-IOS-XE-native:native: uri keypath not found",
+		},
+		{
+			name:       "xml errors",
+			pass:       "secret",
+			req:        driver.RESTCONFRequest{Method: http.MethodGet, Path: "/data/missing", Format: "xml"},
+			wantStatus: http.StatusNotFound,
+			wantErrors: 1,
+			wantErr:    "restconf: 404 Not Found: uri keypath not found",
+		},
+		{
+			name:       "unauthorized",
+			pass:       "wrong",
+			req:        driver.RESTCONFRequest{Method: http.MethodGet, Path: "/data/missing"},
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    "restconf: http: 401 Unauthorized: Unauthorized",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newFakeAPIServer(t, (&fakeRESTCONF{}).ServeHTTP)
+			creds := data.Credentials{Username: "admin", Password: tc.pass}
+			d := newAPIDevice(t, srv, "cisco", "nxos", "restconf", driver.HTTPParams{InsecureSkipVerify: true}, creds)
+			c, err := driver.NewRESTCONFClient(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = c.Do(context.Background(), tc.req)
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("want error %q, got %v", tc.wantErr, err)
+			}
+			var httpErr *driver.HTTPError
+			if !errors.As(err, &httpErr) || httpErr.StatusCode != tc.wantStatus {
+				t.Errorf("want status %d, got %v", tc.wantStatus, err)
+			}
+			var restconfErr *driver.RESTCONFError
+			if errors.As(err, &restconfErr) != (tc.wantErrors > 0) || (restconfErr != nil && len(restconfErr.Errors) != tc.wantErrors) {
+				t.Errorf("want %d RESTCONF errors, got %v", tc.wantErrors, err)
+			}
+		})
+	}
+}
+
+func TestParseRESTCONFRequest(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name    string
+		s       string
+		want    driver.RESTCONFRequest
+		wantErr bool
+	}
+	testCases := []testCase{
+		{name: "get", s: "GET /data/ietf-interfaces:interfaces", want: driver.RESTCONFRequest{Method: "GET", Path: "/data/ietf-interfaces:interfaces"}},
+		{name: "get xml", s: "get  /data/ietf-interfaces:interfaces  xml", want: driver.RESTCONFRequest{Method: "GET", Path: "/data/ietf-interfaces:interfaces", Format: "xml"}},
+		{name: "patch", s: `PATCH /data/x {"a": "b c"}`, want: driver.RESTCONFRequest{Method: "PATCH", Path: "/data/x", Payload: `{"a": "b c"}`}},
+		{name: "post", s: "POST /operations/cisco-ia:save-config", want: driver.RESTCONFRequest{Method: "POST", Path: "/operations/cisco-ia:save-config"}},
+		{name: "no path", s: "GET", wantErr: true},
+		{name: "no payload", s: "PUT /data/x", wantErr: true},
+		{name: "get payload", s: "GET /data/x {}", wantErr: true},
+		{name: "unknown method", s: "HEAD /data/x", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := driver.ParseRESTCONFRequest(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("want error %t, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/automatico/jato/pkg/data"
+)
+
+// FailureClass is the cause of a failed job or command,
+// results record it so failures can be grouped by cause.
+type FailureClass string
+
+const (
+	// FailureDial is a device that could not be reached or
+	// dropped the connection. EG: connection refused or reset
+	FailureDial FailureClass = "dial"
+	// FailureAuth is a device that rejected the credentials.
+	FailureAuth FailureClass = "auth"
+	// FailureHostKey is a device whose SSH host key
+	// does not match the known one.
+	FailureHostKey FailureClass = "hostkey"
+	// FailureTimeout is a device that did not answer
+	// with a prompt before the timeout.
+	FailureTimeout FailureClass = "timeout"
+	// FailureCommand is a command or configuration
+	// line the device reported an error for.
+	FailureCommand FailureClass = "command"
+)
+
+// ParseFailureClass returns the FailureClass named s.
+func ParseFailureClass(s string) (FailureClass, error) {
+	switch c := FailureClass(s); c {
+	case FailureDial, FailureAuth, FailureHostKey, FailureTimeout, FailureCommand:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown failure class: %s", s)
+}
+
+// Classify returns the class of a failure, "" when
+// err is nil or its cause is not known.
+func Classify(err error) FailureClass {
+	if err == nil {
+		return ""
+	}
+
+	var cmdErr *CommandError
+	var configErr *ConfigError
+	var rpcErr *RPCError
+	var timeoutErr *TimeoutError
+	var httpErr *HTTPError
+	var proxyErr *ProxyError
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+
+	// SSH handshake errors are only available as text
+	msg := err.Error()
+
+	switch {
+	case errors.As(err, &cmdErr), errors.As(err, &configErr), errors.As(err, &rpcErr):
+		return FailureCommand
+	case strings.Contains(msg, "key mismatch"), strings.Contains(msg, "knownhosts: key is unknown"):
+		return FailureHostKey
+	case errors.Is(err, ErrLoginFailed), errors.Is(err, ErrEnableFailed),
+		strings.Contains(msg, "unable to authenticate"):
+		return FailureAuth
+	case errors.As(err, &proxyErr):
+		if proxyErr.Auth {
+			return FailureAuth
+		}
+		return FailureDial
+	case errors.As(err, &httpErr):
+		if httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden {
+			return FailureAuth
+		}
+		return ""
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.As(err, &opErr), errors.As(err, &dnsErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		strings.Contains(msg, "handshake failed"), strings.Contains(msg, "connection reset"):
+		return FailureDial
+	}
+	return ""
+}
+
+// DefaultRetryOn are the failure classes retried by
+// a RetryPolicy without classes of its own.
+var DefaultRetryOn = []FailureClass{FailureDial, FailureTimeout}
+
+// DefaultRetryBackoff is the delay before the first
+// retry of a RetryPolicy without a backoff.
+const DefaultRetryBackoff = time.Second
+
+// RetryPolicy decides how often and when a failed attempt is
+// made again. The delay starts at Backoff and doubles after each
+// attempt, up to MaxBackoff. The zero value makes one attempt.
+type RetryPolicy struct {
+	// Attempts is the number of attempts, including the first.
+	Attempts int
+	// Backoff is the delay before the first retry,
+	// DefaultRetryBackoff when 0.
+	Backoff time.Duration
+	// MaxBackoff caps the delay, it is not capped when 0.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay that is randomly
+	// added or taken away, EG: 0.2 for ±20%.
+	Jitter float64
+	// On are the failure classes that are retried,
+	// DefaultRetryOn when empty.
+	On []FailureClass
+}
+
+// retries reports whether a failure of class c is retried.
+func (p RetryPolicy) retries(c FailureClass) bool {
+	on := p.On
+	if len(on) == 0 {
+		on = DefaultRetryOn
+	}
+	for _, r := range on {
+		if r == c {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the attempt after attempt.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	if d == 0 {
+		d = DefaultRetryBackoff
+	}
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// again reports whether the attempt after attempt, which failed
+// with err, is made. It waits for the delay, the attempt is not
+// made when the context is done first.
+func (p RetryPolicy) again(ctx context.Context, attempt int, err error) bool {
+	if attempt >= p.Attempts || !p.retries(Classify(err)) || ctx.Err() != nil {
+		return false
+	}
+	t := time.NewTimer(p.delay(attempt))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retry calls f until it succeeds or the policy does
+// not retry its failure, the last error is returned.
+func retry(ctx context.Context, p RetryPolicy, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !p.again(ctx, attempt, err) {
+			return err
+		}
+	}
+}
+
+// commandErrorRetry returns the part of a policy that applies to
+// commands that may have run when they failed. Only command errors
+// are retried. EG: a command typed into an interactive shell that
+// timed out may still answer and the session is lost
+func commandErrorRetry(p RetryPolicy) RetryPolicy {
+	if !p.retries(FailureCommand) {
+		p.Attempts = 0
+	}
+	p.On = []FailureClass{FailureCommand}
+	return p
+}
+
+// retryCommand runs a command with run until its output is not
+// marked as failed or the policy does not retry its failure.
+func retryCommand(ctx context.Context, p RetryPolicy, run func() (data.CommandOutput, error)) (data.CommandOutput, error) {
+	for attempt := 1; ; attempt++ {
+		c, err := run()
+		failure := err
+		if err == nil && c.Failed {
+			failure = &CommandError{Failed: []data.CommandOutput{c}}
+		}
+		if failure == nil || !p.again(ctx, attempt, failure) {
+			return c, err
+		}
+	}
+}
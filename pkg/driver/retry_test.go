@@ -0,0 +1,233 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name string
+		err  error
+		want driver.FailureClass
+	}
+	testCases := []testCase{
+		{name: "nil", err: nil, want: ""},
+		{name: "refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: driver.FailureDial},
+		{name: "reset", err: errors.New("ssh: handshake failed: EOF"), want: driver.FailureDial},
+		{name: "eof", err: fmt.Errorf("telnet: %w", io.EOF), want: driver.FailureDial},
+		{name: "ssh auth", err: errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password], no supported methods remain"), want: driver.FailureAuth},
+		{name: "telnet login", err: fmt.Errorf("%w: the credentials were rejected", driver.ErrLoginFailed), want: driver.FailureAuth},
+		{name: "http unauthorized", err: &driver.HTTPError{StatusCode: 401, Status: "401 Unauthorized"}, want: driver.FailureAuth},
+		{name: "http server error", err: &driver.HTTPError{StatusCode: 500, Status: "500 Internal Server Error"}, want: ""},
+		{name: "host key", err: errors.New("ssh: handshake failed: knownhosts: key mismatch"), want: driver.FailureHostKey},
+		{name: "unknown host key", err: errors.New("ssh: handshake failed: knownhosts: key is unknown"), want: driver.FailureHostKey},
+		{name: "prompt timeout", err: &driver.TimeoutError{}, want: driver.FailureTimeout},
+		{name: "deadline", err: context.DeadlineExceeded, want: driver.FailureTimeout},
+		{name: "command", err: &driver.CommandError{Failed: []data.CommandOutput{{Command: "show bogus"}}}, want: driver.FailureCommand},
+		{name: "config", err: &driver.ConfigError{}, want: driver.FailureCommand},
+		{name: "unknown", err: errors.New("boom"), want: ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := driver.Classify(tc.err); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunRetriesConnect(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name         string
+		reset        int32
+		password     string
+		strict       bool
+		retry        driver.RetryPolicy
+		wantOK       bool
+		wantFailure  string
+		wantAccepted int
+	}
+	testCases := []testCase{
+		{
+			name:         "reset then connected",
+			reset:        2,
+			password:     "cisco",
+			retry:        driver.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Jitter: 0.5},
+			wantOK:       true,
+			wantAccepted: 3,
+		},
+		{
+			name:         "attempts used up",
+			reset:        2,
+			password:     "cisco",
+			retry:        driver.RetryPolicy{Attempts: 2, Backoff: time.Millisecond},
+			wantFailure:  "dial",
+			wantAccepted: 2,
+		},
+		{
+			name:         "no retries",
+			reset:        1,
+			password:     "cisco",
+			wantFailure:  "dial",
+			wantAccepted: 1,
+		},
+		{
+			name:         "auth not retried",
+			password:     "wrong",
+			retry:        driver.RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+			wantFailure:  "auth",
+			wantAccepted: 1,
+		},
+		{
+			name:         "auth retried",
+			password:     "wrong",
+			retry:        driver.RetryPolicy{Attempts: 2, Backoff: time.Millisecond, On: []driver.FailureClass{driver.FailureAuth}},
+			wantFailure:  "auth",
+			wantAccepted: 2,
+		},
+		{
+			name:         "unknown host key not retried",
+			password:     "cisco",
+			strict:       true,
+			retry:        driver.RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+			wantFailure:  "hostkey",
+			wantAccepted: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fs := listenFakeSSHServer(t, passwordConfig("admin", "cisco"), "\r\nrouter#", iosShell)
+			fs.reset = tc.reset
+			go fs.serve()
+
+			params := driver.SSHParams{Port: fs.port(), InsecureConnection: true, AuthMethods: []string{"password"}}
+			if tc.strict {
+				params.InsecureConnection, params.HostKeyPolicy = false, "strict"
+				params.KnownHostsFile = filepath.Join(t.TempDir(), "known_hosts")
+				if err := ioutil.WriteFile(params.KnownHostsFile, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "ssh",
+				SSHParams:   params,
+				Credentials: data.Credentials{Username: "admin", Password: tc.password},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}, Retry: tc.retry})
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			if result.Failure != tc.wantFailure {
+				t.Errorf("want failure %q, got %q: %v", tc.wantFailure, result.Failure, result.Error)
+			}
+			if fs.accepted() != tc.wantAccepted {
+				t.Errorf("want %d connections, got %d", tc.wantAccepted, fs.accepted())
+			}
+		})
+	}
+}
+
+func TestRunRetriesCommand(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name        string
+		platform    string
+		retry       driver.RetryPolicy
+		wantOK      bool
+		wantFailure string
+	}
+	testCases := []testCase{
+		{
+			name:     "shell",
+			platform: "ios",
+			retry:    driver.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, On: []driver.FailureClass{driver.FailureCommand}},
+			wantOK:   true,
+		},
+		{
+			name:     "exec",
+			platform: "eos",
+			retry:    driver.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, On: []driver.FailureClass{driver.FailureCommand}},
+			wantOK:   true,
+		},
+		{
+			name:        "command errors not retried",
+			platform:    "ios",
+			retry:       driver.RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+			wantFailure: "command",
+		},
+		{
+			name:        "attempts used up",
+			platform:    "eos",
+			retry:       driver.RetryPolicy{Attempts: 2, Backoff: time.Millisecond, On: []driver.FailureClass{driver.FailureCommand}},
+			wantFailure: "command",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			// The device is busy for the first two attempts
+			busy := int32(2)
+			answer := func() string {
+				if atomic.AddInt32(&busy, -1) >= 0 {
+					return "% Invalid input detected: device busy"
+				}
+				return "done"
+			}
+			prompt := map[string]string{"ios": "\r\nrouter#", "eos": "\r\nveos-1#"}[tc.platform]
+			fs := listenFakeSSHServer(t, passwordConfig("admin", "cisco"), prompt, func(line string) string {
+				if line == "clear counters" {
+					return "\r\n" + answer() + prompt
+				}
+				return prompt
+			})
+			fs.exec = func(cmd string) (string, uint32) {
+				return answer() + "\n", 0
+			}
+			go fs.serve()
+
+			vendor := map[string]string{"ios": "cisco", "eos": "arista"}[tc.platform]
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "router", IP: "127.0.0.1", Vendor: vendor, Platform: tc.platform, Connector: "ssh",
+				SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true, Exec: tc.platform == "eos"},
+				Credentials: data.Credentials{Username: "admin", Password: "cisco"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"clear counters"}, CommandRetry: tc.retry})
+			if result.OK != tc.wantOK {
+				t.Errorf("want OK %t, got %v", tc.wantOK, result.Error)
+			}
+			if result.Failure != tc.wantFailure {
+				t.Errorf("want failure %q, got %q: %v", tc.wantFailure, result.Failure, result.Error)
+			}
+		})
+	}
+}
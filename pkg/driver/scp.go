@@ -0,0 +1,186 @@
+package driver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// shellQuote quotes a path for the remote shell scp is run by,
+// with single quotes unless it only holds characters that are
+// safe unquoted. Paths of network devices, EG: flash:image.bin,
+// are left as they are since their scp is not run by a shell.
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-.,/:@%+=", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// scpPut copies size bytes of r to a remote file by running
+// scp in sink mode, scp -t, on a new session of client.
+func scpPut(client *ssh.Client, remote string, r io.Reader, size int64) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	ack := bufio.NewReader(out)
+	if err := session.Start("scp -t " + shellQuote(remote)); err != nil {
+		return fmt.Errorf("scp: %v", err)
+	}
+
+	if err := scpAck(ack); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "C0644 %d %s\n", size, path.Base(remote)); err != nil {
+		return err
+	}
+	if err := scpAck(ack); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, r, size); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	if err := scpAck(ack); err != nil {
+		return err
+	}
+	w.Close()
+	return scpWait(session)
+}
+
+// scpGet copies a remote file to w by running scp in
+// source mode, scp -f, on a new session of client. The
+// file's size is passed to started before it is copied.
+func scpGet(client *ssh.Client, remote string, w io.Writer, started func(size int64)) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	in, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(out)
+	if err := session.Start("scp -f " + shellQuote(remote)); err != nil {
+		return fmt.Errorf("scp: %v", err)
+	}
+
+	if _, err := in.Write([]byte{0}); err != nil {
+		return err
+	}
+	size, err := scpFile(r)
+	if err != nil {
+		return err
+	}
+	started(size)
+	if _, err := in.Write([]byte{0}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, r, size); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := in.Write([]byte{0}); err != nil {
+		return err
+	}
+	in.Close()
+	return scpWait(session)
+}
+
+// scpFile reads the C record that starts the copy
+// of a file, EG: C0644 1024 name, returning its size.
+func scpFile(r *bufio.Reader) (int64, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, scpError(err)
+	}
+	switch line[0] {
+	case 1, 2:
+		return 0, scpMessage(line[1:])
+	case 'C':
+	default:
+		return 0, fmt.Errorf("scp: unexpected record: %q", strings.TrimSpace(line))
+	}
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) != 3 {
+		return 0, fmt.Errorf("scp: invalid record: %q", strings.TrimSpace(line))
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("scp: invalid size: %q", fields[1])
+	}
+	return size, nil
+}
+
+// scpAck reads the acknowledgement of a record, a
+// warning or error is followed by a message line.
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return scpError(err)
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	return scpMessage(msg)
+}
+
+// scpMessage returns the error of a warning or error
+// message, which servers may start with scp:.
+func scpMessage(msg string) error {
+	msg = strings.TrimPrefix(strings.TrimSpace(msg), "scp: ")
+	return fmt.Errorf("scp: %s", msg)
+}
+
+// scpError reports an output that ends before
+// scp answers, scp did not start on the device.
+func scpError(err error) error {
+	if err == io.EOF {
+		return errors.New("scp: the device closed the session, is its SCP server enabled?")
+	}
+	return err
+}
+
+// scpWait waits for scp to exit.
+func scpWait(session *ssh.Session) error {
+	err := session.Wait()
+	var exitErr *ssh.ExitMissingError
+	if errors.As(err, &exitErr) {
+		// Some devices close the session without an exit status
+		return nil
+	}
+	return err
+}
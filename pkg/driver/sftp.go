@@ -0,0 +1,337 @@
+package driver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP version 3 packet types, draft-ietf-secsh-filexfer-02.
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpWrite   = 6
+	sftpStat    = 17
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+)
+
+// SFTP open flags.
+const (
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+)
+
+// SFTP status codes.
+const (
+	sftpStatusOK         = 0
+	sftpStatusEOF        = 1
+	sftpStatusNoSuchFile = 2
+)
+
+// sftpAttrSize is set in the flags of
+// attributes that hold a file's size.
+const sftpAttrSize = 0x01
+
+// sftpChunk is the most data read or written by a
+// request, the size servers are required to accept.
+const sftpChunk = 32768
+
+// sftpStatusError is a request refused by an SFTP server.
+type sftpStatusError struct {
+	Code uint32
+	Msg  string
+}
+
+func (e *sftpStatusError) Error() string {
+	return fmt.Sprintf("sftp: %s (%d)", e.Msg, e.Code)
+}
+
+// Is allows errors.Is(err, os.ErrNotExist)
+// to identify a missing file.
+func (e *sftpStatusError) Is(target error) bool {
+	return target == os.ErrNotExist && e.Code == sftpStatusNoSuchFile
+}
+
+// sftpClient is a client of the sftp subsystem of an SSH
+// server. Requests are made one at a time.
+type sftpClient struct {
+	session *ssh.Session
+	w       io.WriteCloser
+	r       *bufio.Reader
+	id      uint32
+}
+
+// newSFTPClient starts the sftp subsystem on a new session
+// of an SSH client and negotiates version 3 of the protocol.
+func newSFTPClient(client *ssh.Client) (*sftpClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("sftp: %v", err)
+	}
+
+	c := &sftpClient{session: session, w: w, r: bufio.NewReader(r)}
+	if err := c.send(sftpInit, uint32(3)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	typ, _, err := c.recv()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if typ != sftpVersion {
+		c.Close()
+		return nil, fmt.Errorf("sftp: unexpected packet type %d", typ)
+	}
+	return c, nil
+}
+
+// Close ends the sftp session.
+func (c *sftpClient) Close() error {
+	c.w.Close()
+	return c.session.Close()
+}
+
+// send writes a packet made of fields, which are
+// byte, uint32, uint64, string or []byte values.
+func (c *sftpClient) send(typ byte, fields ...interface{}) error {
+	b := []byte{0, 0, 0, 0, typ}
+	for _, f := range fields {
+		switch v := f.(type) {
+		case byte:
+			b = append(b, v)
+		case uint32:
+			b = appendUint32(b, v)
+		case uint64:
+			b = appendUint32(b, uint32(v>>32))
+			b = appendUint32(b, uint32(v))
+		case string:
+			b = appendUint32(b, uint32(len(v)))
+			b = append(b, v...)
+		case []byte:
+			b = appendUint32(b, uint32(len(v)))
+			b = append(b, v...)
+		default:
+			panic(fmt.Sprintf("sftp: unsupported field type %T", f))
+		}
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := c.w.Write(b)
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// recv reads a packet, returning its type and payload.
+func (c *sftpClient) recv() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[:4])
+	if length < 1 || length > 256*1024 {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], payload, nil
+}
+
+// request sends a request and reads its response,
+// checking that the response is to the request.
+func (c *sftpClient) request(typ byte, fields ...interface{}) (byte, []byte, error) {
+	c.id++
+	if err := c.send(typ, append([]interface{}{c.id}, fields...)...); err != nil {
+		return 0, nil, err
+	}
+	rtyp, payload, err := c.recv()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) < 4 || binary.BigEndian.Uint32(payload) != c.id {
+		return 0, nil, errors.New("sftp: response to an unknown request")
+	}
+	payload = payload[4:]
+	if rtyp == sftpStatus {
+		return rtyp, payload, statusError(payload)
+	}
+	return rtyp, payload, nil
+}
+
+// statusError returns the error of a status payload, nil
+// for OK and io.EOF for the end of a file.
+func statusError(payload []byte) error {
+	if len(payload) < 4 {
+		return errors.New("sftp: short status")
+	}
+	code := binary.BigEndian.Uint32(payload)
+	msg, _ := sftpString(payload[4:])
+	switch code {
+	case sftpStatusOK:
+		return nil
+	case sftpStatusEOF:
+		return io.EOF
+	}
+	return &sftpStatusError{Code: code, Msg: msg}
+}
+
+// sftpString reads a string from the start of b.
+func sftpString(b []byte) (string, []byte) {
+	if len(b) < 4 {
+		return "", nil
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return "", nil
+	}
+	return string(b[4 : 4+n]), b[4+n:]
+}
+
+// sftpExpect checks the type of a response.
+func sftpExpect(typ, want byte) error {
+	if typ != want {
+		return fmt.Errorf("sftp: unexpected packet type %d", typ)
+	}
+	return nil
+}
+
+// open opens a remote file, returning its handle.
+func (c *sftpClient) open(path string, flags uint32) (string, error) {
+	typ, payload, err := c.request(sftpOpen, path, flags, uint32(0))
+	if err != nil {
+		return "", err
+	}
+	if err := sftpExpect(typ, sftpHandle); err != nil {
+		return "", err
+	}
+	handle, _ := sftpString(payload)
+	return handle, nil
+}
+
+func (c *sftpClient) close(handle string) error {
+	_, _, err := c.request(sftpClose, handle)
+	return err
+}
+
+// read reads up to n bytes of a file from off.
+// io.EOF is returned at the end of the file.
+func (c *sftpClient) read(handle string, off uint64, n uint32) ([]byte, error) {
+	typ, payload, err := c.request(sftpRead, handle, off, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := sftpExpect(typ, sftpData); err != nil {
+		return nil, err
+	}
+	data, _ := sftpString(payload)
+	return []byte(data), nil
+}
+
+func (c *sftpClient) write(handle string, off uint64, b []byte) error {
+	typ, _, err := c.request(sftpWrite, handle, off, b)
+	if err != nil {
+		return err
+	}
+	return sftpExpect(typ, sftpStatus)
+}
+
+// size returns the size of a remote file.
+func (c *sftpClient) size(path string) (int64, error) {
+	typ, payload, err := c.request(sftpStat, path)
+	if err != nil {
+		return 0, err
+	}
+	if err := sftpExpect(typ, sftpAttrs); err != nil {
+		return 0, err
+	}
+	if len(payload) < 12 || binary.BigEndian.Uint32(payload)&sftpAttrSize == 0 {
+		return 0, errors.New("sftp: the server did not return the file size")
+	}
+	return int64(binary.BigEndian.Uint64(payload[4:])), nil
+}
+
+// put writes r to a remote file from off, truncating
+// the file unless it is resumed at off.
+func (c *sftpClient) put(path string, r io.Reader, off int64) error {
+	flags := uint32(sftpFlagWrite | sftpFlagCreate)
+	if off == 0 {
+		flags |= sftpFlagTrunc
+	}
+	handle, err := c.open(path, flags)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, sftpChunk)
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := c.write(handle, uint64(off), buf[:n]); err != nil {
+				c.close(handle)
+				return err
+			}
+			off += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			c.close(handle)
+			return rerr
+		}
+	}
+	return c.close(handle)
+}
+
+// get writes a remote file from off to w.
+func (c *sftpClient) get(path string, w io.Writer, off int64) error {
+	handle, err := c.open(path, sftpFlagRead)
+	if err != nil {
+		return err
+	}
+	for {
+		b, err := c.read(handle, uint64(off), sftpChunk)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			_, err = w.Write(b)
+		}
+		if err != nil {
+			c.close(handle)
+			return err
+		}
+		off += int64(len(b))
+	}
+	return c.close(handle)
+}
@@ -0,0 +1,278 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultSSHKeepAlive is the interval an SSHManager
+// sends keepalives at when its KeepAlive is 0.
+const DefaultSSHKeepAlive = 30 * time.Second
+
+// errManagerClosed is returned by an SSHManager after Close.
+var errManagerClosed = errors.New("ssh manager: closed")
+
+// SSHManager keeps one authenticated SSH client per device.
+// Sessions and exec channels are opened on the client on demand,
+// so jobs run one after another reuse the connection instead of
+// logging in again. A client that is closed by the device or
+// stops answering keepalives is dialled again when it is next
+// needed. The zero value is ready to use.
+//
+// Devices use a manager for their SSH connections when it is
+// set as their SSHManager.
+type SSHManager struct {
+	// KeepAlive is the interval keepalives are sent at,
+	// DefaultSSHKeepAlive when 0. Keepalives are not sent
+	// when it is negative.
+	KeepAlive time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*managedClient
+	closed  bool
+}
+
+// managedClient is a client of an SSHManager. ready is
+// closed once client or err is set, done once the client
+// is closed.
+type managedClient struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+	done   chan struct{}
+}
+
+// sshManagerKey identifies the connection of a device, devices with
+// the same address, credentials, host key checks, proxy and jump
+// hosts share a client.
+func sshManagerKey(d *NetDevice) string {
+	hops := []string{}
+	for _, hop := range d.SSHParams.JumpHosts {
+		hops = append(hops, fmt.Sprintf("%s@%s:%d[%s %s %t]",
+			hop.Credentials, hop.Host, hop.Port, hop.HostKeyPolicy, hop.KnownHostsFile, hop.InsecureConnection))
+	}
+	return fmt.Sprintf("%s@%s:%d via %s %s", connKey(d.Credentials, d.SSHParams), d.IP, d.SSHParams.Port, d.SSHParams.Proxy, strings.Join(hops, ","))
+}
+
+// Client returns the device's client, it is dialled
+// and authenticated if there is none or it was closed.
+func (m *SSHManager) Client(ctx context.Context, d *NetDevice) (*ssh.Client, error) {
+	key := sshManagerKey(d)
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, errManagerClosed
+		}
+		if m.clients == nil {
+			m.clients = make(map[string]*managedClient)
+		}
+		mc, ok := m.clients[key]
+		if !ok {
+			mc = &managedClient{ready: make(chan struct{}), done: make(chan struct{})}
+			m.clients[key] = mc
+		}
+		m.mu.Unlock()
+
+		if !ok {
+			mc.client, mc.err = m.dial(ctx, d)
+			close(mc.ready)
+			if mc.err != nil {
+				m.forget(key, mc)
+			} else {
+				go m.watch(key, mc)
+			}
+		}
+
+		select {
+		case <-mc.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if mc.err != nil {
+			return nil, mc.err
+		}
+		select {
+		case <-mc.done:
+			// Closed since it was dialled, dial again
+			m.forget(key, mc)
+			continue
+		default:
+			return mc.client, nil
+		}
+	}
+}
+
+// dial connects and authenticates to a device
+// with its credentials and SSH parameters.
+func (m *SSHManager) dial(ctx context.Context, d *NetDevice) (*ssh.Client, error) {
+	clientConfig, err := SSHClientConfig(d.Credentials, d.SSHParams)
+	if err != nil {
+		return nil, err
+	}
+	dial, err := jumpHosts.dialer(ctx, d.SSHParams.Proxy, d.SSHParams.JumpHosts, d.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return dialSSHClient(ctx, dial, fmt.Sprintf("%s:%d", d.IP, d.SSHParams.Port), clientConfig)
+}
+
+// interval returns the interval keepalives are sent at.
+func (m *SSHManager) interval() time.Duration {
+	if m.KeepAlive == 0 {
+		return DefaultSSHKeepAlive
+	}
+	return m.KeepAlive
+}
+
+// watch sends keepalives to a client until it is closed, then
+// forgets it. A client that does not answer a keepalive within
+// the interval is closed.
+func (m *SSHManager) watch(key string, mc *managedClient) {
+	closed := make(chan struct{})
+	go func() {
+		mc.client.Wait()
+		close(closed)
+	}()
+
+	defer func() {
+		close(mc.done)
+		m.forget(key, mc)
+	}()
+
+	interval := m.interval()
+	if interval < 0 {
+		<-closed
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+		if err := keepAlive(mc.client, interval); err != nil {
+			mc.client.Close()
+			<-closed
+			return
+		}
+	}
+}
+
+// keepAlive sends a keepalive to a client, an error is
+// returned when it is not answered within timeout.
+func keepAlive(client *ssh.Client, timeout time.Duration) error {
+	replied := make(chan error, 1)
+	go func() {
+		// The reply does not matter, only that there is one
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+	select {
+	case err := <-replied:
+		return err
+	case <-time.After(timeout):
+		return errors.New("ssh manager: keepalive timeout")
+	}
+}
+
+// forget removes a client from the manager.
+func (m *SSHManager) forget(key string, mc *managedClient) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.clients[key] == mc {
+		delete(m.clients, key)
+	}
+}
+
+// drop closes and forgets a client that failed to open a
+// channel when it was lost. It reports whether it was, the
+// channel can then be opened on a new client.
+func (m *SSHManager) drop(d *NetDevice, client *ssh.Client) bool {
+	timeout := m.interval()
+	if timeout < 0 {
+		timeout = DefaultSSHKeepAlive
+	}
+	if keepAlive(client, timeout) == nil {
+		return false
+	}
+	client.Close()
+
+	key := sshManagerKey(d)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mc, ok := m.clients[key]; ok {
+		select {
+		case <-mc.ready:
+			if mc.client == client {
+				delete(m.clients, key)
+			}
+		default:
+		}
+	}
+	return true
+}
+
+// Session starts an interactive shell on the device's client.
+// Closing the session leaves the client open.
+func (m *SSHManager) Session(ctx context.Context, d *NetDevice) (SSHConn, error) {
+	client, err := m.Client(ctx, d)
+	if err != nil {
+		return SSHConn{}, err
+	}
+	conn, err := startShell(ctx, client)
+	if err != nil && ctx.Err() == nil && m.drop(d, client) {
+		// The connection was lost, dial the device again
+		if client, err = m.Client(ctx, d); err != nil {
+			return SSHConn{}, err
+		}
+		conn, err = startShell(ctx, client)
+	}
+	return conn, err
+}
+
+// Exec runs a command in an exec channel of the device's client
+// and returns its output. A command that exits with an error
+// status returns an *ssh.ExitError with the output.
+func (m *SSHManager) Exec(ctx context.Context, d *NetDevice, cmd string) (string, error) {
+	client, err := m.Client(ctx, d)
+	if err != nil {
+		return "", err
+	}
+	out, err := execCommand(ctx, client, cmd)
+	if err != nil && !isExitError(err) && ctx.Err() == nil && m.drop(d, client) {
+		// The connection was lost, dial the device again
+		if client, err = m.Client(ctx, d); err != nil {
+			return "", err
+		}
+		out, err = execCommand(ctx, client, cmd)
+	}
+	return out, err
+}
+
+// Close closes the clients of the manager, the manager
+// cannot be used once it is closed.
+func (m *SSHManager) Close() error {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = nil
+	m.closed = true
+	m.mu.Unlock()
+
+	for _, mc := range clients {
+		<-mc.ready
+		if mc.client != nil {
+			mc.client.Close()
+		}
+	}
+	return nil
+}
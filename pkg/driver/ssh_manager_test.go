@@ -0,0 +1,136 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+	"golang.org/x/crypto/ssh"
+)
+
+// newManagedDevice returns a Cisco IOS device
+// served by fs with its SSH connection held by m.
+func newManagedDevice(t *testing.T, fs *fakeSSHServer, m *driver.SSHManager) driver.NetDevice {
+	t.Helper()
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "ssh",
+		SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true},
+		Credentials: data.Credentials{Username: "admin", Password: "cisco"},
+		SSHManager:  m,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// waitFor fails the test if cond is not met within a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSSHManagerReuse(t *testing.T) {
+	t.Parallel()
+	fs := newFakeSSHServer(t, "admin", "cisco", "\r\nrouter#", iosShell)
+	m := &driver.SSHManager{}
+	d := newManagedDevice(t, fs, m)
+
+	for i := 0; i < 3; i++ {
+		result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+		if !result.OK {
+			t.Fatalf("want OK, got %v", result.Error)
+		}
+	}
+	out, err := m.Exec(context.Background(), &d, "show clock")
+	if err != nil || out != "\r\nrouter#" {
+		t.Errorf("want the output of the command, got %q, %v", out, err)
+	}
+	if fs.connections() != 1 {
+		t.Errorf("want 1 connection, got %d", fs.connections())
+	}
+	if fs.open() != 1 {
+		t.Errorf("want the connection left open, got %d open", fs.open())
+	}
+
+	m.Close()
+	waitFor(t, "the connection to close", func() bool { return fs.open() == 0 })
+	if _, err := m.Client(context.Background(), &d); err == nil {
+		t.Error("want an error once the manager is closed")
+	}
+}
+
+func TestSSHManagerReconnect(t *testing.T) {
+	t.Parallel()
+	fs := newFakeSSHServer(t, "admin", "cisco", "\r\nrouter#", iosShell)
+	m := &driver.SSHManager{KeepAlive: -1}
+	defer m.Close()
+	d := newManagedDevice(t, fs, m)
+
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+	if !result.OK {
+		t.Fatalf("want OK, got %v", result.Error)
+	}
+
+	// The device drops the connection
+	fs.drop()
+	result = driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+	if !result.OK {
+		t.Fatalf("want OK after the connection dropped, got %v", result.Error)
+	}
+	if _, err := m.Exec(context.Background(), &d, "show clock"); err != nil {
+		t.Errorf("want exec on the new connection, got %v", err)
+	}
+	if fs.connections() != 2 {
+		t.Errorf("want 2 connections, got %d", fs.connections())
+	}
+}
+
+func TestSSHManagerKeepAlive(t *testing.T) {
+	t.Parallel()
+	fs := newFakeSSHServer(t, "admin", "cisco", "\r\nrouter#", iosShell)
+	m := &driver.SSHManager{KeepAlive: 10 * time.Millisecond}
+	defer m.Close()
+	d := newManagedDevice(t, fs, m)
+
+	if _, err := m.Client(context.Background(), &d); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "keepalives", func() bool { return fs.keepalivesReceived() >= 2 })
+}
+
+func TestSSHManagerExecExitStatus(t *testing.T) {
+	t.Parallel()
+	fs := newFakeFileServer(t, "admin", "cisco", "", t.TempDir(), iosShell)
+	m := &driver.SSHManager{}
+	defer m.Close()
+	d := newManagedDevice(t, fs, m)
+
+	// scp without a file exits with an error status
+	_, err := m.Exec(context.Background(), &d, "scp -t")
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("want an *ssh.ExitError, got %v", err)
+	}
+}
+
+func TestDisconnectSSHClosesConnection(t *testing.T) {
+	t.Parallel()
+	fs := newFakeSSHServer(t, "admin", "cisco", "\r\nrouter#", iosShell)
+	d := newManagedDevice(t, fs, nil)
+
+	result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+	if !result.OK {
+		t.Fatalf("want OK, got %v", result.Error)
+	}
+	waitFor(t, "the connection to close", func() bool { return fs.open() == 0 })
+}
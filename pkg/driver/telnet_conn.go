@@ -0,0 +1,239 @@
+package driver
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// Telnet commands and options, RFC 854 and RFC 855.
+const (
+	telnetIAC  = 255
+	telnetDONT = 254
+	telnetDO   = 253
+	telnetWONT = 252
+	telnetWILL = 251
+	telnetSB   = 250
+	telnetSE   = 240
+
+	telnetOptEcho  = 1
+	telnetOptSGA   = 3
+	telnetOptTType = 24
+	telnetOptNAWS  = 31
+
+	telnetTTypeIs   = 0
+	telnetTTypeSend = 1
+)
+
+// telnetTerminal is the terminal type sent to
+// devices that ask for it.
+const telnetTerminal = "VT100"
+
+// telnetWindow is the window size sent to devices that ask for it.
+// A height of 0 disables paging on the devices that honour it.
+var telnetWindow = []byte{0x01, 0xf4, 0x00, 0x00}
+
+// States of the Telnet protocol reader.
+const (
+	telnetData = iota
+	telnetCR
+	telnetCommand
+	telnetOption
+	telnetSub
+	telnetSubIAC
+)
+
+// telnetNetConn is a Telnet connection. Reads return the data the
+// device sends as soon as it arrives, with the protocol's commands
+// removed and its option negotiation answered. Writes escape IAC.
+type telnetNetConn struct {
+	net.Conn
+
+	// wmu serializes writes, negotiation is answered
+	// while reading as commands are written.
+	wmu sync.Mutex
+
+	state  int
+	verb   byte
+	sub    []byte
+	raw    []byte
+	local  map[byte]bool
+	remote map[byte]bool
+}
+
+func newTelnetNetConn(conn net.Conn) *telnetNetConn {
+	return &telnetNetConn{
+		Conn:   conn,
+		raw:    make([]byte, 8192),
+		local:  make(map[byte]bool),
+		remote: make(map[byte]bool),
+	}
+}
+
+// Read reads the data sent by the device. It only returns without
+// data on an error, reads of protocol commands alone are retried.
+func (c *telnetNetConn) Read(p []byte) (int, error) {
+	for {
+		size := len(p)
+		if size > len(c.raw) {
+			size = len(c.raw)
+		}
+		n, err := c.Conn.Read(c.raw[:size])
+		out, werr := c.decode(p[:0], c.raw[:n])
+		if len(out) > 0 || err != nil || werr != nil {
+			if err == nil {
+				err = werr
+			}
+			return len(out), err
+		}
+	}
+}
+
+// decode appends the data of b to out and answers the
+// negotiation it holds. The state carries across reads.
+func (c *telnetNetConn) decode(out, b []byte) ([]byte, error) {
+	var err error
+	for _, ch := range b {
+		switch c.state {
+		case telnetCR:
+			// CR NUL is a carriage return
+			c.state = telnetData
+			if ch == 0 {
+				continue
+			}
+			fallthrough
+		case telnetData:
+			switch ch {
+			case telnetIAC:
+				c.state = telnetCommand
+			case '\r':
+				c.state = telnetCR
+				out = append(out, ch)
+			default:
+				out = append(out, ch)
+			}
+		case telnetCommand:
+			c.state = telnetData
+			switch ch {
+			case telnetIAC:
+				out = append(out, ch)
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				c.verb = ch
+				c.state = telnetOption
+			case telnetSB:
+				c.sub = c.sub[:0]
+				c.state = telnetSub
+			}
+		case telnetOption:
+			c.state = telnetData
+			if nerr := c.negotiate(c.verb, ch); nerr != nil && err == nil {
+				err = nerr
+			}
+		case telnetSub:
+			if ch == telnetIAC {
+				c.state = telnetSubIAC
+			} else {
+				c.sub = append(c.sub, ch)
+			}
+		case telnetSubIAC:
+			switch ch {
+			case telnetIAC:
+				c.sub = append(c.sub, ch)
+				c.state = telnetSub
+			case telnetSE:
+				c.state = telnetData
+				if serr := c.subnegotiate(c.sub); serr != nil && err == nil {
+					err = serr
+				}
+			default:
+				c.state = telnetData
+			}
+		}
+	}
+	return out, err
+}
+
+// negotiate answers a request to enable or disable an option. The
+// device may echo and suppress go ahead, jato offers the terminal
+// type and window size. Other options are refused. Requests for
+// the state an option is already in are not answered.
+func (c *telnetNetConn) negotiate(verb, opt byte) error {
+	switch verb {
+	case telnetWILL:
+		if opt != telnetOptEcho && opt != telnetOptSGA {
+			return c.command(telnetDONT, opt)
+		}
+		if c.remote[opt] {
+			return nil
+		}
+		c.remote[opt] = true
+		return c.command(telnetDO, opt)
+	case telnetWONT:
+		if !c.remote[opt] {
+			return nil
+		}
+		c.remote[opt] = false
+		return c.command(telnetDONT, opt)
+	case telnetDO:
+		if opt != telnetOptSGA && opt != telnetOptTType && opt != telnetOptNAWS {
+			return c.command(telnetWONT, opt)
+		}
+		if c.local[opt] {
+			return nil
+		}
+		c.local[opt] = true
+		if err := c.command(telnetWILL, opt); err != nil {
+			return err
+		}
+		if opt == telnetOptNAWS {
+			return c.subcommand(telnetOptNAWS, telnetWindow)
+		}
+		return nil
+	case telnetDONT:
+		if !c.local[opt] {
+			return nil
+		}
+		c.local[opt] = false
+		return c.command(telnetWONT, opt)
+	}
+	return nil
+}
+
+// subnegotiate answers a request for the terminal type.
+func (c *telnetNetConn) subnegotiate(sub []byte) error {
+	if len(sub) == 2 && sub[0] == telnetOptTType && sub[1] == telnetTTypeSend {
+		return c.subcommand(telnetOptTType, append([]byte{telnetTTypeIs}, telnetTerminal...))
+	}
+	return nil
+}
+
+func (c *telnetNetConn) command(verb, opt byte) error {
+	return c.writeRaw([]byte{telnetIAC, verb, opt})
+}
+
+func (c *telnetNetConn) subcommand(opt byte, data []byte) error {
+	b := []byte{telnetIAC, telnetSB, opt}
+	b = append(b, escapeIAC(data)...)
+	b = append(b, telnetIAC, telnetSE)
+	return c.writeRaw(b)
+}
+
+func (c *telnetNetConn) writeRaw(b []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.Conn.Write(b)
+	return err
+}
+
+// Write sends data to the device, escaping IAC.
+func (c *telnetNetConn) Write(p []byte) (int, error) {
+	if err := c.writeRaw(escapeIAC(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// escapeIAC doubles the IAC bytes of data.
+func escapeIAC(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})
+}
@@ -0,0 +1,333 @@
+package driver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// telnetLogin answers a Telnet login with the password prompt, then
+// answers each line with the output of respond. It records the lines
+// it receives.
+type telnetLogin struct {
+	mu       sync.Mutex
+	lines    []string
+	password string
+	respond  func(line string) string
+}
+
+func (tl *telnetLogin) answer(line string) string {
+	tl.mu.Lock()
+	tl.lines = append(tl.lines, line)
+	tl.mu.Unlock()
+
+	switch line {
+	case "admin":
+		return "\r\nPassword: "
+	case tl.password:
+		return tl.respond("")
+	}
+	return tl.respond(line)
+}
+
+func (tl *telnetLogin) received() []string {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return append([]string{}, tl.lines...)
+}
+
+// eosTelnet answers like an Arista EOS device, it
+// lands at the user prompt and enables without a password.
+func eosTelnet() func(line string) string {
+	enabled := false
+	return func(line string) string {
+		switch line {
+		case "enable":
+			enabled = true
+		case "show version":
+			return "\r\nArista vEOS\r\nSoftware image version: 4.25.0F\r\nlocalhost#"
+		}
+		if enabled {
+			return "\r\nlocalhost#"
+		}
+		return "\r\nlocalhost>"
+	}
+}
+
+// junosTelnet answers like a Juniper Junos device.
+func junosTelnet(line string) string {
+	switch line {
+	case "":
+		return "\r\n--- JUNOS 20.4R1.12 Kernel 64-bit\r\nadmin@vmx-1> "
+	case "show version":
+		return "\r\nHostname: vmx-1\r\nModel: vmx\r\nJunos: 20.4R1.12\r\n\r\nadmin@vmx-1> "
+	}
+	return "\r\n\r\nadmin@vmx-1> "
+}
+
+func TestRunWithTelnetPlatforms(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		vendor       string
+		platform     string
+		banner       string
+		respond      func(line string) string
+		wantReceived []string
+		wantOutput   string
+	}
+	testCases := []testCase{
+		{
+			vendor:       "arista",
+			platform:     "eos",
+			banner:       "\r\nlocalhost login: ",
+			respond:      eosTelnet(),
+			wantReceived: []string{"admin", "secret", "enable", "terminal length 0", "terminal width 32767", "show version"},
+			wantOutput:   "Software image version: 4.25.0F",
+		},
+		{
+			vendor:       "juniper",
+			platform:     "junos",
+			banner:       "\r\nvmx-1 (ttyu0)\r\n\r\nlogin: ",
+			respond:      junosTelnet,
+			wantReceived: []string{"admin", "secret", "set cli screen-length 0", "set cli screen-width 0", "show version"},
+			wantOutput:   "Junos: 20.4R1.12",
+		},
+	}
+
+	for _, tc := range testCases {
+		tl := &telnetLogin{password: "secret", respond: tc.respond}
+		fd := newFakeDevice(t, tc.banner, tl.answer)
+
+		d, err := driver.NewDevice(driver.NetDevice{
+			Name: tc.platform, IP: "127.0.0.1", Vendor: tc.vendor, Platform: tc.platform, Connector: "telnet",
+			TelnetParams: driver.TelnetParams{Port: fd.port()},
+			Credentials:  data.Credentials{Username: "admin", Password: "secret", SuperPassword: "enable"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := driver.Run(context.Background(), d, driver.Job{Commands: []string{"show version"}})
+		if !result.OK {
+			t.Fatalf("%s: want OK, got %v", tc.platform, result.Error)
+		}
+		if len(result.CommandOutputs) != 1 || !strings.Contains(result.CommandOutputs[0].Output, tc.wantOutput) {
+			t.Errorf("%s: want output containing %q, got %v", tc.platform, tc.wantOutput, result.CommandOutputs)
+		}
+
+		got := strings.Join(tl.received(), "|")
+		want := strings.Join(tc.wantReceived, "|")
+		if got != want {
+			t.Errorf("%s: want received %s, got %s", tc.platform, want, got)
+		}
+	}
+}
+
+// iosAuth answers a Telnet login to a Cisco IOS privileged prompt,
+// refusing passwords other than password.
+func iosAuth(password string, refusal string) func(line string) string {
+	loggedIn := false
+	return func(line string) string {
+		switch {
+		case loggedIn:
+			return "\r\nrouter#"
+		case line == "admin":
+			return "\r\nPassword: "
+		case line == password:
+			loggedIn = true
+			return "\r\nrouter#"
+		}
+		return refusal
+	}
+}
+
+func TestConnectWithTelnetLogin(t *testing.T) {
+	t.Parallel()
+	type testCase struct {
+		name     string
+		banner   string
+		respond  func(line string) string
+		password string
+		wantErr  error
+	}
+	testCases := []testCase{
+		{
+			name:     "username",
+			banner:   "\r\nUser Access Verification\r\n\r\nUsername: ",
+			respond:  iosAuth("cisco", ""),
+			password: "cisco",
+		},
+		{
+			name:     "login",
+			banner:   "\r\nrouter login: ",
+			respond:  iosAuth("cisco", ""),
+			password: "cisco",
+		},
+		{
+			name:     "banner",
+			banner:   "\r\n*****\r\nAuthorized access only\r\nUsername: admin\r\n*****\r\n\r\nUsername: ",
+			respond:  iosAuth("cisco", ""),
+			password: "cisco",
+		},
+		{
+			name:     "password only",
+			banner:   "\r\nUser Access Verification\r\n\r\nPassword: ",
+			respond:  iosAuth("cisco", "\r\n% Bad passwords\r\n\r\nPassword: "),
+			password: "cisco",
+		},
+		{
+			name:     "at prompt",
+			banner:   "\r\nrouter#",
+			respond:  iosAuth("cisco", "\r\nrouter#"),
+			password: "cisco",
+		},
+		{
+			name:     "login invalid",
+			banner:   "\r\nUsername: ",
+			respond:  iosAuth("cisco", "\r\n% Login invalid\r\n\r\nUsername: "),
+			password: "wrong",
+			wantErr:  driver.ErrLoginFailed,
+		},
+		{
+			name:     "bad password",
+			banner:   "\r\nPassword: ",
+			respond:  iosAuth("cisco", "\r\n% Bad passwords\r\n\r\nPassword: "),
+			password: "wrong",
+			wantErr:  driver.ErrLoginFailed,
+		},
+		{
+			name:     "no prompt",
+			banner:   "\r\nWelcome\r\n",
+			respond:  iosAuth("cisco", ""),
+			password: "cisco",
+			wantErr:  context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fd := newFakeDevice(t, tc.banner, tc.respond)
+			d, err := driver.NewDevice(driver.NetDevice{
+				Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+				TelnetParams: driver.TelnetParams{Port: fd.port()},
+				Credentials:  data.Credentials{Username: "admin", Password: tc.password},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = d.ConnectWithTelnet(context.Background())
+			if err == nil {
+				defer d.DisconnectTelnet()
+			}
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("want no error, got %v", err)
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("want %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConnectWithTelnetErrorMessage(t *testing.T) {
+	t.Parallel()
+	fd := newFakeDevice(t, "\r\nUsername: ", iosAuth("cisco", "\r\n% Authentication failed\r\n\r\nUsername: "))
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+		TelnetParams: driver.TelnetParams{Port: fd.port()},
+		Credentials:  data.Credentials{Username: "admin", Password: "wrong"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.ConnectWithTelnet(context.Background())
+	want := "login failed: % Authentication failed"
+	if err == nil || err.Error() != want {
+		t.Errorf("want %q, got %v", want, err)
+	}
+}
+
+func TestWriteTelnet(t *testing.T) {
+	t.Parallel()
+	// Lines end with CR LF, as the Telnet protocol defines
+	var b bytes.Buffer
+	if err := driver.WriteTelnet(&b, "show version"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "show version\r\n"; b.String() != want {
+		t.Errorf("want %q, got %q", want, b.String())
+	}
+}
+
+func TestRunWithTelnetNegotiation(t *testing.T) {
+	t.Parallel()
+	const (
+		iac  = "\xff"
+		will = "\xfb"
+		wont = "\xfc"
+		do   = "\xfd"
+		dont = "\xfe"
+		sb   = "\xfa"
+		se   = "\xf0"
+	)
+	negotiation := iac + will + "\x01" + iac + will + "\x03" + iac + do + "\x18" + iac + do + "\x1f" +
+		iac + sb + "\x18\x01" + iac + se + iac + do + "\x27" + iac + will + "\x05"
+
+	// Long output with an escaped IAC and a CR NUL
+	long := strings.Repeat("GigabitEthernet0/1 is up, line protocol is up\r\n", 4096)
+	respond := iosAuth("cisco", "")
+	fd := newFakeDevice(t, negotiation+"\r\nUsername: ", func(line string) string {
+		if line == "show tech-support" {
+			respond(line)
+			return "\r\n" + long + "byte " + iac + iac + "\r\x00\nrouter#"
+		}
+		return respond(line)
+	})
+
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "telnet",
+		TelnetParams: driver.TelnetParams{Port: fd.port()},
+		Credentials:  data.Credentials{Username: "admin", Password: "cisco"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := driver.RunWithTelnet(context.Background(), d, driver.Job{Commands: []string{"show tech-support"}})
+	if !result.OK {
+		t.Fatalf("want OK, got %v", result.Error)
+	}
+	out := result.CommandOutputs[0].Output
+	if !strings.Contains(out, long) {
+		t.Errorf("want %d bytes of output, got %d", len(long), len(out))
+	}
+	if !strings.HasSuffix(out, "byte "+iac) || strings.Contains(out, "\x00") {
+		t.Errorf("want an unescaped IAC and no NUL, got %q", out[len(out)-20:])
+	}
+
+	got := string(fd.telnetCommands())
+	for _, want := range []string{
+		iac + do + "\x01",
+		iac + do + "\x03",
+		iac + will + "\x18",
+		iac + will + "\x1f",
+		iac + sb + "\x1f\x01\xf4\x00\x00" + iac + se,
+		iac + sb + "\x18\x00VT100" + iac + se,
+		iac + wont + "\x27",
+		iac + dont + "\x05",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want reply %q, got %q", want, got)
+		}
+	}
+}
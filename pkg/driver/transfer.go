@@ -0,0 +1,316 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// File transfer protocols.
+const (
+	TransferSCP  = "scp"
+	TransferSFTP = "sftp"
+)
+
+// TransferOptions control how a file is copied to or from a device.
+type TransferOptions struct {
+	// Protocol is scp or sftp, sftp when empty.
+	Protocol string
+	// Progress is called as the file is copied.
+	Progress func(TransferProgress)
+	// Resume continues an interrupted SFTP transfer from the
+	// size of the partial file. SCP transfers start over.
+	Resume bool
+	// Verify compares the MD5 checksum of the local file with
+	// the one the platform's checksum command returns.
+	Verify bool
+}
+
+// TransferProgress reports how much of a file was copied.
+type TransferProgress struct {
+	File string
+	// Bytes copied, including those of a resumed transfer.
+	Bytes int64
+	// Total is the size of the file.
+	Total int64
+}
+
+// TransferResult describes a completed transfer.
+type TransferResult struct {
+	// Bytes copied by the transfer.
+	Bytes int64
+	// Offset the transfer was resumed from.
+	Offset int64
+	// MD5 checksum of the local file, set when verified.
+	MD5      string
+	Verified bool
+}
+
+// ChecksumMismatchError is returned when the checksum of
+// a copied file on the device differs from the local one.
+type ChecksumMismatchError struct {
+	File   string
+	Local  string
+	Remote string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: %s: local %s, remote %s", e.File, e.Local, e.Remote)
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	io.Reader
+	progress func(TransferProgress)
+	p        TransferProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if n > 0 {
+		r.p.Bytes += int64(n)
+		r.progress(r.p)
+	}
+	return n, err
+}
+
+// progressWriter reports the bytes written through it.
+type progressWriter struct {
+	io.Writer
+	progress func(TransferProgress)
+	p        TransferProgress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	if n > 0 {
+		w.p.Bytes += int64(n)
+		w.progress(w.p)
+	}
+	return n, err
+}
+
+// PutFile copies a local file to the device over SCP or SFTP.
+// The device's credentials and SSH parameters, including its
+// jump hosts, are used. The copy is abandoned when the context
+// is done.
+func (d *NetDevice) PutFile(ctx context.Context, local, remote string, opts TransferOptions) (TransferResult, error) {
+	res := TransferResult{}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return res, err
+	}
+
+	err = d.withSSHClient(ctx, func(client *ssh.Client) error {
+		var r io.Reader = f
+		if opts.Progress != nil {
+			r = &progressReader{Reader: f, progress: opts.Progress, p: TransferProgress{File: remote, Total: fi.Size()}}
+		}
+
+		switch opts.Protocol {
+		case TransferSCP:
+			res.Bytes = fi.Size()
+			return scpPut(client, remote, r, fi.Size())
+		case TransferSFTP, "":
+		default:
+			return fmt.Errorf("unknown transfer protocol: %s", opts.Protocol)
+		}
+
+		c, err := newSFTPClient(client)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		if opts.Resume {
+			size, err := c.size(remote)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+			case err != nil:
+				return err
+			case size <= fi.Size():
+				res.Offset = size
+			}
+		}
+		if _, err := f.Seek(res.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		if pr, ok := r.(*progressReader); ok {
+			pr.p.Bytes = res.Offset
+		}
+		res.Bytes = fi.Size() - res.Offset
+		return c.put(remote, r, res.Offset)
+	})
+	if err != nil {
+		return res, err
+	}
+
+	if opts.Verify {
+		return res, d.verify(ctx, local, remote, &res)
+	}
+	return res, nil
+}
+
+// GetFile copies a file from the device to a local file over
+// SCP or SFTP. The device's credentials and SSH parameters,
+// including its jump hosts, are used. The copy is abandoned
+// when the context is done. The file is copied next to local
+// and renamed over it once copied, so a failed copy leaves
+// local as it was. A resumed copy appends to local.
+func (d *NetDevice) GetFile(ctx context.Context, remote, local string, opts TransferOptions) (TransferResult, error) {
+	res := TransferResult{}
+
+	resume := opts.Resume && opts.Protocol != TransferSCP
+	var f *os.File
+	var err error
+	if resume {
+		f, err = os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	} else {
+		f, err = ioutil.TempFile(filepath.Dir(local), "."+filepath.Base(local)+".*")
+	}
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	if !resume {
+		defer os.Remove(f.Name())
+	}
+
+	err = d.withSSHClient(ctx, func(client *ssh.Client) error {
+		pw := &progressWriter{Writer: f, progress: opts.Progress, p: TransferProgress{File: remote}}
+		var w io.Writer = f
+		if opts.Progress != nil {
+			w = pw
+		}
+
+		switch opts.Protocol {
+		case TransferSCP:
+			err := scpGet(client, remote, w, func(size int64) { pw.p.Total = size })
+			res.Bytes = pw.p.Bytes
+			return err
+		case TransferSFTP, "":
+		default:
+			return fmt.Errorf("unknown transfer protocol: %s", opts.Protocol)
+		}
+
+		c, err := newSFTPClient(client)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		size, err := c.size(remote)
+		if err != nil {
+			return err
+		}
+		if opts.Resume {
+			fi, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			if fi.Size() > size {
+				return fmt.Errorf("unable to resume: %s is larger than %s", local, remote)
+			}
+			res.Offset = fi.Size()
+		}
+		pw.p.Total = size
+		pw.p.Bytes = res.Offset
+		res.Bytes = size - res.Offset
+		return c.get(remote, w, res.Offset)
+	})
+	if err != nil {
+		return res, err
+	}
+	if !resume {
+		if err := replaceWith(f, local); err != nil {
+			return res, err
+		}
+	}
+
+	if opts.Verify {
+		return res, d.verify(ctx, local, remote, &res)
+	}
+	return res, nil
+}
+
+// replaceWith closes f and renames it over name, keeping the
+// mode of name. A new file is made 0644.
+func replaceWith(f *os.File, name string) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(name); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// withSSHClient connects an SSH client to the device, calls fn
+// with it and disconnects. The client is closed when the
+// context is done.
+func (d *NetDevice) withSSHClient(ctx context.Context, fn func(*ssh.Client) error) error {
+	InitSSHParams(&d.SSHParams)
+	clientConfig, err := SSHClientConfig(d.Credentials, d.SSHParams)
+	if err != nil {
+		return err
+	}
+	dial, err := jumpHosts.dialer(ctx, d.SSHParams.Proxy, d.SSHParams.JumpHosts, d.Credentials)
+	if err != nil {
+		return err
+	}
+	client, err := dialSSHClient(ctx, dial, fmt.Sprintf("%s:%d", d.IP, d.SSHParams.Port), clientConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stop := closeOnDone(ctx, client)
+	defer stop()
+	return contextError(ctx, fn(client))
+}
+
+// verify compares the checksum of the local file with the
+// one computed by the device. The device's open SSH session
+// is used, or one is opened for the command.
+func (d *NetDevice) verify(ctx context.Context, local, remote string, res *TransferResult) error {
+	sum, err := fileMD5(local)
+	if err != nil {
+		return err
+	}
+	res.MD5 = sum
+
+	if d.SSHConn.Session == nil {
+		if err := d.ConnectWithSSH(ctx); err != nil {
+			return err
+		}
+		defer func() {
+			d.DisconnectSSH()
+			d.SSHConn = SSHConn{}
+		}()
+	}
+	remoteSum, err := remoteChecksum(ctx, d, remote, d.sendSSH)
+	if err != nil {
+		return err
+	}
+	if remoteSum != sum {
+		return &ChecksumMismatchError{File: remote, Local: sum, Remote: remoteSum}
+	}
+	res.Verified = true
+	return nil
+}
@@ -0,0 +1,280 @@
+package driver_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/automatico/jato/pkg/data"
+	"github.com/automatico/jato/pkg/driver"
+)
+
+// iosFiles answers like a Cisco IOS device, verify /md5
+// returns the checksum of a file in root.
+func iosFiles(root string) func(line string) string {
+	return func(line string) string {
+		if strings.HasPrefix(line, "verify /md5 ") {
+			name := strings.TrimPrefix(line, "verify /md5 ")
+			b, err := os.ReadFile(filepath.Join(root, strings.TrimPrefix(name, "flash:")))
+			if err != nil {
+				return "\r\n%Error opening " + name + " (No such file or directory)\r\nrouter#"
+			}
+			sum := md5.Sum(b)
+			return "\r\n.....Done!\r\nverify /md5 (" + name + ") = " + hex.EncodeToString(sum[:]) + "\r\n\r\nrouter#"
+		}
+		return "\r\nrouter#"
+	}
+}
+
+// newFileDevice returns a Cisco IOS device served by
+// a fake SSH server that keeps its files in root.
+func newFileDevice(t *testing.T, root string, respond func(line string) string) *driver.NetDevice {
+	t.Helper()
+	fs := newFakeFileServer(t, "admin", "cisco", "\r\nrouter#", root, respond)
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "iosv-1", IP: "127.0.0.1", Vendor: "cisco", Platform: "ios", Connector: "ssh",
+		SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true},
+		Credentials: data.Credentials{Username: "admin", Password: "cisco"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &d
+}
+
+// fileContent returns content that spans
+// several SFTP requests.
+func fileContent() []byte {
+	return bytes.Repeat([]byte("jato file transfer\n"), 5000)
+}
+
+func TestPutFile(t *testing.T) {
+	t.Parallel()
+	for _, protocol := range []string{driver.TransferSCP, driver.TransferSFTP} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			d := newFileDevice(t, root, iosFiles(root))
+
+			local := filepath.Join(t.TempDir(), "image.bin")
+			content := fileContent()
+			if err := os.WriteFile(local, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var last driver.TransferProgress
+			res, err := d.PutFile(context.Background(), local, "flash:image.bin", driver.TransferOptions{
+				Protocol: protocol,
+				Verify:   true,
+				Progress: func(p driver.TransferProgress) {
+					mu.Lock()
+					last = p
+					mu.Unlock()
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(root, "image.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("want %d bytes on the device, got %d", len(content), len(got))
+			}
+			if !res.Verified || res.Bytes != int64(len(content)) {
+				t.Errorf("want %d bytes verified, got %+v", len(content), res)
+			}
+			want := driver.TransferProgress{File: "flash:image.bin", Bytes: int64(len(content)), Total: int64(len(content))}
+			if last != want {
+				t.Errorf("want progress %+v, got %+v", want, last)
+			}
+		})
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	t.Parallel()
+	for _, protocol := range []string{driver.TransferSCP, driver.TransferSFTP} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			d := newFileDevice(t, root, iosFiles(root))
+
+			content := fileContent()
+			if err := os.WriteFile(filepath.Join(root, "config.txt"), content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var last driver.TransferProgress
+			local := filepath.Join(t.TempDir(), "config.txt")
+			res, err := d.GetFile(context.Background(), "flash:config.txt", local, driver.TransferOptions{
+				Protocol: protocol,
+				Verify:   true,
+				Progress: func(p driver.TransferProgress) {
+					mu.Lock()
+					last = p
+					mu.Unlock()
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("want %d bytes copied, got %d", len(content), len(got))
+			}
+			if !res.Verified || res.Bytes != int64(len(content)) {
+				t.Errorf("want %d bytes verified, got %+v", len(content), res)
+			}
+			want := driver.TransferProgress{File: "flash:config.txt", Bytes: int64(len(content)), Total: int64(len(content))}
+			if last != want {
+				t.Errorf("want progress %+v, got %+v", want, last)
+			}
+		})
+	}
+}
+
+func TestTransferResume(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	d := newFileDevice(t, root, iosFiles(root))
+	content := fileContent()
+	half := int64(len(content) / 2)
+
+	local := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(local, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "image.bin"), content[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.PutFile(context.Background(), local, "flash:image.bin", driver.TransferOptions{Resume: true, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Offset != half || res.Bytes != int64(len(content))-half || !res.Verified {
+		t.Errorf("want put resumed from %d, got %+v", half, res)
+	}
+
+	partial := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(partial, content[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = d.GetFile(context.Background(), "flash:image.bin", partial, driver.TransferOptions{Resume: true, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Offset != half || res.Bytes != int64(len(content))-half || !res.Verified {
+		t.Errorf("want get resumed from %d, got %+v", half, res)
+	}
+	got, err := os.ReadFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("want %d bytes after resuming, got %d", len(content), len(got))
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	d := newFileDevice(t, root, func(line string) string {
+		if strings.HasPrefix(line, "verify /md5 ") {
+			return "\r\nverify /md5 (flash:image.bin) = 00000000000000000000000000000000\r\nrouter#"
+		}
+		return "\r\nrouter#"
+	})
+
+	local := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(local, fileContent(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := d.PutFile(context.Background(), local, "flash:image.bin", driver.TransferOptions{Verify: true})
+	var mismatch *driver.ChecksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("want a checksum mismatch, got %v", err)
+	}
+
+	_, err = d.GetFile(context.Background(), "flash:missing.bin", filepath.Join(t.TempDir(), "missing.bin"), driver.TransferOptions{})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("want %v, got %v", os.ErrNotExist, err)
+	}
+
+	_, err = d.GetFile(context.Background(), "flash:missing.bin", filepath.Join(t.TempDir(), "missing.bin"), driver.TransferOptions{Protocol: driver.TransferSCP})
+	if err == nil || !strings.Contains(err.Error(), "No such file or directory") {
+		t.Errorf("want the scp error, got %v", err)
+	}
+	// A failed copy leaves the local file as it was
+	d.Password = "wrong"
+	for _, protocol := range []string{driver.TransferSCP, driver.TransferSFTP} {
+		dir := t.TempDir()
+		local := filepath.Join(dir, "config.txt")
+		if err := os.WriteFile(local, []byte("hostname router\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.GetFile(context.Background(), "flash:config.txt", local, driver.TransferOptions{Protocol: protocol}); err == nil {
+			t.Errorf("%s: want an authentication error, got nil", protocol)
+		}
+		if b, _ := os.ReadFile(local); string(b) != "hostname router\n" {
+			t.Errorf("%s: want the local file kept, got %q", protocol, b)
+		}
+		if files, _ := os.ReadDir(dir); len(files) != 1 {
+			t.Errorf("%s: want only the local file, got %d files", protocol, len(files))
+		}
+	}
+}
+
+func TestSCPQuotesPaths(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	fs := newFakeFileServer(t, "admin", "secret", "\r\n$ ", root, func(line string) string { return "\r\n$ " })
+	d, err := driver.NewDevice(driver.NetDevice{
+		Name: "host-1", IP: "127.0.0.1", Vendor: "linux", Platform: "linux", Connector: "ssh",
+		SSHParams:   driver.SSHParams{Port: fs.port(), InsecureConnection: true},
+		Credentials: data.Credentials{Username: "admin", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := filepath.Join(t.TempDir(), "notes.txt")
+	content := []byte("jato file transfer\n")
+	if err := os.WriteFile(local, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := "my file's $(reboot).txt"
+	opts := driver.TransferOptions{Protocol: driver.TransferSCP}
+	if _, err := d.PutFile(context.Background(), local, remote, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetFile(context.Background(), remote, local, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(root, remote))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("want the file on the device, got %q: %v", got, err)
+	}
+	want := []string{`scp -t 'my file'\''s $(reboot).txt'`, `scp -f 'my file'\''s $(reboot).txt'`}
+	if cmds := fs.execsReceived(); strings.Join(cmds, "|") != strings.Join(want, "|") {
+		t.Errorf("want the commands %q, got %q", want, cmds)
+	}
+}